@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+	"url-shortener/internal/client"
+	httpServer "url-shortener/internal/http-server"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// Exit codes
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitUnauthorized = 3
+	exitNotFound     = 4
+	exitConflict     = 5
+	exitBadRequest   = 6
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+type Config struct {
+	URL      string        `yaml:"url" env:"SHORTEN_URL" env-default:"http://localhost:8081/"`
+	Username string        `yaml:"username" env:"SHORTEN_USERNAME"`
+	Password string        `yaml:"password" env:"SHORTEN_PASSWORD"`
+	Timeout  time.Duration `yaml:"timeout" env:"SHORTEN_TIMEOUT" env-default:"10s"`
+}
+
+const usage = `Usage: shorten [flags] <command> [args]
+
+Commands:
+  create <url> [alias]      shorten url, alias is generated if omitted
+  rename <alias> [new]      rename alias, new alias is generated if omitted
+  delete <alias>            delete alias
+  list                      list your links
+  stats                     print statistics of your links
+
+Credentials are read from the config file and the SHORTEN_URL, SHORTEN_USERNAME,
+SHORTEN_PASSWORD and SHORTEN_TIMEOUT environment variables, which take precedence.
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("shorten", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", defaultConfigPath(), "path to config file")
+	output := fs.String("o", outputTable, "output format: table or json")
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *output != outputTable && *output != outputJSON {
+		_, _ = fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to load config: %s\n", err)
+		return exitError
+	}
+
+	if cfg.Username == "" || cfg.Password == "" {
+		_, _ = fmt.Fprintln(stderr, "credentials are not set")
+		return exitUnauthorized
+	}
+
+	c := client.New(cfg.URL, cfg.Username, cfg.Password, cfg.Timeout)
+	p := printer{w: stdout, format: *output}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "create":
+		if len(cmdArgs) < 1 || len(cmdArgs) > 2 {
+			return usageError(stderr, "create <url> [alias]")
+		}
+		shortURL, err := c.Create(ctx, cmdArgs[0], arg(cmdArgs, 1))
+		if err != nil {
+			return fail(stderr, err)
+		}
+		p.value("short_url", shortURL)
+	case "rename":
+		if len(cmdArgs) < 1 || len(cmdArgs) > 2 {
+			return usageError(stderr, "rename <alias> [new_alias]")
+		}
+		shortURL, err := c.Rename(ctx, cmdArgs[0], arg(cmdArgs, 1))
+		if err != nil {
+			return fail(stderr, err)
+		}
+		p.value("short_url", shortURL)
+	case "delete":
+		if len(cmdArgs) != 1 {
+			return usageError(stderr, "delete <alias>")
+		}
+		if err := c.Delete(ctx, cmdArgs[0]); err != nil {
+			return fail(stderr, err)
+		}
+		p.value("deleted", cmdArgs[0])
+	case "list":
+		links, err := c.List(ctx)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		p.links(links)
+	case "stats":
+		links, err := c.List(ctx)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		p.stats(links)
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n", cmd)
+		fs.Usage()
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("SHORTEN_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "shorten", "config.yaml")
+}
+
+// loadConfig reads config file if it exists, environment variables override it
+func loadConfig(path string) (*Config, error) {
+	var cfg Config
+
+	if _, err := os.Stat(path); path == "" || errors.Is(err, os.ErrNotExist) {
+		if err := cleanenv.ReadEnv(&cfg); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+	}
+
+	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+func usageError(stderr io.Writer, cmd string) int {
+	_, _ = fmt.Fprintf(stderr, "usage: shorten %s\n", cmd)
+	return exitUsage
+}
+
+// fail prints {err} and maps it to an exit code
+func fail(stderr io.Writer, err error) int {
+	_, _ = fmt.Fprintf(stderr, "error: %s\n", err)
+
+	if errors.Is(err, client.ErrUnauthorized) {
+		return exitUnauthorized
+	}
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return exitError
+	}
+
+	switch apiErr.Message {
+	case httpServer.AliasNotFound:
+		return exitNotFound
+	case httpServer.AliasAlreadyExist, httpServer.NewAliasAlreadyExists:
+		return exitConflict
+	case httpServer.BadRequest:
+		return exitBadRequest
+	}
+
+	return exitError
+}
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p printer) value(key, value string) {
+	if p.format == outputJSON {
+		p.json(map[string]string{key: value})
+		return
+	}
+
+	_, _ = fmt.Fprintln(p.w, value)
+}
+
+func (p printer) links(links []client.Link) {
+	if p.format == outputJSON {
+		if links == nil {
+			links = []client.Link{}
+		}
+		p.json(links)
+		return
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ALIAS\tSHORT URL\tURL")
+	for _, l := range links {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", l.Alias, l.ShortUrl, l.Url)
+	}
+	_ = tw.Flush()
+}
+
+type hostStats struct {
+	Host  string `json:"host"`
+	Links int    `json:"links"`
+}
+
+type stats struct {
+	Links int         `json:"links"`
+	Hosts []hostStats `json:"hosts"`
+}
+
+func (p printer) stats(links []client.Link) {
+	perHost := make(map[string]int)
+	for _, l := range links {
+		host := l.Url
+		if u, err := url.Parse(l.Url); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		perHost[host]++
+	}
+
+	s := stats{Links: len(links), Hosts: make([]hostStats, 0, len(perHost))}
+	for host, n := range perHost {
+		s.Hosts = append(s.Hosts, hostStats{Host: host, Links: n})
+	}
+	sort.Slice(s.Hosts, func(i, j int) bool {
+		if s.Hosts[i].Links != s.Hosts[j].Links {
+			return s.Hosts[i].Links > s.Hosts[j].Links
+		}
+		return s.Hosts[i].Host < s.Hosts[j].Host
+	})
+
+	if p.format == outputJSON {
+		p.json(s)
+		return
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\n", s.Links)
+	for _, h := range s.Hosts {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", h.Host, h.Links)
+	}
+	_ = tw.Flush()
+}
+
+func (p printer) json(v any) {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
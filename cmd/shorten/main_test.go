@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve starts a fake shortener API answering every request with {code} and {body}
+func serve(t *testing.T, code int, body string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "pasha" || password != "1234" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// setEnv sets the SHORTEN_* environment variables to {env} for the test, unsetting the missing ones
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for _, key := range []string{"SHORTEN_URL", "SHORTEN_USERNAME", "SHORTEN_PASSWORD", "SHORTEN_TIMEOUT"} {
+		t.Setenv(key, env[key])
+		if env[key] == "" {
+			require.NoError(t, os.Unsetenv(key))
+		}
+	}
+}
+
+// useServer points the CLI at {url} with credentials from the environment and returns a missing config path
+func useServer(t *testing.T, url, password string) string {
+	t.Helper()
+
+	setEnv(t, map[string]string{"SHORTEN_URL": url, "SHORTEN_USERNAME": "pasha", "SHORTEN_PASSWORD": password})
+	return filepath.Join(t.TempDir(), "missing.yaml")
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		password string
+		code     int
+		body     string
+		expected int
+	}{
+		{
+			name:     "created",
+			args:     []string{"create", "https://go.dev", "go"},
+			code:     http.StatusOK,
+			body:     `{"status":"OK","alias":"http://localhost:8081/pasha/go"}`,
+			expected: exitOK,
+		},
+		{
+			name:     "wrong password",
+			args:     []string{"list"},
+			password: "wrong",
+			expected: exitUnauthorized,
+		},
+		{
+			name:     "not found",
+			args:     []string{"delete", "go"},
+			code:     http.StatusBadRequest,
+			body:     `{"status":"Error","error":"alias not found"}`,
+			expected: exitNotFound,
+		},
+		{
+			name:     "alias taken",
+			args:     []string{"create", "https://go.dev", "go"},
+			code:     http.StatusConflict,
+			body:     `{"status":"Error","error":"alias already exist"}`,
+			expected: exitConflict,
+		},
+		{
+			name:     "new alias taken",
+			args:     []string{"rename", "go", "golang"},
+			code:     http.StatusConflict,
+			body:     `{"status":"Error","error":"new_alias cannot use, url with this alias already exists"}`,
+			expected: exitConflict,
+		},
+		{
+			name:     "bad request",
+			args:     []string{"create", "not a url"},
+			code:     http.StatusBadRequest,
+			body:     `{"status":"Error","error":"bad request"}`,
+			expected: exitBadRequest,
+		},
+		{
+			name:     "other api error",
+			args:     []string{"list"},
+			code:     http.StatusInternalServerError,
+			body:     `{"status":"Error","error":"internal error"}`,
+			expected: exitError,
+		},
+		{
+			name:     "not json",
+			args:     []string{"list"},
+			code:     http.StatusBadGateway,
+			body:     `bad gateway`,
+			expected: exitError,
+		},
+		{
+			name:     "unknown command",
+			args:     []string{"shrink"},
+			expected: exitUsage,
+		},
+		{
+			name:     "wrong arguments",
+			args:     []string{"delete"},
+			expected: exitUsage,
+		},
+		{
+			name:     "unknown output",
+			args:     []string{"-o", "xml", "list"},
+			expected: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password := tt.password
+			if password == "" {
+				password = "1234"
+			}
+
+			srv := serve(t, tt.code, tt.body)
+			config := useServer(t, srv.URL, password)
+
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"-config", config}, tt.args...), &stdout, &stderr)
+			assert.Equal(t, tt.expected, code, stderr.String())
+		})
+	}
+}
+
+func TestRun_MissingCredentials(t *testing.T) {
+	config := useServer(t, "http://localhost:1", "")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitUnauthorized, run([]string{"-config", config, "list"}, &stdout, &stderr))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+url: http://file.example/
+username: file
+password: file-secret
+timeout: 3s
+`), 0o600))
+
+	tests := []struct {
+		name     string
+		path     string
+		env      map[string]string
+		expected Config
+	}{
+		{
+			name:     "file",
+			path:     path,
+			expected: Config{URL: "http://file.example/", Username: "file", Password: "file-secret", Timeout: 3 * time.Second},
+		},
+		{
+			name:     "env overrides file",
+			path:     path,
+			env:      map[string]string{"SHORTEN_USERNAME": "env", "SHORTEN_TIMEOUT": "5s"},
+			expected: Config{URL: "http://file.example/", Username: "env", Password: "file-secret", Timeout: 5 * time.Second},
+		},
+		{
+			name:     "env without file",
+			path:     filepath.Join(t.TempDir(), "missing.yaml"),
+			env:      map[string]string{"SHORTEN_USERNAME": "env", "SHORTEN_PASSWORD": "env-secret"},
+			expected: Config{URL: "http://localhost:8081/", Username: "env", Password: "env-secret", Timeout: 10 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+
+			cfg, err := loadConfig(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *cfg)
+		})
+	}
+}
+
+func TestRun_Stats(t *testing.T) {
+	srv := serve(t, http.StatusOK, `{"status":"OK","links":[
+		{"alias":"a","url":"https://go.dev/doc"},
+		{"alias":"b","url":"https://github.com/golang/go"},
+		{"alias":"c","url":"https://go.dev/blog"},
+		{"alias":"d","url":"https://pkg.go.dev"},
+		{"alias":"e","url":"not a url"}
+	]}`)
+	config := useServer(t, srv.URL, "1234")
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, exitOK, run([]string{"-config", config, "-o", "json", "stats"}, &stdout, &stderr), stderr.String())
+
+	var s stats
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &s))
+	assert.Equal(t, stats{
+		Links: 5,
+		Hosts: []hostStats{
+			{Host: "go.dev", Links: 2},
+			{Host: "github.com", Links: 1},
+			{Host: "not a url", Links: 1},
+			{Host: "pkg.go.dev", Links: 1},
+		},
+	}, s)
+}
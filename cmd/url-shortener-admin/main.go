@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/cache"
+	redisCache "url-shortener/internal/cache/redis-cache"
+	"url-shortener/internal/config"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+	cachedStorage "url-shortener/internal/storage/cached-storage"
+	"url-shortener/internal/storage/mongodb"
+	"url-shortener/internal/storage/sqlite"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+var errUsage = errors.New("wrong arguments")
+
+const usage = `Usage: url-shortener-admin [flags] <command> [args]
+
+Commands:
+  user create <username> <password>   create user managed by storage
+  user disable <username>             forbid user to authenticate
+  user enable <username>              allow disabled user to authenticate again
+  user utm <username> [key=value...]  set default utm_* parameters of user links,
+                                      keys: source, medium, campaign, term, content;
+                                      no pairs clear the defaults
+  user preview <username> on|off      show the preview page before every redirect of user links
+  links reassign <from> <to>          move all links of a user to another user
+  links purge <username>              delete all links of a user
+  links disable <username> <alias> [reason...]
+                                      stop a link from redirecting keeping its alias, visitors
+                                      get 451 with the reason and the owner cannot enable it
+  links enable <username> <alias>     let a disabled link redirect again
+  cache flush                         remove all cache entries
+  cache rebuild                       flush cache and fill it from storage
+  cache verify                        check cache entries against storage
+  stats                               print storage statistics
+  migrate status                      print sqlite schema migrations
+  migrate up [version]                apply sqlite migrations up to version, latest by default
+  migrate down [version]              revert sqlite migrations down to version, previous by default
+
+The config is read from the -config flag or the CONFIG_PATH environment variable.
+
+Flags:
+`
+
+type admin struct {
+	cfg *config.Config
+	db  *mongodb.Store
+	// svc makes link changes that are recorded in the audit log as made by the caller of the command
+	svc    *service.Shortener
+	cache  cache.Cache
+	stdout io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("url-shortener-admin", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", os.Getenv("CONFIG_PATH"), "path to config file")
+	jsonOutput := fs.Bool("json", false, "print stats as json")
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if *configPath == "" {
+		_, _ = fmt.Fprintln(stderr, "config path is not set")
+		return exitUsage
+	}
+
+	cfg := config.MustLoadByPath(*configPath)
+
+	if fs.Arg(0) == "migrate" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.SqliteDB.Timeout)
+		defer cancel()
+
+		if err := migrate(ctx, cfg.SqliteDB.StoragePath, fs.Args()[1:], stdout); err != nil {
+			_, _ = fmt.Fprintf(stderr, "error: %s\n", err)
+			if errors.Is(err, errUsage) {
+				fs.Usage()
+				return exitUsage
+			}
+			return exitError
+		}
+		return exitOK
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DBConfig.Timeout)
+	defer cancel()
+
+	a := &admin{
+		cfg: cfg,
+		db: mongodb.MustNew(
+			cfg.DBConfig.Timeout,
+			cfg.DBConfig.ConnectionString,
+			cfg.DBConfig.DBName,
+			cfg.DBConfig.CollectionName,
+			cfg.DBConfig.UsersCollectionName,
+			cfg.DBConfig.TrashCollectionName,
+			cfg.DBConfig.AuditCollectionName,
+		),
+		stdout: stdout,
+	}
+	defer func() { _ = a.close(context.Background()) }()
+
+	log := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	a.svc = service.New(log, a.db, a.db, nil, cfg.Trash.Retention, a.db)
+	ctx = service.WithCaller(ctx, service.Caller{Username: actor()})
+
+	var err error
+
+	cmd := fs.Args()
+	switch {
+	case match(cmd, "user", "create", 2):
+		err = a.createUser(ctx, cmd[2], cmd[3])
+	case match(cmd, "user", "disable", 1):
+		err = a.setUserDisabled(ctx, cmd[2], true)
+	case match(cmd, "user", "enable", 1):
+		err = a.setUserDisabled(ctx, cmd[2], false)
+	case len(cmd) >= 3 && cmd[0] == "user" && cmd[1] == "utm":
+		err = a.setUserUTM(ctx, cmd[2], cmd[3:])
+	case match(cmd, "user", "preview", 2):
+		err = a.setUserForcePreview(ctx, cmd[2], cmd[3])
+	case match(cmd, "links", "reassign", 2):
+		err = a.reassignLinks(ctx, cmd[2], cmd[3])
+	case match(cmd, "links", "purge", 1):
+		err = a.purgeLinks(ctx, cmd[2])
+	case len(cmd) >= 4 && cmd[0] == "links" && cmd[1] == "disable":
+		err = a.setLinkDisabled(ctx, cmd[2], cmd[3], true, strings.Join(cmd[4:], " "))
+	case match(cmd, "links", "enable", 2):
+		err = a.setLinkDisabled(ctx, cmd[2], cmd[3], false, "")
+	case match(cmd, "cache", "flush", 0):
+		err = a.flushCache(ctx)
+	case match(cmd, "cache", "rebuild", 0):
+		err = a.rebuildCache(ctx)
+	case match(cmd, "cache", "verify", 0):
+		err = a.verifyCache(ctx)
+	case len(cmd) == 1 && cmd[0] == "stats":
+		err = a.stats(ctx, *jsonOutput)
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command or wrong number of arguments: %v\n", cmd)
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %s\n", err)
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+			return exitUsage
+		}
+		return exitError
+	}
+
+	return exitOK
+}
+
+// match reports whether {cmd} is "{group} {name}" followed by {nArgs} arguments
+func match(cmd []string, group, name string, nArgs int) bool {
+	return len(cmd) == 2+nArgs && cmd[0] == group && cmd[1] == name
+}
+
+// mustCache connects to the cache on first use, so commands that do not need it work without it
+func (a *admin) mustCache() cache.Cache {
+	if a.cache == nil {
+		a.cache = redisCache.MustNew(
+			a.cfg.CacheConfig.ConnectionString,
+			a.cfg.CacheConfig.DB,
+			a.cfg.CacheConfig.Timeout,
+			a.cfg.CacheConfig.Capacity,
+		)
+	}
+
+	return a.cache
+}
+
+func (a *admin) close(ctx context.Context) error {
+	if a.cache != nil {
+		if err := a.cache.Close(ctx); err != nil {
+			return err
+		}
+	}
+
+	return a.db.Close(ctx)
+}
+
+func (a *admin) createUser(ctx context.Context, username, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := a.db.SaveUser(ctx, username, hash); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "user %s created\n", username)
+	return nil
+}
+
+func (a *admin) setUserDisabled(ctx context.Context, username string, disabled bool) error {
+	if err := a.db.SetUserDisabled(ctx, username, disabled); err != nil {
+		return err
+	}
+
+	state := "enabled"
+	if disabled {
+		state = "disabled"
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "user %s %s\n", username, state)
+	return nil
+}
+
+func (a *admin) setUserForcePreview(ctx context.Context, username, state string) error {
+	if state != "on" && state != "off" {
+		return fmt.Errorf("%w: preview must be on or off, got %q", errUsage, state)
+	}
+
+	if err := a.db.SetUserForcePreview(ctx, username, state == "on"); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "forced preview of %s links turned %s\n", username, state)
+	return nil
+}
+
+func (a *admin) setUserUTM(ctx context.Context, username string, pairs []string) error {
+	var utm storage.UTM
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("%w: %q is not key=value", errUsage, pair)
+		}
+
+		switch key {
+		case "source":
+			utm.Source = value
+		case "medium":
+			utm.Medium = value
+		case "campaign":
+			utm.Campaign = value
+		case "term":
+			utm.Term = value
+		case "content":
+			utm.Content = value
+		default:
+			return fmt.Errorf("%w: unknown utm parameter %q", errUsage, key)
+		}
+	}
+
+	if err := a.db.SetUserUTM(ctx, username, utm); err != nil {
+		return err
+	}
+
+	if utm.IsZero() {
+		_, _ = fmt.Fprintf(a.stdout, "utm defaults of %s cleared\n", username)
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "utm defaults of %s set\n", username)
+	return nil
+}
+
+func (a *admin) reassignLinks(ctx context.Context, from, to string) error {
+	links, err := a.db.ListURLs(ctx, from, storage.LinkFilter{})
+	if err != nil {
+		return err
+	}
+
+	cnt, err := a.db.ReassignURLs(ctx, from, to)
+	if cnt > 0 {
+		a.evict(ctx, links)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasAlreadyExist) {
+			return fmt.Errorf("%s already uses some of the aliases of %s, %d links reassigned", to, from, cnt)
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("user %s not found", from)
+		}
+		return err
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "%d links reassigned from %s to %s\n", cnt, from, to)
+	return nil
+}
+
+func (a *admin) purgeLinks(ctx context.Context, username string) error {
+	links, err := a.db.ListURLs(ctx, username, storage.LinkFilter{})
+	if err != nil {
+		return err
+	}
+
+	cnt, err := a.db.PurgeURLs(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	a.evict(ctx, links)
+
+	_, _ = fmt.Fprintf(a.stdout, "%d links of %s purged\n", cnt, username)
+	return nil
+}
+
+// setLinkDisabled disables the link as admin with {reason}, or enables it whoever disabled it
+func (a *admin) setLinkDisabled(ctx context.Context, username, alias string, disabled bool, reason string) error {
+	link, err := a.svc.AdminDisable(ctx, username, alias, disabled, reason)
+	if err != nil {
+		return err
+	}
+
+	a.evict(ctx, []storage.Link{link})
+
+	state := "enabled"
+	if disabled {
+		state = "disabled"
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "link %s/%s %s\n", username, alias, state)
+	return nil
+}
+
+// actor names who runs the command in the audit log by the system user
+func actor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "admin-cli:" + u.Username
+	}
+	return "admin-cli"
+}
+
+// evict removes {links} from the cache, failures are reported but not fatal
+// because the links are already changed in storage
+func (a *admin) evict(ctx context.Context, links []storage.Link) {
+	if len(links) == 0 {
+		return
+	}
+
+	c := a.mustCache()
+	for _, l := range links {
+		if err := c.Delete(ctx, l.Username, l.Alias); err != nil {
+			_, _ = fmt.Fprintf(a.stdout, "failed to evict %s/%s from cache: %s\n", l.Username, l.Alias, err)
+		}
+	}
+}
+
+func (a *admin) flushCache(ctx context.Context) error {
+	if err := a.mustCache().Flush(ctx); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(a.stdout, "cache flushed")
+	return nil
+}
+
+func (a *admin) rebuildCache(ctx context.Context) error {
+	c := a.mustCache()
+
+	links, err := a.db.ListAllURLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Flush(ctx); err != nil {
+		return err
+	}
+
+	// click-limited links are left to storage, which counts their clicks atomically
+	links = slices.DeleteFunc(links, func(l storage.Link) bool { return !cachedStorage.Cacheable(l) })
+
+	if len(links) > a.cfg.CacheConfig.Capacity {
+		links = links[:a.cfg.CacheConfig.Capacity]
+	}
+
+	for _, l := range links {
+		if err := c.Set(ctx, l); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "cache rebuilt with %d links\n", len(links))
+	return nil
+}
+
+func (a *admin) verifyCache(ctx context.Context) error {
+	c := a.mustCache()
+
+	keys, err := c.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	inconsistent := 0
+	for _, key := range keys {
+		cached, err := c.Get(ctx, key.Username, key.Alias)
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+
+		stored, err := a.db.GetLink(ctx, key.Username, key.Alias)
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			inconsistent++
+			_, _ = fmt.Fprintf(a.stdout, "%s/%s: cached %s, not in storage\n", key.Username, key.Alias, cached.Url)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !cachedStorage.Cacheable(stored) {
+			inconsistent++
+			_, _ = fmt.Fprintf(a.stdout, "%s/%s: cached although click-limited\n", key.Username, key.Alias)
+		} else if stored.Url != cached.Url {
+			inconsistent++
+			_, _ = fmt.Fprintf(a.stdout, "%s/%s: cached %s, stored %s\n", key.Username, key.Alias, cached.Url, stored.Url)
+		} else if stored.PasswordHash != cached.PasswordHash {
+			inconsistent++
+			_, _ = fmt.Fprintf(a.stdout, "%s/%s: cached password differs from stored\n", key.Username, key.Alias)
+		}
+	}
+
+	_, _ = fmt.Fprintf(a.stdout, "%d cache entries checked, %d inconsistent\n", len(keys), inconsistent)
+
+	if inconsistent != 0 {
+		return fmt.Errorf("cache is inconsistent with storage, run \"cache rebuild\" to fix it")
+	}
+
+	return nil
+}
+
+func (a *admin) stats(ctx context.Context, jsonOutput bool) error {
+	stats, err := a.db.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "links\t%d\n", stats.Links)
+	_, _ = fmt.Fprintf(tw, "users\t%d\n", stats.Users)
+	_, _ = fmt.Fprintf(tw, "disabled users\t%d\n", stats.DisabledUsers)
+
+	usernames := make([]string, 0, len(stats.LinksPerUser))
+	for username := range stats.LinksPerUser {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	_, _ = fmt.Fprintln(tw, "\nUSER\tLINKS")
+	for _, username := range usernames {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", username, stats.LinksPerUser[username])
+	}
+
+	return tw.Flush()
+}
+
+func migrate(ctx context.Context, storagePath string, args []string, stdout io.Writer) error {
+	if len(args) == 0 || len(args) > 2 || (args[0] == "status" && len(args) != 1) {
+		return errUsage
+	}
+
+	db := sqlite.MustOpen(storagePath)
+	defer func() { _ = db.Close() }()
+
+	m, err := sqlite.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target int
+	switch args[0] {
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(tw, "database version %d, latest version %d\n\n", current, m.Latest())
+		_, _ = fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	case "up":
+		target = m.Latest()
+	case "down":
+		target = current - 1
+	default:
+		return errUsage
+	}
+
+	if len(args) == 2 {
+		if target, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("%w: version must be a number", errUsage)
+		}
+	}
+
+	if (args[0] == "up" && target < current) || (args[0] == "down" && target > current) {
+		return fmt.Errorf("%w: database is at version %d", errUsage, current)
+	}
+
+	if err := m.MigrateTo(ctx, target); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(stdout, "migrated from version %d to %d\n", current, target)
+	return nil
+}
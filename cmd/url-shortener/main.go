@@ -4,20 +4,35 @@ import (
 	"context"
 	"github.com/gin-gonic/gin"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	"url-shortener/internal/auth"
 	redisCache "url-shortener/internal/cache/redis-cache"
 	"url-shortener/internal/config"
+	grpcServer "url-shortener/internal/grpc-server"
+	"url-shortener/internal/http-server/audit"
 	"url-shortener/internal/http-server/delete"
+	"url-shortener/internal/http-server/edit"
 	"url-shortener/internal/http-server/get"
+	"url-shortener/internal/http-server/history"
+	"url-shortener/internal/http-server/list"
 	"url-shortener/internal/http-server/middleware"
+	"url-shortener/internal/http-server/qr"
 	"url-shortener/internal/http-server/save"
+	"url-shortener/internal/http-server/trash"
 	"url-shortener/internal/http-server/update"
+	"url-shortener/internal/lib/geoip"
+	"url-shortener/internal/lib/urlcheck"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/service"
+	cachedStorage "url-shortener/internal/storage/cached-storage"
 	"url-shortener/internal/storage/mongodb"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -32,27 +47,129 @@ func main() {
 	c := redisCache.MustNew(cfg.CacheConfig.ConnectionString, cfg.CacheConfig.DB, cfg.CacheConfig.Timeout, cfg.CacheConfig.Capacity)
 
 	// TODO: init database
-	s := mongodb.MustNew(
+	db := mongodb.MustNew(
 		cfg.DBConfig.Timeout,
-		c,
 		cfg.DBConfig.ConnectionString,
 		cfg.DBConfig.DBName,
 		cfg.DBConfig.CollectionName,
+		cfg.DBConfig.UsersCollectionName,
+		cfg.DBConfig.TrashCollectionName,
+		cfg.DBConfig.AuditCollectionName,
 	)
+	s := cachedStorage.New(db, c)
 	log.Info("database started")
 
+	checker, err := urlcheck.New(cfg.URLCheck.BlocklistPath, cfg.URLCheck.ResolveHosts)
+	if err != nil {
+		panic(err)
+	}
+
+	svc := service.New(log, s, db, checker, cfg.Trash.Retention, db)
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	disableUnsafe := func(rules *urlcheck.Rules) {
+		if !cfg.URLCheck.DisableExisting || rules.Len() == 0 {
+			return
+		}
+
+		ctx := service.WithCaller(watchCtx, service.Caller{Username: service.ActorBlocklist})
+		n, err := svc.DisableMatching(ctx, db, rules.Match)
+		if err != nil {
+			log.Error("failed to disable unsafe links", slog.String("error", err.Error()))
+		}
+		log.Info("unsafe links disabled", slog.Int("links", n))
+	}
+
+	go func() {
+		// links saved before rules were added to the blocklist while the service was down
+		disableUnsafe(checker.Rules())
+
+		checker.Watch(
+			watchCtx,
+			cfg.URLCheck.ReloadInterval,
+			func(added *urlcheck.Rules) {
+				log.Info("blocklist reloaded", slog.Int("added_rules", added.Len()))
+				disableUnsafe(added)
+			},
+			func(err error) {
+				log.Error("failed to reload blocklist", slog.String("error", err.Error()))
+			},
+		)
+	}()
+
+	go svc.EmptyTrashEvery(watchCtx, cfg.Trash.CleanupInterval)
+
 	// TODO: init server
+	authenticator := auth.NewUsers(db, auth.Accounts(cfg.Accounts))
+
+	var geo get.CountryLocator
+	if cfg.GeoIP.DatabasePath != "" {
+		reader, err := geoip.Open(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			panic(err)
+		}
+		geo = reader
+		log.Info("geoip database loaded", slog.String("path", cfg.GeoIP.DatabasePath))
+	}
+
 	router := gin.Default()
-	router.Use(middleware.GetCreator())
-	a := router.Group("/", gin.BasicAuth(gin.Accounts{
-		"pasha": "1234",
-		"vova":  "9876",
-	}))
+	if err := router.SetTrustedProxies(cfg.HttpServer.TrustedProxies); err != nil {
+		panic(err)
+	}
+	// handlers pass the gin context to the service, which reads the caller from the request context
+	router.ContextWithFallback = true
+	router.Use(middleware.RequestID())
+	basicAuth := middleware.BasicAuth(authenticator)
+	caller := middleware.Caller()
+	a := router.Group("/", basicAuth, caller)
 
-	a.POST("/", save.Save(log, s))
-	router.GET("/:username/:alias", get.Get(log, s))
-	a.DELETE("/", delete.Delete(log, s))
-	a.PUT("/", update.Update(log, s))
+	a.POST("/", save.Save(log, svc))
+	getHandler := get.Get(log, svc, cfg.Redirect, geo)
+	router.GET("/:username/:alias", getHandler)
+	router.POST("/:username/:alias", getHandler)
+	qrHandler := qr.QR(log, svc)
+	historyHandler := history.History(log, svc)
+	rollbackHandler := history.Rollback(log, svc)
+	infoHandler := list.Info(log, svc)
+	// authenticated runs the handler after basic auth, since the catch-all routes are public
+	authenticated := func(c *gin.Context, handler gin.HandlerFunc) {
+		basicAuth(c)
+		if !c.IsAborted() {
+			caller(c)
+			handler(c)
+		}
+	}
+	// gin cannot route a static segment next to the catch-all, so the QR code, history and info paths
+	// take precedence over the same paths passed through to the link
+	router.GET("/:username/:alias/*rest", func(c *gin.Context) {
+		switch c.Param("rest") {
+		case "/qr":
+			qrHandler(c)
+		case "/history":
+			authenticated(c, historyHandler)
+		case "/info":
+			authenticated(c, infoHandler)
+		default:
+			getHandler(c)
+		}
+	})
+	router.POST("/:username/:alias/*rest", func(c *gin.Context) {
+		if c.Param("rest") == "/history" {
+			authenticated(c, rollbackHandler)
+			return
+		}
+		getHandler(c)
+	})
+	a.DELETE("/", delete.Delete(log, svc))
+	a.PUT("/", update.Update(log, svc))
+	a.PATCH("/", edit.Edit(log, svc))
+	a.GET("/", list.List(log, svc))
+	a.GET("/trash", trash.List(log, svc))
+	a.POST("/trash", trash.Restore(log, svc))
+	a.DELETE("/trash", trash.Purge(log, svc))
+	a.GET("/audit", middleware.Admin(cfg.Admins), audit.Events(log, svc))
 
 	srv := &http.Server{
 		Addr:         cfg.HttpServer.Port,
@@ -62,6 +179,10 @@ func main() {
 		IdleTimeout:  cfg.HttpServer.IdleTimeout,
 	}
 
+	// TODO: init grpc server
+	gRPCSrv := grpc.NewServer(grpc.UnaryInterceptor(grpcServer.AuthInterceptor(authenticator)))
+	grpcServer.Register(gRPCSrv, log, svc)
+
 	// TODO: start server
 	log.Info("server started")
 	go func() {
@@ -71,6 +192,20 @@ func main() {
 		}
 	}()
 
+	log.Info("grpc server started", slog.String("port", cfg.GRPCServer.Port))
+	go func() {
+		l, err := net.Listen("tcp", cfg.GRPCServer.Port)
+		if err != nil {
+			log.Error("failed to listen grpc port", slog.String("error", err.Error()))
+			return
+		}
+
+		if err := gRPCSrv.Serve(l); err != nil {
+			log.Error(err.Error())
+			return
+		}
+	}()
+
 	// TODO: graceful shutdown
 	done := make(chan os.Signal, 1)
 	defer close(done)
@@ -82,12 +217,26 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := s.Close(ctx); err != nil {
-		log.Error("failed to close db", slog.String("error", err.Error()))
+	stopped := make(chan struct{})
+	go func() {
+		gRPCSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		gRPCSrv.Stop()
 	}
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error("failed to shutdown server", slog.String("error", err.Error()))
+	}
+
+	stopWatch()
+
+	if err := s.Close(ctx); err != nil {
+		log.Error("failed to close db", slog.String("error", err.Error()))
 		return
 	}
 
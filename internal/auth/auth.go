@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"url-shortener/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserDisabled       = errors.New("user is disabled")
+)
+
+// Authenticator checks user credentials.
+// It is shared by HTTP and gRPC servers so both accept the same users
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) error
+}
+
+// Accounts is a static set of username -> password pairs
+type Accounts map[string]string
+
+func (a Accounts) Authenticate(_ context.Context, username, password string) error {
+	expected, ok := a[username]
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// UserProvider returns users kept in storage
+type UserProvider interface {
+	GetUser(ctx context.Context, username string) (storage.User, error)
+}
+
+// Users authenticates users kept in storage.
+// Users that are not in storage or have no password in it are checked by {fallback},
+// but a disabled user is rejected even if {fallback} accepts it
+type Users struct {
+	provider UserProvider
+	fallback Authenticator
+}
+
+func NewUsers(provider UserProvider, fallback Authenticator) *Users {
+	return &Users{
+		provider: provider,
+		fallback: fallback,
+	}
+}
+
+func (u *Users) Authenticate(ctx context.Context, username, password string) error {
+	const op = "auth.Authenticate"
+
+	user, err := u.provider.GetUser(ctx, username)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Disabled {
+		return ErrUserDisabled
+	}
+
+	if user.PasswordHash == "" {
+		if u.fallback == nil {
+			return ErrInvalidCredentials
+		}
+		return u.fallback.Authenticate(ctx, username, password)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
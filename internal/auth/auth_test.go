@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider map[string]storage.User
+
+func (f fakeProvider) GetUser(_ context.Context, username string) (storage.User, error) {
+	user, ok := f[username]
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func TestUsers_Authenticate(t *testing.T) {
+	hash, err := HashPassword("secret")
+	assert.NoError(t, err)
+
+	users := NewUsers(
+		fakeProvider{
+			"kolya": {Username: "kolya", PasswordHash: hash},
+			"vova":  {Username: "vova", Disabled: true},
+			"masha": {Username: "masha", PasswordHash: hash, Disabled: true},
+		},
+		Accounts{"pasha": "1234", "vova": "9876"},
+	)
+
+	tests := []struct {
+		name        string
+		username    string
+		password    string
+		expectedErr error
+	}{
+		{
+			name:     "storage user",
+			username: "kolya",
+			password: "secret",
+		},
+		{
+			name:        "storage user with wrong password",
+			username:    "kolya",
+			password:    "1234",
+			expectedErr: ErrInvalidCredentials,
+		},
+		{
+			name:     "config user",
+			username: "pasha",
+			password: "1234",
+		},
+		{
+			name:        "config user with wrong password",
+			username:    "pasha",
+			password:    "secret",
+			expectedErr: ErrInvalidCredentials,
+		},
+		{
+			name:        "disabled config user",
+			username:    "vova",
+			password:    "9876",
+			expectedErr: ErrUserDisabled,
+		},
+		{
+			name:        "disabled storage user",
+			username:    "masha",
+			password:    "secret",
+			expectedErr: ErrUserDisabled,
+		},
+		{
+			name:        "unknown user",
+			username:    "petya",
+			password:    "secret",
+			expectedErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := users.Authenticate(context.Background(), tt.username, tt.password)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -2,15 +2,19 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"url-shortener/internal/storage"
 )
 
+// Cache keeps whole links, so everything needed to serve a redirect is available on a hit
 type Cache interface {
-	Set(ctx context.Context, url, alias, username string) error
-	Get(ctx context.Context, username, alias string) (string, error)
-	Update(ctx context.Context, username, oldAlias, newAlias string) error
+	Set(ctx context.Context, link storage.Link) error
+	Get(ctx context.Context, username, alias string) (storage.Link, error)
 	Delete(ctx context.Context, username, alias string) error
+	// Flush removes all entries
+	Flush(ctx context.Context) error
+	// Keys returns keys of all entries
+	Keys(ctx context.Context) ([]KeyType, error)
 	Close(ctx context.Context) error
 }
 
@@ -19,14 +23,7 @@ type KeyType struct {
 	Alias    string `json:"alias" redis:"alias"`
 }
 
-type ValueType struct {
-	Url string `json:"url" redis:"url"`
-}
-
-func (v ValueType) MarshalBinary() ([]byte, error) {
-	return json.Marshal(v)
-}
-
 var (
 	ErrTimeExceeded = errors.New("time is out")
+	ErrNotFound     = errors.New("alias not found in cache")
 )
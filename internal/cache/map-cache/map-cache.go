@@ -2,14 +2,14 @@ package mapCache
 
 import (
 	"context"
-	"fmt"
 	"math"
 	"sync"
 	"url-shortener/internal/cache"
+	"url-shortener/internal/storage"
 )
 
 type Cache struct {
-	store     map[cache.KeyType]cache.ValueType
+	store     map[cache.KeyType]storage.Link
 	capacity  int
 	frequency map[cache.KeyType]int
 	mu        sync.RWMutex
@@ -17,7 +17,7 @@ type Cache struct {
 
 func MustNew(capacity int) *Cache {
 	return &Cache{
-		store:     make(map[cache.KeyType]cache.ValueType),
+		store:     make(map[cache.KeyType]storage.Link),
 		capacity:  capacity,
 		frequency: make(map[cache.KeyType]int),
 	}
@@ -27,19 +27,19 @@ func (c *Cache) Close(ctx context.Context) error {
 	return nil
 }
 
-func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
+func (c *Cache) Set(ctx context.Context, link storage.Link) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	done := make(chan struct{})
 	defer close(done)
 
-	key := cache.KeyType{Username: username, Alias: alias}
+	key := cache.KeyType{Username: link.Username, Alias: link.Alias}
 
 	go func() {
 		if _, ok := c.store[key]; ok {
 			c.frequency[key]++
-			c.store[key] = cache.ValueType{Url: url}
+			c.store[key] = link
 
 			done <- struct{}{}
 			return
@@ -60,7 +60,7 @@ func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
 			delete(c.frequency, leastUsageKey)
 		}
 
-		c.store[key] = cache.ValueType{Url: url}
+		c.store[key] = link
 		c.frequency[key]++
 
 		done <- struct{}{}
@@ -74,12 +74,12 @@ func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
 	}
 }
 
-func (c *Cache) Get(ctx context.Context, username, alias string) (string, error) {
+func (c *Cache) Get(ctx context.Context, username, alias string) (storage.Link, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	res := make(chan struct {
-		string
+		storage.Link
 		error
 	})
 	defer close(res)
@@ -91,44 +91,37 @@ func (c *Cache) Get(ctx context.Context, username, alias string) (string, error)
 			c.frequency[key]++
 
 			res <- struct {
-				string
+				storage.Link
 				error
-			}{string: value.Url, error: nil}
+			}{Link: value, error: nil}
 			return
 		}
 
 		res <- struct {
-			string
+			storage.Link
 			error
-		}{string: "", error: fmt.Errorf("alias not found")}
+		}{Link: storage.Link{}, error: cache.ErrNotFound}
 	}()
 
 	select {
 	case <-ctx.Done():
-		return "", cache.ErrTimeExceeded
+		return storage.Link{}, cache.ErrTimeExceeded
 	case r := <-res:
-		return r.string, r.error
+		return r.Link, r.error
 	}
 }
 
-func (c *Cache) Update(ctx context.Context, username, oldAlias, newAlias string) error {
+func (c *Cache) Delete(ctx context.Context, username, alias string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	done := make(chan struct{})
-	defer close(done)
 
-	key := cache.KeyType{Username: username, Alias: oldAlias}
+	key := cache.KeyType{Username: username, Alias: alias}
 
 	go func() {
-		if value, ok := c.store[key]; ok {
-			delete(c.store, key)
-			newKey := cache.KeyType{Username: username, Alias: newAlias}
-			c.store[newKey] = value
-
-			done <- struct{}{}
-			return
-		}
+		delete(c.store, key)
+		done <- struct{}{}
 	}()
 
 	select {
@@ -137,26 +130,27 @@ func (c *Cache) Update(ctx context.Context, username, oldAlias, newAlias string)
 	case <-done:
 		return nil
 	}
+
 }
 
-func (c *Cache) Delete(ctx context.Context, username, alias string) error {
+func (c *Cache) Flush(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	done := make(chan struct{})
+	c.store = make(map[cache.KeyType]storage.Link)
+	c.frequency = make(map[cache.KeyType]int)
 
-	key := cache.KeyType{Username: username, Alias: alias}
+	return nil
+}
 
-	go func() {
-		delete(c.store, key)
-		done <- struct{}{}
-	}()
+func (c *Cache) Keys(ctx context.Context) ([]cache.KeyType, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	select {
-	case <-ctx.Done():
-		return cache.ErrTimeExceeded
-	case <-done:
-		return nil
+	keys := make([]cache.KeyType, 0, len(c.store))
+	for key := range c.store {
+		keys = append(keys, key)
 	}
 
+	return keys, nil
 }
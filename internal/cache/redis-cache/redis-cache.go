@@ -4,11 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
-	"fmt"
 	"math"
 	"sync"
 	"time"
 	"url-shortener/internal/cache"
+	"url-shortener/internal/storage"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -44,14 +44,14 @@ func (c *Cache) Close(ctx context.Context) error {
 	return c.client.Close()
 }
 
-func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
+func (c *Cache) Set(ctx context.Context, link storage.Link) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	done := make(chan error)
 	defer close(done)
 
-	key := cache.KeyType{Username: username, Alias: alias}
+	key := cache.KeyType{Username: link.Username, Alias: link.Alias}
 
 	go func() {
 		keyData, err := EncodeKey(key)
@@ -59,10 +59,16 @@ func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
 			done <- err
 			return
 		}
+		valueData, err := EncodeValue(link)
+		if err != nil {
+			done <- err
+			return
+		}
+
 		if _, err := c.client.Get(ctx, keyData).Result(); err == nil {
 			c.frequency[key]++
-			if err := c.client.Set(ctx, keyData, cache.ValueType{Url: url}, 0); err != nil {
-				done <- err.Err()
+			if err := c.client.Set(ctx, keyData, valueData, 0).Err(); err != nil {
+				done <- err
 				return
 			}
 
@@ -99,8 +105,8 @@ func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
 			delete(c.frequency, leastUsageKey)
 		}
 
-		if err := c.client.Set(ctx, keyData, cache.ValueType{Url: url}, 0); err != nil {
-			done <- err.Err()
+		if err := c.client.Set(ctx, keyData, valueData, 0).Err(); err != nil {
+			done <- err
 			return
 		}
 		c.frequency[key]++
@@ -116,12 +122,12 @@ func (c *Cache) Set(ctx context.Context, url, alias, username string) error {
 	}
 }
 
-func (c *Cache) Get(ctx context.Context, username, alias string) (string, error) {
+func (c *Cache) Get(ctx context.Context, username, alias string) (storage.Link, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	res := make(chan struct {
-		string
+		storage.Link
 		error
 	})
 	defer close(res)
@@ -132,9 +138,9 @@ func (c *Cache) Get(ctx context.Context, username, alias string) (string, error)
 		keyData, err := EncodeKey(key)
 		if err != nil {
 			res <- struct {
-				string
+				storage.Link
 				error
-			}{"", err}
+			}{storage.Link{}, err}
 			return
 		}
 
@@ -144,60 +150,55 @@ func (c *Cache) Get(ctx context.Context, username, alias string) (string, error)
 			value, err := DecodeValue(string(valueData))
 			if err != nil {
 				res <- struct {
-					string
+					storage.Link
 					error
-				}{"", err}
+				}{storage.Link{}, err}
 				return
 			}
 
 			res <- struct {
-				string
+				storage.Link
 				error
-			}{string: value.Url, error: nil}
+			}{Link: value, error: nil}
 			return
 		}
 
 		res <- struct {
-			string
+			storage.Link
 			error
-		}{string: "", error: fmt.Errorf("alias not found")}
+		}{Link: storage.Link{}, error: cache.ErrNotFound}
 	}()
 
 	select {
 	case <-ctx.Done():
-		return "", cache.ErrTimeExceeded
+		return storage.Link{}, cache.ErrTimeExceeded
 	case r := <-res:
-		return r.string, r.error
+		return r.Link, r.error
 	}
 }
 
-func (c *Cache) Update(ctx context.Context, username, oldAlias, newAlias string) error {
+func (c *Cache) Delete(ctx context.Context, username, alias string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	done := make(chan error)
 	defer close(done)
 
-	oldKey := cache.KeyType{Username: username, Alias: oldAlias}
-	newKey := cache.KeyType{Username: username, Alias: newAlias}
+	key := cache.KeyType{Username: username, Alias: alias}
 
 	go func() {
-		oldKeyData, err := EncodeKey(oldKey)
-		if err != nil {
-			done <- err
-			return
-		}
 
-		newKeyData, err := EncodeKey(newKey)
+		keyData, err := EncodeKey(key)
 		if err != nil {
 			done <- err
 			return
 		}
 
-		if _, err := c.client.Rename(ctx, oldKeyData, newKeyData).Result(); err != nil {
+		if _, err := c.client.Del(ctx, keyData).Result(); err != nil {
 			done <- err
 			return
 		}
+
 		done <- nil
 	}()
 
@@ -209,37 +210,40 @@ func (c *Cache) Update(ctx context.Context, username, oldAlias, newAlias string)
 	}
 }
 
-func (c *Cache) Delete(ctx context.Context, username, alias string) error {
+func (c *Cache) Flush(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	done := make(chan error)
-	defer close(done)
+	if err := c.client.FlushDB(ctx).Err(); err != nil {
+		return err
+	}
 
-	key := cache.KeyType{Username: username, Alias: alias}
+	c.frequency = make(map[cache.KeyType]int)
 
-	go func() {
+	return nil
+}
 
-		keyData, err := EncodeKey(key)
-		if err != nil {
-			done <- err
-			return
-		}
+// Keys returns keys of all entries, keys that are not cache entries are skipped
+func (c *Cache) Keys(ctx context.Context) ([]cache.KeyType, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-		if _, err := c.client.Del(ctx, keyData).Result(); err != nil {
-			done <- err
-			return
-		}
+	keys := make([]cache.KeyType, 0)
 
-		done <- nil
-	}()
+	iter := c.client.Scan(ctx, 0, "", 0).Iterator()
+	for iter.Next(ctx) {
+		key, err := DecodeKey(iter.Val())
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
 
-	select {
-	case <-ctx.Done():
-		return cache.ErrTimeExceeded
-	case err := <-done:
-		return err
+	if err := iter.Err(); err != nil {
+		return nil, err
 	}
+
+	return keys, nil
 }
 
 func EncodeKey(key cache.KeyType) (string, error) {
@@ -254,7 +258,7 @@ func EncodeKey(key cache.KeyType) (string, error) {
 	return buff.String(), nil
 }
 
-func EncodeValue(value cache.ValueType) (string, error) {
+func EncodeValue(value storage.Link) (string, error) {
 	var buff bytes.Buffer
 
 	err := gob.NewEncoder(&buff).Encode(value)
@@ -277,12 +281,12 @@ func DecodeKey(data string) (cache.KeyType, error) {
 	return key, err
 }
 
-func DecodeValue(data string) (cache.ValueType, error) {
+func DecodeValue(data string) (storage.Link, error) {
 
-	var value cache.ValueType
+	var value storage.Link
 	err := gob.NewDecoder(bytes.NewReader([]byte(data))).Decode(&value)
 	if err != nil {
-		return cache.ValueType{}, err
+		return storage.Link{}, err
 	}
 
 	return value, err
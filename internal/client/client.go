@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	httpServer "url-shortener/internal/http-server"
+)
+
+var (
+	ErrUnauthorized = errors.New("invalid credentials")
+)
+
+// APIError is an error returned by the shortener API in the response body
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (http %d)", e.Message, e.StatusCode)
+}
+
+type Link struct {
+	Alias    string `json:"alias"`
+	Url      string `json:"url"`
+	ShortUrl string `json:"short_url"`
+}
+
+type response struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+	NewAlias string `json:"new_alias,omitempty"`
+	Links    []Link `json:"links,omitempty"`
+}
+
+// Client is a client of the shortener HTTP API
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+func New(baseURL, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/") + "/",
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Create shortens {url}, the alias is generated by the server if it is empty.
+// It returns the short url
+func (c *Client) Create(ctx context.Context, url, alias string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, map[string]string{"url": url, "alias": alias})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Alias, nil
+}
+
+// Rename replaces {alias} with {newAlias}, the new alias is generated by the server if it is empty.
+// It returns the new short url
+func (c *Client) Rename(ctx context.Context, alias, newAlias string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPut, map[string]string{"alias": alias, "new_alias": newAlias})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.NewAlias, nil
+}
+
+func (c *Client) Delete(ctx context.Context, alias string) error {
+	_, err := c.do(ctx, http.MethodDelete, map[string]string{"alias": alias})
+	return err
+}
+
+func (c *Client) List(ctx context.Context) ([]Link, error) {
+	resp, err := c.do(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Links, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, body any) (*response, error) {
+	const op = "client.do"
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+
+	if httpResp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%s: failed to decode response with http status %d: %w", op, httpResp.StatusCode, err)
+	}
+
+	if resp.Status != httpServer.StatusOK {
+		return nil, &APIError{StatusCode: httpResp.StatusCode, Message: resp.Error}
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Requests(t *testing.T) {
+	var (
+		method string
+		body   map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, body = r.Method, nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		assert.Equal(t, "/", r.URL.Path)
+		username, password, _ := r.BasicAuth()
+		assert.Equal(t, "pasha", username)
+		assert.Equal(t, "1234", password)
+
+		_, _ = w.Write([]byte(`{"status":"OK","alias":"short","new_alias":"renamed","links":[{"alias":"go","url":"https://go.dev"}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "pasha", "1234", time.Second)
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		call           func() (any, error)
+		expectedMethod string
+		expectedBody   map[string]string
+		expected       any
+	}{
+		{
+			name:           "create",
+			call:           func() (any, error) { return c.Create(ctx, "https://go.dev", "go") },
+			expectedMethod: http.MethodPost,
+			expectedBody:   map[string]string{"url": "https://go.dev", "alias": "go"},
+			expected:       "short",
+		},
+		{
+			name:           "rename",
+			call:           func() (any, error) { return c.Rename(ctx, "go", "golang") },
+			expectedMethod: http.MethodPut,
+			expectedBody:   map[string]string{"alias": "go", "new_alias": "golang"},
+			expected:       "renamed",
+		},
+		{
+			name:           "delete",
+			call:           func() (any, error) { return nil, c.Delete(ctx, "go") },
+			expectedMethod: http.MethodDelete,
+			expectedBody:   map[string]string{"alias": "go"},
+		},
+		{
+			name:           "list",
+			call:           func() (any, error) { return c.List(ctx) },
+			expectedMethod: http.MethodGet,
+			expected:       []Link{{Alias: "go", Url: "https://go.dev"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMethod, method)
+			assert.Equal(t, tt.expectedBody, body)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        int
+		body        string
+		expectedErr error
+	}{
+		{name: "unauthorized", code: http.StatusUnauthorized, expectedErr: ErrUnauthorized},
+		{
+			name:        "api error",
+			code:        http.StatusConflict,
+			body:        `{"status":"Error","error":"alias already exist"}`,
+			expectedErr: &APIError{StatusCode: http.StatusConflict, Message: "alias already exist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := New(srv.URL+"/", "pasha", "1234", time.Second).Create(context.Background(), "https://go.dev", "go")
+			assert.Equal(t, tt.expectedErr, err)
+		})
+	}
+}
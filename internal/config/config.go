@@ -10,20 +10,32 @@ import (
 type Config struct {
 	Env         string               `yaml:"env"`
 	DBConfig    MongoDBStorageConfig `yaml:"storage_config"`
+	SqliteDB    SqliteStorageConfig  `yaml:"sqlite_storage_config"`
 	CacheConfig RedisCacheConfig     `yaml:"cache_config"`
 	HttpServer  HttpServerConfig     `yaml:"http_server"`
+	GRPCServer  GRPCServerConfig     `yaml:"grpc_server"`
+	Redirect    RedirectConfig       `yaml:"redirect"`
+	GeoIP       GeoIPConfig          `yaml:"geoip"`
+	URLCheck    URLCheckConfig       `yaml:"url_check"`
+	Trash       TrashConfig          `yaml:"trash"`
+	Accounts    map[string]string    `yaml:"accounts"`
+	// Admins are usernames allowed to query the audit log
+	Admins []string `yaml:"admins"`
 }
 
 type SqliteStorageConfig struct {
-	StoragePath string        `yaml:"storage_path"`
-	Timeout     time.Duration `yaml:"timeout"`
+	StoragePath string        `yaml:"storage_path" env-default:"./storage/data.db"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
 }
 
 type MongoDBStorageConfig struct {
-	ConnectionString string        `yaml:"connection_string"`
-	DBName           string        `yaml:"db_name"`
-	CollectionName   string        `yaml:"collection_name"`
-	Timeout          time.Duration `yaml:"timeout"`
+	ConnectionString    string        `yaml:"connection_string"`
+	DBName              string        `yaml:"db_name"`
+	CollectionName      string        `yaml:"collection_name"`
+	UsersCollectionName string        `yaml:"users_collection_name" env-default:"users"`
+	TrashCollectionName string        `yaml:"trash_collection_name" env-default:"trash"`
+	AuditCollectionName string        `yaml:"audit_collection_name" env-default:"audit"`
+	Timeout             time.Duration `yaml:"timeout"`
 }
 
 type MapCacheConfig struct {
@@ -41,6 +53,55 @@ type HttpServerConfig struct {
 	Port        string        `yaml:"port"`
 	Timeout     time.Duration `yaml:"timeout"`
 	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// TrustedProxies are addresses or CIDRs whose X-Forwarded-For is honored, none by default
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type GRPCServerConfig struct {
+	Port string `yaml:"port"`
+}
+
+type RedirectConfig struct {
+	// CookieSecret signs cookies of unlocked password-protected links and of A/B variants,
+	// a random one is used if it is empty, so cookies do not survive a restart
+	CookieSecret      string        `yaml:"cookie_secret" env:"REDIRECT_COOKIE_SECRET"`
+	PasswordCookieTTL time.Duration `yaml:"password_cookie_ttl" env-default:"24h"`
+	// VariantCookieTTL is how long a visitor of an A/B split link keeps the same variant
+	VariantCookieTTL time.Duration `yaml:"variant_cookie_ttl" env-default:"720h"`
+	// InactiveFallbackURL is where links outside their activation window redirect,
+	// a "coming soon" response is served if it is empty
+	InactiveFallbackURL string `yaml:"inactive_fallback_url"`
+	// PermanentMaxAge is how long browsers and CDNs may cache permanent redirects without own Cache-Control
+	PermanentMaxAge time.Duration `yaml:"permanent_max_age" env-default:"24h"`
+	// DisabledPagePath is an html/template file shown to browsers opening a disabled link,
+	// executed with .Status and .Reason. A built-in page is shown if it is empty
+	DisabledPagePath string `yaml:"disabled_page_path"`
+}
+
+type GeoIPConfig struct {
+	// DatabasePath is a MaxMind DB file with countries, geo routing of links is disabled if it is empty
+	DatabasePath string `yaml:"database_path" env:"GEOIP_DATABASE_PATH"`
+}
+
+type TrashConfig struct {
+	// Retention is how long deleted links can be restored, zero deletes links permanently
+	Retention time.Duration `yaml:"retention" env-default:"720h"`
+	// CleanupInterval is how often links whose retention has passed are deleted from the trash,
+	// zero disables the cleanup
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1h"`
+}
+
+type URLCheckConfig struct {
+	// BlocklistPath is a file with blocked domains and url patterns, one per line, empty means no blocklist.
+	// Non-http(s) urls and urls pointing to private networks are rejected anyway
+	BlocklistPath string `yaml:"blocklist_path" env:"URL_BLOCKLIST_PATH"`
+	// ReloadInterval is how often the blocklist file is checked for changes, zero disables reloading
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"30s"`
+	// ResolveHosts rejects host names resolving to private networks, at the cost of a DNS lookup per url
+	ResolveHosts bool `yaml:"resolve_hosts"`
+	// DisableExisting disables existing links matching the blocklist once it is loaded on start,
+	// and matching rules added to it while running
+	DisableExisting bool `yaml:"disable_existing"`
 }
 
 func MustLoad() *Config {
@@ -0,0 +1,112 @@
+package grpcServer
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"url-shortener/gen/go/shortener"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/lib/requestid"
+	"url-shortener/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type usernameKey struct{}
+
+// publicMethods can be called without credentials
+var publicMethods = map[string]bool{
+	shortener.Shortener_Resolve_FullMethodName: true,
+}
+
+// AuthInterceptor checks basic auth credentials from the "authorization" metadata
+// and puts the username into the context, along with the service.Caller for the audit log
+func AuthInterceptor(a auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		username, password, ok := basicAuth(ctx)
+		if !ok || a.Authenticate(ctx, username, password) != nil {
+			return nil, status.Error(codes.Unauthenticated, auth.ErrInvalidCredentials.Error())
+		}
+
+		ctx = context.WithValue(ctx, usernameKey{}, username)
+		ctx = service.WithCaller(ctx, service.Caller{
+			Username:  username,
+			IP:        peerIP(ctx),
+			RequestID: requestID(ctx),
+		})
+
+		return handler(ctx, req)
+	}
+}
+
+// requestID takes the request id from the "x-request-id" metadata or generates one,
+// and returns it in the same header metadata of the response
+func requestID(ctx context.Context) string {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			id = values[0]
+		}
+	}
+
+	id = requestid.Take(id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return id
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	return username
+}
+
+func basicAuth(ctx context.Context) (string, string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", "", false
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", "", false
+	}
+
+	const prefix = "Basic "
+	if len(values[0]) < len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(values[0][len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	return username, password, true
+}
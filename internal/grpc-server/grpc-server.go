@@ -0,0 +1,437 @@
+package grpcServer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"url-shortener/gen/go/shortener"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type serverAPI struct {
+	shortener.UnimplementedShortenerServer
+	log *slog.Logger
+	svc *service.Shortener
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, svc *service.Shortener) {
+	shortener.RegisterShortenerServer(gRPC, &serverAPI{log: log, svc: svc})
+}
+
+func (s *serverAPI) Create(ctx context.Context, req *shortener.CreateRequest) (*shortener.CreateResponse, error) {
+	const op = "grpc-server.Create"
+
+	username := UsernameFromContext(ctx)
+
+	alias, err := s.svc.Save(ctx, service.NewLink{
+		Username:         username,
+		Url:              req.GetUrl(),
+		Alias:            req.GetAlias(),
+		Password:         req.GetPassword(),
+		MaxClicks:        req.GetMaxClicks(),
+		NotBefore:        fromTimestamp(req.GetNotBefore()),
+		NotAfter:         fromTimestamp(req.GetNotAfter()),
+		RedirectCode:     int(req.GetRedirectCode()),
+		CacheControl:     req.GetCacheControl(),
+		QueryPassthrough: req.GetQueryPassthrough(),
+		PathPassthrough:  req.GetPathPassthrough(),
+		UTM:              fromUTM(req.GetUtm()),
+		Routes:           req.GetRoutes(),
+		Countries:        req.GetCountries(),
+		Variants:         fromVariants(req.GetVariants()),
+		Tags:             req.GetTags(),
+		Folder:           req.GetFolder(),
+		Metadata: service.Metadata{
+			Title:       req.GetTitle(),
+			Description: req.GetDescription(),
+			Notes:       req.GetNotes(),
+		},
+	})
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.CreateResponse{
+		Alias:    alias,
+		ShortUrl: httpServer.Path + username + "/" + alias,
+	}, nil
+}
+
+func (s *serverAPI) Resolve(ctx context.Context, req *shortener.ResolveRequest) (*shortener.ResolveResponse, error) {
+	const op = "grpc-server.Resolve"
+
+	link, err := s.svc.Resolve(ctx, req.GetUsername(), req.GetAlias())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	if err := s.svc.CheckPassword(link, req.GetPassword()); err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	// the url is picked as for HTTP visitors: platform routes win over country rules,
+	// and both win over A/B variants, which split the fallback traffic only
+	target, variant := link, -1
+	if url, ok := service.Route(link, req.GetUserAgent()); ok && req.GetUserAgent() != "" {
+		target.Url = url
+	} else if url, ok := service.RouteCountry(link, req.GetCountry()); ok {
+		target.Url = url
+	} else if variant = s.svc.PickVariant(link, req.GetVariant()); variant >= 0 {
+		target.Url = link.Variants[variant].Url
+	}
+
+	destination, err := s.svc.Destination(ctx, target, req.GetPath(), req.GetQuery())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	link, err = s.svc.Visit(ctx, link)
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	if variant >= 0 {
+		if err := s.svc.CountVariant(ctx, link, variant); err != nil {
+			s.log.Error(err.Error(), slog.String("op", op))
+		}
+	}
+
+	return &shortener.ResolveResponse{Url: destination}, nil
+}
+
+func (s *serverAPI) Delete(ctx context.Context, req *shortener.DeleteRequest) (*shortener.DeleteResponse, error) {
+	const op = "grpc-server.Delete"
+
+	if err := s.svc.Delete(ctx, UsernameFromContext(ctx), req.GetAlias()); err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.DeleteResponse{}, nil
+}
+
+func (s *serverAPI) RenameAlias(ctx context.Context, req *shortener.RenameAliasRequest) (*shortener.RenameAliasResponse, error) {
+	const op = "grpc-server.RenameAlias"
+
+	username := UsernameFromContext(ctx)
+
+	newAlias, err := s.svc.Rename(ctx, username, req.GetAlias(), req.GetNewAlias())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.RenameAliasResponse{
+		NewAlias: newAlias,
+		ShortUrl: httpServer.Path + username + "/" + newAlias,
+	}, nil
+}
+
+func (s *serverAPI) EditLink(ctx context.Context, req *shortener.EditLinkRequest) (*shortener.EditLinkResponse, error) {
+	const op = "grpc-server.EditLink"
+
+	var patch storage.LinkPatch
+	patch.Url = req.Url
+	patch.Disabled = req.Disabled
+	patch.DisabledReason = req.DisabledReason
+	if req.RedirectCode != nil {
+		code := int(req.GetRedirectCode())
+		patch.RedirectCode = &code
+	}
+	patch.CacheControl = req.CacheControl
+	patch.QueryPassthrough = req.QueryPassthrough
+	patch.PathPassthrough = req.PathPassthrough
+	if req.Utm != nil {
+		utm := fromUTM(req.GetUtm())
+		patch.UTM = &utm
+	}
+	if req.Variants != nil {
+		patch.Variants = fromVariants(req.GetVariants().GetItems())
+		if patch.Variants == nil {
+			patch.Variants = []storage.Variant{}
+		}
+	}
+	if req.Countries != nil {
+		patch.Countries = req.GetCountries().GetTargets()
+		if patch.Countries == nil {
+			patch.Countries = map[string]string{}
+		}
+	}
+	if req.Routes != nil {
+		patch.Routes = req.GetRoutes().GetTargets()
+		if patch.Routes == nil {
+			patch.Routes = map[string]string{}
+		}
+	}
+	if req.Tags != nil {
+		patch.Tags = req.GetTags().GetItems()
+		if patch.Tags == nil {
+			patch.Tags = []string{}
+		}
+	}
+	patch.Folder = req.Folder
+	patch.Title = req.Title
+	patch.Description = req.Description
+	patch.Notes = req.Notes
+
+	link, err := s.svc.Edit(ctx, UsernameFromContext(ctx), req.GetAlias(), patch)
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.EditLinkResponse{Link: toLink(link)}, nil
+}
+
+func (s *serverAPI) List(ctx context.Context, req *shortener.ListRequest) (*shortener.ListResponse, error) {
+	const op = "grpc-server.List"
+
+	links, err := s.svc.List(ctx, UsernameFromContext(ctx), storage.LinkFilter{Tags: req.GetTags(), Folder: req.GetFolder()})
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	resp := &shortener.ListResponse{Links: make([]*shortener.Link, 0, len(links))}
+	for _, l := range links {
+		resp.Links = append(resp.Links, toLink(l))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListTrash(ctx context.Context, _ *shortener.ListTrashRequest) (*shortener.ListTrashResponse, error) {
+	const op = "grpc-server.ListTrash"
+
+	links, err := s.svc.ListTrash(ctx, UsernameFromContext(ctx))
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	resp := &shortener.ListTrashResponse{Links: make([]*shortener.TrashedLink, 0, len(links))}
+	for _, l := range links {
+		resp.Links = append(resp.Links, &shortener.TrashedLink{
+			Link:      toLink(l.Link),
+			DeletedAt: timestamppb.New(l.DeletedAt),
+			ExpiresAt: timestamppb.New(l.ExpiresAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) Restore(ctx context.Context, req *shortener.RestoreRequest) (*shortener.RestoreResponse, error) {
+	const op = "grpc-server.Restore"
+
+	link, err := s.svc.Restore(ctx, UsernameFromContext(ctx), req.GetAlias())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.RestoreResponse{Link: toLink(link)}, nil
+}
+
+func (s *serverAPI) Purge(ctx context.Context, req *shortener.PurgeRequest) (*shortener.PurgeResponse, error) {
+	const op = "grpc-server.Purge"
+
+	if err := s.svc.Purge(ctx, UsernameFromContext(ctx), req.GetAlias()); err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.PurgeResponse{}, nil
+}
+
+func (s *serverAPI) History(ctx context.Context, req *shortener.HistoryRequest) (*shortener.HistoryResponse, error) {
+	const op = "grpc-server.History"
+
+	versions, err := s.svc.History(ctx, UsernameFromContext(ctx), req.GetAlias())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	resp := &shortener.HistoryResponse{Versions: make([]*shortener.LinkVersion, 0, len(versions))}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, &shortener.LinkVersion{
+			Version:   int32(v.Version),
+			Alias:     v.Alias,
+			Url:       v.Url,
+			ChangedBy: v.ChangedBy,
+			ChangedAt: timestamppb.New(v.ChangedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) Rollback(ctx context.Context, req *shortener.RollbackRequest) (*shortener.RollbackResponse, error) {
+	const op = "grpc-server.Rollback"
+
+	link, err := s.svc.Rollback(ctx, UsernameFromContext(ctx), req.GetAlias(), int(req.GetVersion()))
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.RollbackResponse{Link: toLink(link)}, nil
+}
+
+func (s *serverAPI) Info(ctx context.Context, req *shortener.InfoRequest) (*shortener.InfoResponse, error) {
+	const op = "grpc-server.Info"
+
+	link, err := s.svc.Info(ctx, UsernameFromContext(ctx), req.GetAlias())
+	if err != nil {
+		return nil, s.toStatus(op, err)
+	}
+
+	return &shortener.InfoResponse{Link: toLink(link)}, nil
+}
+
+// toStatus maps service errors to gRPC statuses
+func (s *serverAPI) toStatus(op string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAliasNotFound):
+		return status.Error(codes.NotFound, httpServer.AliasNotFound)
+	case errors.Is(err, service.ErrVersionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrAliasAlreadyExist):
+		return status.Error(codes.AlreadyExists, httpServer.AliasAlreadyExist)
+	case errors.Is(err, service.ErrNewAliasAlreadyExists):
+		return status.Error(codes.AlreadyExists, httpServer.NewAliasAlreadyExists)
+	case errors.Is(err, service.ErrInvalidURL),
+		errors.Is(err, service.ErrInvalidMaxClicks),
+		errors.Is(err, service.ErrInvalidWindow),
+		errors.Is(err, service.ErrInvalidRedirectCode),
+		errors.Is(err, service.ErrInvalidCacheControl),
+		errors.Is(err, service.ErrInvalidQueryMode),
+		errors.Is(err, service.ErrInvalidRoutes),
+		errors.Is(err, service.ErrInvalidCountries),
+		errors.Is(err, service.ErrInvalidVariants),
+		errors.Is(err, service.ErrInvalidTags),
+		errors.Is(err, service.ErrInvalidFolder),
+		errors.Is(err, service.ErrInvalidTitle),
+		errors.Is(err, service.ErrInvalidDescription),
+		errors.Is(err, service.ErrInvalidNotes),
+		errors.Is(err, service.ErrInvalidAlias),
+		errors.Is(err, service.ErrUnsafeURL),
+		errors.Is(err, service.ErrPathNotAllowed),
+		errors.Is(err, service.ErrInvalidPath),
+		errors.Is(err, service.ErrDisabledReasonTooLong),
+		errors.Is(err, service.ErrEmptyAlias),
+		errors.Is(err, service.ErrEmptyUsername):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrPasswordRequired):
+		return status.Error(codes.Unauthenticated, httpServer.PasswordRequired)
+	case errors.Is(err, service.ErrWrongPassword):
+		return status.Error(codes.PermissionDenied, httpServer.WrongPassword)
+	case errors.Is(err, service.ErrLinkNotActive):
+		return status.Error(codes.FailedPrecondition, httpServer.LinkNotActive)
+	case errors.Is(err, service.ErrLinkExpired):
+		return status.Error(codes.FailedPrecondition, httpServer.LinkExpired)
+	case errors.Is(err, service.ErrDisabledByAdmin):
+		return status.Error(codes.PermissionDenied, httpServer.DisabledByAdmin)
+	case errors.Is(err, service.ErrDisabledAsUnsafe):
+		return status.Error(codes.PermissionDenied, httpServer.DisabledAsUnsafe)
+	case errors.Is(err, service.ErrLinkDisabled):
+		return status.Error(codes.FailedPrecondition, httpServer.LinkDisabled)
+	case errors.Is(err, service.ErrLinkExhausted):
+		return status.Error(codes.ResourceExhausted, httpServer.LinkExhausted)
+	}
+
+	s.log.Error(err.Error(), slog.String("op", op))
+	return status.Error(codes.Internal, httpServer.InternalError)
+}
+
+func toLink(l storage.Link) *shortener.Link {
+	return &shortener.Link{
+		Username:         l.Username,
+		Alias:            l.Alias,
+		Url:              l.Url,
+		ShortUrl:         httpServer.Path + l.Username + "/" + l.Alias,
+		MaxClicks:        l.MaxClicks,
+		RemainingClicks:  l.RemainingClicks,
+		NotBefore:        toTimestamp(l.NotBefore),
+		NotAfter:         toTimestamp(l.NotAfter),
+		RedirectCode:     int32(l.RedirectCode),
+		CacheControl:     l.CacheControl,
+		QueryPassthrough: l.QueryPassthrough,
+		PathPassthrough:  l.PathPassthrough,
+		Utm:              toUTM(l.UTM),
+		Routes:           l.Routes,
+		Countries:        l.Countries,
+		Variants:         toVariants(l.Variants),
+		CreatedAt:        toTimestamp(l.CreatedAt),
+		Clicks:           l.Clicks,
+		Disabled:         l.Disabled,
+		DisabledBy:       l.DisabledBy,
+		DisabledReason:   l.DisabledReason,
+		Tags:             l.Tags,
+		Folder:           l.Folder,
+		UpdatedAt:        toTimestamp(l.UpdatedAt),
+		Title:            l.Title,
+		Description:      l.Description,
+		Notes:            l.Notes,
+	}
+}
+
+func fromVariants(variants []*shortener.Variant) []storage.Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	res := make([]storage.Variant, 0, len(variants))
+	for _, v := range variants {
+		res = append(res, storage.Variant{Url: v.GetUrl(), Weight: int(v.GetWeight())})
+	}
+
+	return res
+}
+
+func toVariants(variants []storage.Variant) []*shortener.Variant {
+	res := make([]*shortener.Variant, 0, len(variants))
+	for _, v := range variants {
+		res = append(res, &shortener.Variant{Url: v.Url, Weight: int32(v.Weight), Clicks: v.Clicks})
+	}
+
+	return res
+}
+
+func fromUTM(u *shortener.UTM) storage.UTM {
+	return storage.UTM{
+		Source:   u.GetSource(),
+		Medium:   u.GetMedium(),
+		Campaign: u.GetCampaign(),
+		Term:     u.GetTerm(),
+		Content:  u.GetContent(),
+	}
+}
+
+func toUTM(u storage.UTM) *shortener.UTM {
+	if u.IsZero() {
+		return nil
+	}
+	return &shortener.UTM{
+		Source:   u.Source,
+		Medium:   u.Medium,
+		Campaign: u.Campaign,
+		Term:     u.Term,
+		Content:  u.Content,
+	}
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+)
+
+// Request is read from the query, empty filters match any event
+type Request struct {
+	Actor    string `form:"actor"`
+	Action   string `form:"action"`
+	Username string `form:"username"`
+	Alias    string `form:"alias"`
+	// Since and Until bound the time of events, in RFC 3339
+	Since time.Time `form:"since"`
+	Until time.Time `form:"until"`
+	// Cursor is NextCursor of the previous page
+	Cursor string `form:"cursor"`
+	// Limit is the page size, ignored by the jsonl export which returns all events
+	Limit int `form:"limit"`
+	// Format is json or jsonl, json by default
+	Format string `form:"format"`
+}
+
+type Response struct {
+	Status string               `json:"status"`
+	Error  string               `json:"error,omitempty"`
+	Events []storage.AuditEvent `json:"events,omitempty"`
+	// NextCursor requests the next page, it is empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func SetEvents(events []storage.AuditEvent, nextCursor string) Decorator {
+	return func(response *Response) {
+		response.Events = events
+		response.NextCursor = nextCursor
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+// Events returns audit events newest first, a page of them as json or all of them as json lines.
+// It expects basic auth and admin checks before it
+func Events(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.audit.Events"
+
+		var req Request
+		if err := c.ShouldBindQuery(&req); err != nil || (req.Format != "" && req.Format != FormatJSON && req.Format != FormatJSONL) {
+			log.Info("failed to decode request", slog.Any("error", err), slog.String("op", op))
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.BadRequest),
+				),
+			)
+			return
+		}
+
+		filter := storage.AuditFilter{
+			Actor:    req.Actor,
+			Action:   req.Action,
+			Username: req.Username,
+			Alias:    req.Alias,
+			Since:    req.Since,
+			Until:    req.Until,
+			Cursor:   req.Cursor,
+			Limit:    req.Limit,
+		}
+
+		log.Debug(
+			"try to handle audit request",
+			slog.String("admin", c.GetString("username")),
+			slog.Any("filter", filter),
+			slog.String("op", op),
+		)
+
+		if req.Format == FormatJSONL {
+			export(c, log, svc, filter)
+			return
+		}
+
+		events, err := svc.AuditEvents(c, filter)
+		if err != nil {
+			fail(c, log, op, err)
+			return
+		}
+
+		var next string
+		if len(events) > 0 && len(events) == limit(filter) {
+			next = events[len(events)-1].ID
+		}
+
+		log.Info(
+			"success handle audit",
+			slog.String("admin", c.GetString("username")),
+			slog.Int("count", len(events)),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetEvents(events, next),
+			),
+		)
+	}
+}
+
+// export streams all events matching {filter} page by page, one json object per line
+func export(c *gin.Context, log *slog.Logger, svc *service.Shortener, filter storage.AuditFilter) {
+	const op = "http-server.audit.export"
+
+	filter.Limit = service.MaxAuditLimit
+
+	// the first page is read before writing, so a bad filter still gets a json error
+	events, err := svc.AuditEvents(c, filter)
+	if err != nil {
+		fail(c, log, op, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	count := 0
+	for {
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				log.Error(fmt.Sprintf("%s: %s", "failed to write event", err.Error()), slog.String("op", op))
+				return
+			}
+		}
+		count += len(events)
+
+		if len(events) < filter.Limit {
+			break
+		}
+
+		c.Writer.Flush()
+		filter.Cursor = events[len(events)-1].ID
+		if events, err = svc.AuditEvents(c, filter); err != nil {
+			// the status is sent already, the export is cut short
+			log.Error(err.Error(), slog.String("op", op))
+			return
+		}
+	}
+
+	log.Info(
+		"success export audit",
+		slog.String("admin", c.GetString("username")),
+		slog.Int("count", count),
+		slog.String("op", op),
+	)
+}
+
+func limit(filter storage.AuditFilter) int {
+	if filter.Limit == 0 {
+		return service.DefaultAuditLimit
+	}
+	return filter.Limit
+}
+
+func fail(c *gin.Context, log *slog.Logger, op string, err error) {
+	if errors.Is(err, service.ErrInvalidAuditLimit) || errors.Is(err, service.ErrInvalidCursor) {
+		log.Info(err.Error(), slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(err.Error()),
+			),
+		)
+		return
+	}
+
+	log.Error(err.Error(), slog.String("op", op))
+	c.JSON(
+		http.StatusInternalServerError,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(httpServer.InternalError),
+		),
+	)
+}
@@ -6,7 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	httpServer "url-shortener/internal/http-server"
-	"url-shortener/internal/storage"
+	"url-shortener/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -44,7 +44,7 @@ func NewResponse(decorators ...Decorator) Response {
 	return resp
 }
 
-func Delete(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
+func Delete(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "http-server.Delete"
 
@@ -73,23 +73,25 @@ func Delete(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			slog.String("op", op),
 		)
 
-		if err := s.DeleteURL(c, username, req.Alias); err != nil {
-			if errors.Is(err, storage.ErrCacheDelete) {
-				// failed to delete alias from cache
-				log.Error(err.Error(), slog.String("op", op))
+		if err := svc.Delete(c, username, req.Alias); err != nil {
+			if errors.Is(err, service.ErrAliasNotFound) {
+				log.Info("alias not found", slog.String("op", op))
 				c.JSON(
 					http.StatusBadRequest,
-					NewResponse(SetStatus(httpServer.StatusOK)),
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
+					),
 				)
 				return
 			}
-			if errors.Is(err, storage.ErrAliasNotFound) {
-				log.Info("alias not found", slog.String("op", op))
+			if errors.Is(err, service.ErrEmptyAlias) || errors.Is(err, service.ErrEmptyUsername) {
+				log.Error(err.Error(), slog.String("op", op))
 				c.JSON(
 					http.StatusBadRequest,
 					NewResponse(
 						SetStatus(httpServer.StatusError),
-						SetError(httpServer.AliasNotFound),
+						SetError(httpServer.BadRequest),
 					),
 				)
 				return
@@ -0,0 +1,269 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request lists link settings to change, omitted fields are left as they are
+type Request struct {
+	Alias string `json:"alias"`
+	// Url changes where the link leads to, it is checked for safety as on save
+	Url              *string `json:"url,omitempty"`
+	RedirectCode     *int    `json:"redirect_code,omitempty"`
+	CacheControl     *string `json:"cache_control,omitempty"`
+	QueryPassthrough *string `json:"query_passthrough,omitempty"`
+	PathPassthrough  *bool   `json:"path_passthrough,omitempty"`
+	// UTM replaces all UTM parameters of the link
+	UTM *storage.UTM `json:"utm,omitempty"`
+	// Routes replaces all routes of the link, an empty object removes them
+	Routes map[string]string `json:"routes,omitempty"`
+	// Countries replaces all country rules of the link, an empty object removes them
+	Countries map[string]string `json:"countries,omitempty"`
+	// Variants replaces all variants of the link resetting their clicks, an empty array removes them
+	Variants []storage.Variant `json:"variants,omitempty"`
+	// Tags replaces all tags of the link, an empty array removes them
+	Tags []string `json:"tags,omitempty"`
+	// Folder moves the link to another folder, an empty string takes it out of its folder
+	Folder *string `json:"folder,omitempty"`
+	// Title, Description and Notes replace the metadata of the link, an empty string removes it
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+	// Disabled stops the link from redirecting while keeping its alias, DisabledReason is shown to visitors.
+	// Links disabled by admins cannot be enabled by their owners
+	Disabled       *bool   `json:"disabled,omitempty"`
+	DisabledReason *string `json:"disabled_reason,omitempty"`
+}
+
+type Link struct {
+	Alias            string            `json:"alias"`
+	Url              string            `json:"url"`
+	ShortUrl         string            `json:"short_url"`
+	RedirectCode     int               `json:"redirect_code,omitempty"`
+	CacheControl     string            `json:"cache_control,omitempty"`
+	QueryPassthrough string            `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool              `json:"path_passthrough,omitempty"`
+	UTM              *storage.UTM      `json:"utm,omitempty"`
+	Routes           map[string]string `json:"routes,omitempty"`
+	Countries        map[string]string `json:"countries,omitempty"`
+	Variants         []storage.Variant `json:"variants,omitempty"`
+	Disabled         bool              `json:"disabled,omitempty"`
+	DisabledBy       string            `json:"disabled_by,omitempty"`
+	DisabledReason   string            `json:"disabled_reason,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Folder           string            `json:"folder,omitempty"`
+	Title            string            `json:"title,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Notes            string            `json:"notes,omitempty"`
+	UpdatedAt        *time.Time        `json:"updated_at,omitempty"`
+}
+
+type Response struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Link   *Link  `json:"link,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func SetLink(link Link) Decorator {
+	return func(response *Response) {
+		response.Link = &link
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+func Edit(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.Edit"
+
+		var req Request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to decode request", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.BadRequest),
+				),
+			)
+			return
+		}
+
+		username := c.GetString("username")
+
+		log.Debug(
+			"try to handle edit request",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+
+		link, err := svc.Edit(c, username, req.Alias, storage.LinkPatch{
+			Url:              req.Url,
+			RedirectCode:     req.RedirectCode,
+			CacheControl:     req.CacheControl,
+			QueryPassthrough: req.QueryPassthrough,
+			PathPassthrough:  req.PathPassthrough,
+			UTM:              req.UTM,
+			Routes:           req.Routes,
+			Countries:        req.Countries,
+			Variants:         req.Variants,
+			Tags:             req.Tags,
+			Folder:           req.Folder,
+			Title:            req.Title,
+			Description:      req.Description,
+			Notes:            req.Notes,
+			Disabled:         req.Disabled,
+			DisabledReason:   req.DisabledReason,
+		})
+		if err != nil {
+			if errors.Is(err, service.ErrAliasNotFound) {
+				log.Info("alias not found", slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidURL) ||
+				errors.Is(err, service.ErrUnsafeURL) ||
+				errors.Is(err, service.ErrInvalidRedirectCode) ||
+				errors.Is(err, service.ErrInvalidCacheControl) ||
+				errors.Is(err, service.ErrInvalidQueryMode) ||
+				errors.Is(err, service.ErrInvalidRoutes) ||
+				errors.Is(err, service.ErrInvalidCountries) ||
+				errors.Is(err, service.ErrInvalidVariants) ||
+				errors.Is(err, service.ErrInvalidTags) ||
+				errors.Is(err, service.ErrInvalidFolder) ||
+				errors.Is(err, service.ErrInvalidTitle) ||
+				errors.Is(err, service.ErrInvalidDescription) ||
+				errors.Is(err, service.ErrInvalidNotes) ||
+				errors.Is(err, service.ErrDisabledReasonTooLong) {
+				log.Info(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(err.Error()),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrDisabledByAdmin) || errors.Is(err, service.ErrDisabledAsUnsafe) {
+				msg := httpServer.DisabledByAdmin
+				if errors.Is(err, service.ErrDisabledAsUnsafe) {
+					msg = httpServer.DisabledAsUnsafe
+				}
+
+				log.Info(err.Error(), slog.String("alias", req.Alias), slog.String("op", op))
+				c.JSON(
+					http.StatusForbidden,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(msg),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrEmptyAlias) || errors.Is(err, service.ErrEmptyUsername) {
+				log.Error(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.BadRequest),
+					),
+				)
+				return
+			}
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to edit link", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		log.Info(
+			"success handle edit link",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+		resp := Link{
+			Alias:            link.Alias,
+			Url:              link.Url,
+			ShortUrl:         httpServer.Path + username + "/" + link.Alias,
+			RedirectCode:     link.RedirectCode,
+			CacheControl:     link.CacheControl,
+			QueryPassthrough: link.QueryPassthrough,
+			PathPassthrough:  link.PathPassthrough,
+			Routes:           link.Routes,
+			Countries:        link.Countries,
+			Variants:         link.Variants,
+			Disabled:         link.Disabled,
+			DisabledBy:       link.DisabledBy,
+			DisabledReason:   link.DisabledReason,
+			Tags:             link.Tags,
+			Folder:           link.Folder,
+			Title:            link.Title,
+			Description:      link.Description,
+			Notes:            link.Notes,
+			UpdatedAt:        link.UpdatedAt,
+		}
+		if !link.UTM.IsZero() {
+			resp.UTM = &link.UTM
+		}
+
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetLink(resp),
+			),
+		)
+	}
+}
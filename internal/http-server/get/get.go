@@ -1,11 +1,22 @@
 package get
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
 	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/lib/signature"
+	"url-shortener/internal/service"
 	"url-shortener/internal/storage"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +26,7 @@ type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 	Url    string `json:"url,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }
 
 type Decorator func(response *Response)
@@ -31,6 +43,12 @@ func SetError(err string) Decorator {
 	}
 }
 
+func SetReason(reason string) Decorator {
+	return func(response *Response) {
+		response.Reason = reason
+	}
+}
+
 func NewResponse(decorators ...Decorator) Response {
 	var resp Response
 
@@ -41,46 +59,310 @@ func NewResponse(decorators ...Decorator) Response {
 	return resp
 }
 
-func Get(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
+const (
+	// PasswordHeader carries the link password for API clients
+	PasswordHeader = "X-Link-Password"
+	// PasswordField is the form field of the password page
+	PasswordField = "password"
+
+	// PreviewParam set to 1 opens the preview page, set to 0 it skips the preview forced by the owner.
+	// It is not passed through to the url
+	PreviewParam = "preview"
+
+	accessCookie  = "link_access"
+	variantCookie = "link_variant"
+)
+
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Protected link</title></head>
+<body>
+<form method="post">
+	<p>This link is protected with password.</p>
+	{{if .}}<p style="color: red">{{.}}</p>{{end}}
+	<input type="password" name="password" autofocus>
+	<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+var comingSoonPage = template.Must(template.New("coming-soon").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Coming soon</title></head>
+<body>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{or .Title "Link preview"}}</title></head>
+<body>
+{{with .Title}}<h1>{{.}}</h1>{{end}}
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{if .Destination}}<p>This link leads to</p>
+<p><code>{{.Destination}}</code></p>{{else}}<p>This link can be opened a limited number of times, where it leads to is shown once it is opened.</p>{{end}}
+<p>Shared by {{.Owner}}{{with .Created}} on {{.}}{{end}}, opened {{.Clicks}} times.</p>
+<p><a href="{{.Continue}}">Continue</a></p>
+</body>
+</html>
+`))
+
+var disabledPage = template.Must(template.New("disabled").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Link disabled</title></head>
+<body>
+<p>This link has been disabled{{if eq .Status 451}} for legal reasons{{else if eq .Status 403}} because it leads to a site known to be unsafe{{end}}.</p>
+{{with .Reason}}<p>{{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+type disabledInfo struct {
+	Status int
+	Reason string
+}
+
+// preview is what visitors see about the link, notes of the owner are never shown.
+// Destination is empty for click-limited links
+type preview struct {
+	Title       string
+	Description string
+	Destination string
+	Owner       string
+	Created     string
+	Clicks      int64
+	Continue    string
+}
+
+// CountryLocator returns the ISO 3166-1 alpha-2 country code of {addr}
+type CountryLocator interface {
+	Country(addr netip.Addr) (string, error)
+}
+
+// Get redirects to the url saved under the alias, passing the query and the path following the alias
+// through if the link allows it.
+// A password-protected link is unlocked by the X-Link-Password header or the password form,
+// and stays unlocked for the client by a signed cookie until it expires or the password changes.
+// Country rules of links are ignored if {geo} is nil.
+// The alias followed by service.PreviewSuffix or the preview=1 query shows the preview page instead of redirecting,
+// which owners can force for all their links.
+// A disabled link answers 451 if an admin disabled it, 403 if it was blocklisted as unsafe and 410 if its owner did,
+// with cfg.DisabledPagePath for browsers
+func Get(log *slog.Logger, svc *service.Shortener, cfg config.RedirectConfig, geo CountryLocator) gin.HandlerFunc {
+	disabledTmpl := disabledPage
+	if cfg.DisabledPagePath != "" {
+		disabledTmpl = template.Must(template.ParseFiles(cfg.DisabledPagePath))
+	}
+
+	secret := []byte(cfg.CookieSecret)
+	if len(secret) == 0 {
+		log.Warn("redirect cookie secret is not set, unlocked links will ask for password again after restart")
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+
 	return func(c *gin.Context) {
 		const op = "http-server.Get"
 
-		alias := c.Param("alias")
+		alias, previewRequested := strings.CutSuffix(c.Param("alias"), service.PreviewSuffix)
 		username := c.Param("username")
-		if alias == "" {
-			log.Error("alias is empty", slog.String("op", op))
+		query, previewValue := takePreview(c.Request.URL.RawQuery)
+		previewRequested = previewRequested || previewValue == "1"
+
+		log.Debug(
+			"try to handle get request",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.String("op", op),
+		)
+
+		link, err := svc.Resolve(c, username, alias)
+		if err != nil {
+			if errors.Is(err, service.ErrLinkNotActive) || errors.Is(err, service.ErrLinkExpired) {
+				log.Info(err.Error(), slog.String("alias", alias), slog.String("op", op))
+				inactive(c, err, cfg.InactiveFallbackURL)
+				return
+			}
+			if errors.Is(err, service.ErrLinkDisabled) {
+				log.Info(
+					err.Error(),
+					slog.String("alias", alias),
+					slog.String("disabled_by", link.DisabledBy),
+					slog.String("op", op),
+				)
+				disabled(c, link, disabledTmpl)
+				return
+			}
+			if errors.Is(err, service.ErrAliasNotFound) {
+				log.Info("alias not found", slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrEmptyAlias) || errors.Is(err, service.ErrEmptyUsername) {
+				log.Error(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.BadRequest),
+					),
+				)
+				return
+			}
+
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to get url from storage", err.Error()),
+				slog.String("op", op),
+			)
 			c.JSON(
-				http.StatusBadRequest,
+				http.StatusInternalServerError,
 				NewResponse(
 					SetStatus(httpServer.StatusError),
-					SetError(httpServer.BadRequest),
+					SetError(httpServer.InternalError),
 				),
 			)
 			return
 		}
 
-		if username == "" {
-			log.Error("The username is missing", slog.String("op", op))
+		// platform routes win over country rules, and both win over A/B variants,
+		// which split the fallback traffic only.
+		// The chosen url gets the same path, query and UTM parameters as the fallback one
+		target, variant := link, -1
+		if url, ok := service.Route(link, c.Request.UserAgent()); ok {
+			target.Url = url
+		} else if url, ok := service.RouteCountry(link, clientCountry(c, log, geo, link)); ok {
+			target.Url = url
+		} else if variant = svc.PickVariant(link, stickyVariant(c, secret, username, alias)); variant >= 0 {
+			target.Url = link.Variants[variant].Url
+		}
+
+		rest := extraPath(c)
+		destination, err := svc.Destination(c, target, rest, query)
+		if err != nil {
+			if errors.Is(err, service.ErrPathNotAllowed) {
+				log.Info(err.Error(), slog.String("alias", alias), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidPath) {
+				log.Info(err.Error(), slog.String("alias", alias), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.BadRequest),
+					),
+				)
+				return
+			}
+
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to build destination", err.Error()),
+				slog.String("op", op),
+			)
 			c.JSON(
-				http.StatusBadRequest,
+				http.StatusInternalServerError,
 				NewResponse(
 					SetStatus(httpServer.StatusError),
-					SetError(httpServer.BadRequest),
+					SetError(httpServer.InternalError),
 				),
 			)
 			return
 		}
 
-		log.Debug(
-			"try to handle get request",
-			slog.String("username", username),
-			slog.String("alias", alias),
-			slog.String("op", op),
-		)
+		// cookies of the link are not sent to other links of the user
+		path := "/" + username + "/" + alias
+
+		if link.PasswordHash != "" {
+			// the hash is signed too, so changing the password locks the link again
+			value := username + "/" + alias + "/" + link.PasswordHash
+
+			cookie, err := c.Cookie(accessCookie)
+			if err != nil || !signature.Verify(secret, value, cookie, time.Now()) {
+				password := c.GetHeader(PasswordHeader)
+				if password == "" {
+					password = c.PostForm(PasswordField)
+				}
+
+				if err := svc.CheckPassword(link, password); err != nil {
+					log.Info(err.Error(), slog.String("alias", alias), slog.String("op", op))
+					deny(c, err)
+					return
+				}
+
+				expires := time.Now().Add(cfg.PasswordCookieTTL)
+				http.SetCookie(c.Writer, &http.Cookie{
+					Name:     accessCookie,
+					Value:    signature.Sign(secret, value, expires),
+					Path:     path,
+					Expires:  expires,
+					HttpOnly: true,
+					Secure:   c.Request.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+		}
+
+		// the preview follows the password check, so it never shows where a protected link leads to
+		if previewRequested || previewValue != "0" && svc.ForcesPreview(c, link) {
+			// the preview does not consume clicks, so it must not outlive them
+			if link.MaxClicks > 0 && link.RemainingClicks <= 0 {
+				log.Info("link exhausted", slog.String("alias", alias), slog.String("op", op))
+				exhausted(c)
+				return
+			}
 
-		url, err := s.GetURL(c, username, alias)
+			log.Info("show link preview", slog.String("alias", alias), slog.String("op", op))
+
+			page := preview{
+				Title:       link.Title,
+				Description: link.Description,
+				Owner:       username,
+				Clicks:      link.Clicks,
+				Continue:    continueURL(username, alias, rest, query),
+			}
+			// the destination of a click-limited link is given only for a click
+			if link.MaxClicks == 0 {
+				page.Destination = destination
+			}
+			if link.CreatedAt != nil {
+				page.Created = link.CreatedAt.Format(time.DateOnly)
+			}
+
+			c.Status(http.StatusOK)
+			c.Header("Cache-Control", "no-store")
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			_ = previewPage.Execute(c.Writer, page)
+			return
+		}
+
+		// the click is consumed only after the password is checked, so wrong guesses do not burn clicks
+		link, err = svc.Visit(c, link)
 		if err != nil {
-			if errors.Is(err, storage.ErrAliasNotFound) {
+			if errors.Is(err, service.ErrLinkExhausted) {
+				log.Info("link exhausted", slog.String("alias", alias), slog.String("op", op))
+				exhausted(c)
+				return
+			}
+			if errors.Is(err, service.ErrAliasNotFound) {
 				log.Info("alias not found", slog.String("op", op))
 				c.JSON(
 					http.StatusBadRequest,
@@ -90,34 +372,302 @@ func Get(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 					),
 				)
 				return
-			} else if errors.Is(err, storage.ErrCacheGet) {
-				log.Error(
-					fmt.Sprintf("%s: %s", "failed to get url from cache", err.Error()),
-					slog.String("op", op),
-				)
-			} else {
+			}
+
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to use link click", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		if variant >= 0 {
+			if err := svc.CountVariant(c, link, variant); err != nil {
 				log.Error(
-					fmt.Sprintf("%s: %s", "failed to get url from storage", err.Error()),
+					fmt.Sprintf("%s: %s", "failed to count variant click", err.Error()),
 					slog.String("op", op),
 				)
-				c.JSON(
-					http.StatusInternalServerError,
-					NewResponse(
-						SetStatus(httpServer.StatusError),
-						SetError(httpServer.InternalError),
-					),
-				)
-				return
 			}
+
+			expires := time.Now().Add(cfg.VariantCookieTTL)
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     variantCookie,
+				Value:    signVariant(secret, username, alias, target.Url, expires),
+				Path:     path,
+				MaxAge:   int(cfg.VariantCookieTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   c.Request.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
 		}
 
 		log.Info(
 			"success handle get url",
 			slog.String("username", username),
 			slog.String("alias", alias),
-			slog.String("url", url),
+			slog.String("url", destination),
 			slog.String("op", op),
 		)
-		c.Redirect(http.StatusFound, url)
+
+		c.Header("Cache-Control", cacheControl(link, cfg.PermanentMaxAge))
+		if len(link.Routes) > 0 {
+			c.Header("Vary", "User-Agent")
+		}
+
+		// the password form is answered with 303, so the browser follows it with GET
+		if c.Request.Method == http.MethodPost {
+			c.Redirect(http.StatusSeeOther, destination)
+			return
+		}
+		c.Redirect(redirectCode(link), destination)
+	}
+}
+
+// clientCountry returns the country of the client, empty if the link has no country rules
+// or the client could not be located, so the link falls back to its url.
+// The client address is taken from X-Forwarded-For only if the request came from a trusted proxy
+func clientCountry(c *gin.Context, log *slog.Logger, geo CountryLocator, link storage.Link) string {
+	if geo == nil || len(link.Countries) == 0 {
+		return ""
+	}
+
+	addr, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		log.Debug("failed to parse client ip", slog.String("ip", c.ClientIP()))
+		return ""
+	}
+
+	country, err := geo.Country(addr)
+	if err != nil {
+		log.Debug(err.Error(), slog.String("ip", addr.String()))
+		return ""
+	}
+
+	return country
+}
+
+// signVariant returns the cookie keeping the client on the variant with {url}, the url is signed with the link,
+// so clients cannot pick a variant or move a cookie to another link
+func signVariant(secret []byte, username, alias, url string, expires time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(url)) + "." + signature.Sign(secret, variantValue(username, alias, url), expires)
+}
+
+// stickyVariant returns url of the variant the client was sent to before, if its cookie is validly signed.
+// PickVariant ignores urls that are no longer variants of the link
+func stickyVariant(c *gin.Context, secret []byte, username, alias string) string {
+	cookie, err := c.Cookie(variantCookie)
+	if err != nil {
+		return ""
+	}
+
+	encoded, token, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return ""
+	}
+
+	url, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !signature.Verify(secret, variantValue(username, alias, string(url)), token, time.Now()) {
+		return ""
+	}
+
+	return string(url)
+}
+
+func variantValue(username, alias, url string) string {
+	return username + "/" + alias + "/" + url
+}
+
+// takePreview removes the preview parameter from {rawQuery} and returns its value,
+// other parameters keep their encoding
+func takePreview(rawQuery string) (string, string) {
+	if rawQuery == "" {
+		return "", ""
+	}
+
+	var value string
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if key, v, _ := strings.Cut(pair, "="); key == PreviewParam {
+			value = v
+			continue
+		}
+		kept = append(kept, pair)
 	}
+
+	return strings.Join(kept, "&"), value
+}
+
+// continueURL returns the short link the preview page leads to, skipping the preview forced by the owner
+func continueURL(username, alias, rest, rawQuery string) string {
+	u := "/" + url.PathEscape(username) + "/" + url.PathEscape(alias)
+	if rest = strings.Trim(rest, "/"); rest != "" {
+		u += "/" + rest
+	}
+	if rawQuery != "" {
+		rawQuery += "&"
+	}
+
+	return u + "?" + rawQuery + PreviewParam + "=0"
+}
+
+// extraPath returns the path following the alias as it was escaped in the request
+func extraPath(c *gin.Context) string {
+	rest := c.Param("rest")
+	if rest == "" {
+		return ""
+	}
+
+	parts := strings.SplitN(c.Request.URL.EscapedPath(), "/", 4)
+	if len(parts) < 4 {
+		return rest
+	}
+
+	return parts[3]
+}
+
+func redirectCode(link storage.Link) int {
+	if link.RedirectCode == 0 {
+		return http.StatusFound
+	}
+	return link.RedirectCode
+}
+
+// cacheControl returns Cache-Control of the redirect to {link}.
+// Links that are checked, counted, located or routed by User-Agent on every redirect are never cached,
+// whatever the link says, shared caches do not reliably honour Vary: User-Agent.
+// Otherwise permanent redirects are cacheable by browsers and CDNs and temporary ones are not
+func cacheControl(link storage.Link, permanentMaxAge time.Duration) string {
+	if link.PasswordHash != "" || link.MaxClicks > 0 || link.NotBefore != nil || link.NotAfter != nil ||
+		len(link.Variants) > 0 || len(link.Countries) > 0 || len(link.Routes) > 0 {
+		return "private, no-store"
+	}
+
+	if link.CacheControl != "" {
+		return link.CacheControl
+	}
+
+	switch redirectCode(link) {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		return "public, max-age=" + strconv.Itoa(int(permanentMaxAge.Seconds()))
+	default:
+		return "no-store"
+	}
+}
+
+// exhausted answers a click-limited link that has no clicks left
+func exhausted(c *gin.Context) {
+	c.JSON(
+		http.StatusGone,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(httpServer.LinkExhausted),
+		),
+	)
+}
+
+// deny asks browsers for the password with a form and API clients with a json error
+func deny(c *gin.Context, err error) {
+	msg := httpServer.PasswordRequired
+	if errors.Is(err, service.ErrWrongPassword) {
+		msg = httpServer.WrongPassword
+	}
+
+	if wantsHTML(c) {
+		formErr := ""
+		if errors.Is(err, service.ErrWrongPassword) {
+			formErr = msg
+		}
+
+		c.Status(http.StatusUnauthorized)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		_ = passwordForm.Execute(c.Writer, formErr)
+		return
+	}
+
+	c.JSON(
+		http.StatusUnauthorized,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(msg),
+		),
+	)
+}
+
+// inactive redirects links outside their activation window to {fallback},
+// or tells the client the link is coming soon or is gone if there is no fallback
+func inactive(c *gin.Context, err error, fallback string) {
+	c.Header("Cache-Control", "no-store")
+
+	if fallback != "" {
+		c.Redirect(http.StatusFound, fallback)
+		return
+	}
+
+	code, msg := http.StatusNotFound, httpServer.LinkNotActive
+	if errors.Is(err, service.ErrLinkExpired) {
+		code, msg = http.StatusGone, httpServer.LinkExpired
+	}
+
+	if wantsHTML(c) {
+		page := "Coming soon"
+		if code == http.StatusGone {
+			page = "This link is no longer active"
+		}
+
+		c.Status(code)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		_ = comingSoonPage.Execute(c.Writer, page)
+		return
+	}
+
+	c.JSON(
+		code,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(msg),
+		),
+	)
+}
+
+// disabled tells the client the link is disabled, with 451 if an admin disabled it,
+// 403 if its url was blocklisted as unsafe and 410 if its owner did.
+// Browsers get {page}, API clients a json error with the reason
+func disabled(c *gin.Context, link storage.Link, page *template.Template) {
+	c.Header("Cache-Control", "no-store")
+
+	code, msg := http.StatusGone, httpServer.LinkDisabled
+	switch link.DisabledBy {
+	case storage.DisabledByAdmin:
+		code = http.StatusUnavailableForLegalReasons
+	case storage.DisabledBySafety:
+		code, msg = http.StatusForbidden, httpServer.DisabledAsUnsafe
+	}
+
+	if wantsHTML(c) {
+		c.Status(code)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		_ = page.Execute(c.Writer, disabledInfo{Status: code, Reason: link.DisabledReason})
+		return
+	}
+
+	c.JSON(
+		code,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(msg),
+			SetReason(link.DisabledReason),
+		),
+	)
+}
+
+func wantsHTML(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/html")
 }
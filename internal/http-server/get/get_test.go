@@ -0,0 +1,181 @@
+package get
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/storage/sqlite"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet_LimitedLinkPreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := sqlite.MustNew(5*time.Second, filepath.Join(t.TempDir(), "data.db"))
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.New(log, db, db, nil, time.Hour, db)
+
+	_, err := svc.Save(context.Background(), service.NewLink{
+		Username:  "pasha",
+		Url:       "https://go.dev/secret",
+		Alias:     "invite",
+		MaxClicks: 1,
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/:username/:alias", Get(log, svc, config.RedirectConfig{CookieSecret: "secret"}, nil))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/pasha/invite" + service.PreviewSuffix)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "go.dev/secret")
+
+	w = get("/pasha/invite")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://go.dev/secret", w.Header().Get("Location"))
+
+	for _, path := range []string{"/pasha/invite" + service.PreviewSuffix, "/pasha/invite?preview=1", "/pasha/invite"} {
+		w = get(path)
+		assert.Equal(t, http.StatusGone, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "go.dev/secret", path)
+	}
+}
+
+func TestGet_DisabledLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := sqlite.MustNew(5*time.Second, filepath.Join(t.TempDir(), "data.db"))
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.New(log, db, db, nil, time.Hour, db)
+
+	router := gin.New()
+	router.GET("/:username/:alias", Get(log, svc, config.RedirectConfig{CookieSecret: "secret"}, nil))
+
+	tests := []struct {
+		by       string
+		expected int
+		page     string
+	}{
+		{by: storage.DisabledByOwner, expected: http.StatusGone, page: "This link has been disabled."},
+		{by: storage.DisabledByAdmin, expected: http.StatusUnavailableForLegalReasons, page: "for legal reasons"},
+		{by: storage.DisabledBySafety, expected: http.StatusForbidden, page: "known to be unsafe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			_, err := svc.Save(context.Background(), service.NewLink{Username: "pasha", Url: "https://go.dev", Alias: tt.by})
+			require.NoError(t, err)
+
+			disabled := true
+			_, err = db.UpdateLink(context.Background(), "pasha", tt.by, storage.LinkPatch{Disabled: &disabled, DisabledBy: &tt.by})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pasha/"+tt.by, nil))
+			assert.Equal(t, tt.expected, w.Code)
+
+			w = httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/pasha/"+tt.by, nil)
+			req.Header.Set("Accept", "text/html")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+			assert.Contains(t, w.Body.String(), tt.page)
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		link     storage.Link
+		expected string
+	}{
+		{name: "temporary", link: storage.Link{}, expected: "no-store"},
+		{name: "permanent", link: storage.Link{RedirectCode: http.StatusMovedPermanently}, expected: "public, max-age=86400"},
+		{name: "own", link: storage.Link{CacheControl: "public, max-age=60"}, expected: "public, max-age=60"},
+		{name: "password", link: storage.Link{RedirectCode: http.StatusMovedPermanently, PasswordHash: "hash"}, expected: "private, no-store"},
+		{name: "max clicks", link: storage.Link{RedirectCode: http.StatusMovedPermanently, MaxClicks: 1}, expected: "private, no-store"},
+		{name: "activation window", link: storage.Link{RedirectCode: http.StatusMovedPermanently, NotAfter: &now}, expected: "private, no-store"},
+		{name: "variants", link: storage.Link{CacheControl: "public, max-age=60", Variants: []storage.Variant{{Url: "https://go.dev", Weight: 1}}}, expected: "private, no-store"},
+		{name: "countries", link: storage.Link{RedirectCode: http.StatusMovedPermanently, Countries: map[string]string{"de": "https://go.dev/de"}}, expected: "private, no-store"},
+		{name: "routes", link: storage.Link{RedirectCode: http.StatusMovedPermanently, Routes: map[string]string{"ios": "https://apps.apple.com"}}, expected: "private, no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, cacheControl(tt.link, day))
+		})
+	}
+}
+
+func TestGet_StickyVariant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := sqlite.MustNew(5*time.Second, filepath.Join(t.TempDir(), "data.db"))
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.New(log, db, db, nil, time.Hour, db)
+
+	_, err := svc.Save(context.Background(), service.NewLink{
+		Username: "pasha",
+		Url:      "https://example.com",
+		Alias:    "landing",
+		Variants: []storage.Variant{
+			{Url: "https://example.com/rare", Weight: 1},
+			{Url: "https://example.com/common", Weight: 1_000_000},
+		},
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/:username/:alias", Get(log, svc, config.RedirectConfig{CookieSecret: "secret", VariantCookieTTL: time.Hour}, nil))
+
+	expires := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		cookie   string
+		expected string
+	}{
+		{name: "signed", cookie: signVariant([]byte("secret"), "pasha", "landing", "https://example.com/rare", expires), expected: "https://example.com/rare"},
+		{name: "unsigned", cookie: base64.RawURLEncoding.EncodeToString([]byte("https://example.com/rare")), expected: "https://example.com/common"},
+		{name: "other link", cookie: signVariant([]byte("secret"), "pasha", "other", "https://example.com/rare", expires), expected: "https://example.com/common"},
+		{name: "removed variant", cookie: signVariant([]byte("secret"), "pasha", "landing", "https://example.com/gone", expires), expected: "https://example.com/common"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/pasha/landing", nil)
+			req.AddCookie(&http.Cookie{Name: variantCookie, Value: tt.cookie})
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Location"))
+		})
+	}
+
+	link, err := db.GetLink(context.Background(), "pasha", "landing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), link.Variants[0].Clicks)
+	assert.Equal(t, int64(3), link.Variants[1].Clicks)
+}
@@ -0,0 +1,235 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request asks to roll the link back to a version listed by its history
+type Request struct {
+	Version int `json:"version" validate:"required"`
+}
+
+type Response struct {
+	Status   string                `json:"status"`
+	Error    string                `json:"error,omitempty"`
+	Versions []storage.LinkVersion `json:"versions,omitempty"`
+	// ShortUrl is the url of the link rolled back
+	ShortUrl string `json:"short_url,omitempty"`
+	Url      string `json:"url,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func SetVersions(versions []storage.LinkVersion) Decorator {
+	return func(response *Response) {
+		response.Versions = versions
+	}
+}
+
+func SetLink(shortUrl, url string) Decorator {
+	return func(response *Response) {
+		response.ShortUrl = shortUrl
+		response.Url = url
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+// History returns previous aliases and urls of the link to its owner, it expects basic auth before it
+func History(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.History"
+
+		username, alias, ok := owner(c, log, op)
+		if !ok {
+			return
+		}
+
+		log.Debug(
+			"try to handle history request",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.String("op", op),
+		)
+
+		versions, err := svc.History(c, username, alias)
+		if err != nil {
+			fail(c, log, op, err)
+			return
+		}
+
+		log.Info(
+			"success handle history",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.Int("count", len(versions)),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetVersions(versions),
+			),
+		)
+	}
+}
+
+// Rollback brings back the alias and url the link had at the requested version, it expects basic auth before it
+func Rollback(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.Rollback"
+
+		username, alias, ok := owner(c, log, op)
+		if !ok {
+			return
+		}
+
+		var req Request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to decode request", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.BadRequest),
+				),
+			)
+			return
+		}
+
+		log.Debug(
+			"try to handle rollback request",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.Int("version", req.Version),
+			slog.String("op", op),
+		)
+
+		link, err := svc.Rollback(c, username, alias, req.Version)
+		if err != nil {
+			fail(c, log, op, err)
+			return
+		}
+
+		log.Info(
+			"success handle rollback",
+			slog.String("username", username),
+			slog.String("alias", link.Alias),
+			slog.String("url", link.Url),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetLink(httpServer.Path+username+"/"+link.Alias, link.Url),
+			),
+		)
+	}
+}
+
+// owner returns the link from the path if it belongs to the authenticated user
+func owner(c *gin.Context, log *slog.Logger, op string) (string, string, bool) {
+	username := c.GetString("username")
+	if username != c.Param("username") {
+		log.Info("not the owner of the link", slog.String("username", username), slog.String("op", op))
+		c.JSON(
+			http.StatusForbidden,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.NotLinkOwner),
+			),
+		)
+		return "", "", false
+	}
+
+	return username, c.Param("alias"), true
+}
+
+func fail(c *gin.Context, log *slog.Logger, op string, err error) {
+	if errors.Is(err, service.ErrAliasNotFound) {
+		log.Info("alias not found", slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.AliasNotFound),
+			),
+		)
+		return
+	}
+	if errors.Is(err, service.ErrNewAliasAlreadyExists) {
+		log.Info("old alias taken by another link", slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.NewAliasAlreadyExists),
+			),
+		)
+		return
+	}
+	if errors.Is(err, service.ErrVersionNotFound) || errors.Is(err, service.ErrUnsafeURL) {
+		log.Info(err.Error(), slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(err.Error()),
+			),
+		)
+		return
+	}
+	if errors.Is(err, service.ErrEmptyAlias) || errors.Is(err, service.ErrEmptyUsername) {
+		log.Error(err.Error(), slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.BadRequest),
+			),
+		)
+		return
+	}
+
+	log.Error(err.Error(), slog.String("op", op))
+	c.JSON(
+		http.StatusInternalServerError,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(httpServer.InternalError),
+		),
+	)
+}
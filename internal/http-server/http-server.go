@@ -11,6 +11,16 @@ const (
 	AliasAlreadyExist     = "alias already exist"
 	AliasNotFound         = "alias not found"
 	NewAliasAlreadyExists = "new_alias cannot use, url with this alias already exists"
+	PasswordRequired      = "link is protected with password"
+	WrongPassword         = "wrong link password"
+	LinkExhausted         = "link has no clicks left"
+	LinkNotActive         = "link is not active yet"
+	LinkExpired           = "link is no longer active"
+	LinkDisabled          = "link is disabled"
+	DisabledByAdmin       = "link is disabled by admin"
+	DisabledAsUnsafe      = "link is disabled as unsafe"
+	RestoreAliasTaken     = "alias is taken by a new link, rename or delete it to restore"
+	NotLinkOwner          = "link belongs to another user"
 )
 
 const (
@@ -0,0 +1,278 @@
+package list
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request is read from the query, links having all of the tags in the folder are listed
+type Request struct {
+	Tags   []string `form:"tag"`
+	Folder string   `form:"folder"`
+}
+
+type Link struct {
+	Alias            string            `json:"alias"`
+	Url              string            `json:"url"`
+	ShortUrl         string            `json:"short_url"`
+	MaxClicks        int64             `json:"max_clicks,omitempty"`
+	RemainingClicks  *int64            `json:"remaining_clicks,omitempty"`
+	NotBefore        *time.Time        `json:"not_before,omitempty"`
+	NotAfter         *time.Time        `json:"not_after,omitempty"`
+	RedirectCode     int               `json:"redirect_code,omitempty"`
+	CacheControl     string            `json:"cache_control,omitempty"`
+	QueryPassthrough string            `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool              `json:"path_passthrough,omitempty"`
+	UTM              *storage.UTM      `json:"utm,omitempty"`
+	Routes           map[string]string `json:"routes,omitempty"`
+	Countries        map[string]string `json:"countries,omitempty"`
+	// Variants carry clicks counted per variant
+	Variants  []storage.Variant `json:"variants,omitempty"`
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Clicks    int64             `json:"clicks"`
+	Disabled  bool              `json:"disabled,omitempty"`
+	// DisabledBy is "owner" or "admin"
+	DisabledBy     string   `json:"disabled_by,omitempty"`
+	DisabledReason string   `json:"disabled_reason,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Folder         string   `json:"folder,omitempty"`
+	// Notes are private to the owner, unlike Title and Description shown on the preview page
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+}
+
+type Response struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Links  []Link `json:"links,omitempty"`
+	Link   *Link  `json:"link,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func SetLinks(links []Link) Decorator {
+	return func(response *Response) {
+		response.Links = links
+	}
+}
+
+func SetLink(link Link) Decorator {
+	return func(response *Response) {
+		response.Link = &link
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+func List(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.List"
+
+		username := c.GetString("username")
+
+		var req Request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Info(
+				fmt.Sprintf("%s: %s", "failed to decode request", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.BadRequest),
+				),
+			)
+			return
+		}
+
+		log.Debug(
+			"try to handle list request",
+			slog.String("username", username),
+			slog.Any("tags", req.Tags),
+			slog.String("folder", req.Folder),
+			slog.String("op", op),
+		)
+
+		links, err := svc.List(c, username, storage.LinkFilter{Tags: req.Tags, Folder: req.Folder})
+		if errors.Is(err, service.ErrInvalidTags) || errors.Is(err, service.ErrInvalidFolder) {
+			log.Info(err.Error(), slog.String("op", op))
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(err.Error()),
+				),
+			)
+			return
+		}
+		if err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to list urls", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		resp := make([]Link, 0, len(links))
+		for _, l := range links {
+			resp = append(resp, toLink(l))
+		}
+
+		log.Info(
+			"success handle list urls",
+			slog.String("username", username),
+			slog.Int("count", len(resp)),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetLinks(resp),
+			),
+		)
+	}
+}
+
+// Info returns the link from the path with its metadata to its owner, it expects basic auth before it
+func Info(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.Info"
+
+		username, alias := c.GetString("username"), c.Param("alias")
+		if username != c.Param("username") {
+			log.Info("not the owner of the link", slog.String("username", username), slog.String("op", op))
+			c.JSON(
+				http.StatusForbidden,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.NotLinkOwner),
+				),
+			)
+			return
+		}
+
+		log.Debug(
+			"try to handle info request",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.String("op", op),
+		)
+
+		link, err := svc.Info(c, username, alias)
+		if errors.Is(err, service.ErrAliasNotFound) {
+			log.Info("alias not found", slog.String("op", op))
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.AliasNotFound),
+				),
+			)
+			return
+		}
+		if err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to get link", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		log.Info(
+			"success handle info",
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetLink(toLink(link)),
+			),
+		)
+	}
+}
+
+func toLink(l storage.Link) Link {
+	link := Link{
+		Alias:            l.Alias,
+		Url:              l.Url,
+		ShortUrl:         httpServer.Path + l.Username + "/" + l.Alias,
+		MaxClicks:        l.MaxClicks,
+		NotBefore:        l.NotBefore,
+		NotAfter:         l.NotAfter,
+		RedirectCode:     l.RedirectCode,
+		CacheControl:     l.CacheControl,
+		QueryPassthrough: l.QueryPassthrough,
+		PathPassthrough:  l.PathPassthrough,
+		Routes:           l.Routes,
+		Countries:        l.Countries,
+		Variants:         l.Variants,
+		CreatedAt:        l.CreatedAt,
+		UpdatedAt:        l.UpdatedAt,
+		Clicks:           l.Clicks,
+		Disabled:         l.Disabled,
+		DisabledBy:       l.DisabledBy,
+		DisabledReason:   l.DisabledReason,
+		Tags:             l.Tags,
+		Folder:           l.Folder,
+		Title:            l.Title,
+		Description:      l.Description,
+		Notes:            l.Notes,
+	}
+	if l.MaxClicks > 0 {
+		link.RemainingClicks = &l.RemainingClicks
+	}
+	if !l.UTM.IsZero() {
+		link.UTM = &l.UTM
+	}
+
+	return link
+}
@@ -1,12 +1,68 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/lib/requestid"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BasicAuth rejects requests without valid basic auth credentials
+func BasicAuth(a auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if !ok || a.Authenticate(c, username, password) != nil {
+			c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Set("username", username)
+		c.Next()
+	}
+}
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID takes the request id from the X-Request-ID header or generates one,
+// and returns it in the same header of the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestid.Take(c.GetHeader(RequestIDHeader))
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// Caller puts the authenticated user, client ip and request id into the request context for the audit log,
+// it expects BasicAuth and RequestID before it.
+// The router must use ContextWithFallback, so handlers passing *gin.Context on see it
+func Caller() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := service.Caller{
+			Username:  c.GetString("username"),
+			IP:        c.ClientIP(),
+			RequestID: c.GetString("request_id"),
+		}
+		c.Request = c.Request.WithContext(service.WithCaller(c.Request.Context(), caller))
+	}
+}
+
+// Admin rejects users other than {admins}, it expects BasicAuth before it
+func Admin(admins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, admin := range admins {
+		allowed[admin] = true
+	}
 
-func GetCreator() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		creator, _, ok := c.Request.BasicAuth()
-		if ok {
-			c.Set("username", creator)
+		if !allowed[c.GetString("username")] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
 		}
 
 		c.Next()
@@ -0,0 +1,267 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"log/slog"
+	"net/http"
+	"strings"
+	httpServer "url-shortener/internal/http-server"
+	qrcode "url-shortener/internal/lib/qr"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	defaultSize   = 256
+	minSize       = 64
+	maxSize       = 2048
+	defaultMargin = 4
+	maxMargin     = 16
+)
+
+var errInvalidOption = errors.New("invalid qr option")
+
+// Request is read from the query, all options are optional
+type Request struct {
+	// Format is png or svg, png by default
+	Format string `form:"format"`
+	// Size is width and height of the image in pixels, from 64 to 2048
+	Size int `form:"size"`
+	// Margin is the light border around the code in modules, from 0 to 16
+	Margin *int `form:"margin"`
+	// Level is the error correction level: L, M, Q or H
+	Level string `form:"level"`
+	// Fg and Bg are hex colors of dark and light modules, such as 1a73e8 or #1a73e8
+	Fg string `form:"fg"`
+	Bg string `form:"bg"`
+}
+
+type Response struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+// QR returns a QR code of the full short link as PNG or SVG.
+// Codes of links outside their activation window are served too, so they can be printed in advance
+func QR(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.QR"
+
+		alias := c.Param("alias")
+		username := c.Param("username")
+
+		var req Request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Info(
+				fmt.Sprintf("%s: %s", "failed to decode request", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.BadRequest),
+				),
+			)
+			return
+		}
+
+		level, style, err := req.options()
+		if err != nil {
+			log.Info(err.Error(), slog.String("op", op))
+			c.JSON(
+				http.StatusBadRequest,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(err.Error()),
+				),
+			)
+			return
+		}
+
+		_, err = svc.Resolve(c, username, alias)
+		if err != nil && !errors.Is(err, service.ErrLinkNotActive) && !errors.Is(err, service.ErrLinkExpired) {
+			if errors.Is(err, service.ErrLinkDisabled) {
+				log.Info(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusGone,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.LinkDisabled),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrAliasNotFound) ||
+				errors.Is(err, service.ErrEmptyAlias) ||
+				errors.Is(err, service.ErrEmptyUsername) {
+				log.Info(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
+					),
+				)
+				return
+			}
+
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to get url from storage", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		code, err := qrcode.Encode(httpServer.Path+username+"/"+alias, level)
+		if err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to encode qr code", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		var buf bytes.Buffer
+		contentType := "image/png"
+		if req.Format == FormatSVG {
+			contentType = "image/svg+xml"
+			err = code.SVG(&buf, style)
+		} else {
+			err = code.PNG(&buf, style)
+		}
+		if err != nil {
+			if errors.Is(err, qrcode.ErrTooSmall) {
+				log.Info(err.Error(), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(err.Error()),
+					),
+				)
+				return
+			}
+
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to render qr code", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		c.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+// options validates the request and fills in the defaults
+func (r Request) options() (qrcode.Level, qrcode.Style, error) {
+	style := qrcode.Style{
+		Size:       defaultSize,
+		Margin:     defaultMargin,
+		Foreground: color.RGBA{A: 0xFF},
+		Background: color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	}
+
+	if r.Format != "" && r.Format != FormatPNG && r.Format != FormatSVG {
+		return 0, style, fmt.Errorf("%w: format must be png or svg", errInvalidOption)
+	}
+
+	if r.Size != 0 {
+		if r.Size < minSize || r.Size > maxSize {
+			return 0, style, fmt.Errorf("%w: size must be from %d to %d", errInvalidOption, minSize, maxSize)
+		}
+		style.Size = r.Size
+	}
+
+	if r.Margin != nil {
+		if *r.Margin < 0 || *r.Margin > maxMargin {
+			return 0, style, fmt.Errorf("%w: margin must be from 0 to %d", errInvalidOption, maxMargin)
+		}
+		style.Margin = *r.Margin
+	}
+
+	level := qrcode.M
+	if r.Level != "" {
+		var ok bool
+		if level, ok = qrcode.ParseLevel(r.Level); !ok {
+			return 0, style, fmt.Errorf("%w: level must be one of L, M, Q, H", errInvalidOption)
+		}
+	}
+
+	var err error
+	if r.Fg != "" {
+		if style.Foreground, err = parseColor(r.Fg); err != nil {
+			return 0, style, err
+		}
+	}
+	if r.Bg != "" {
+		if style.Background, err = parseColor(r.Bg); err != nil {
+			return 0, style, err
+		}
+	}
+
+	return level, style, nil
+}
+
+func parseColor(s string) (color.RGBA, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return color.RGBA{}, fmt.Errorf("%w: color %q must be 6 hex digits", errInvalidOption, s)
+	}
+
+	return color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xFF}, nil
+}
@@ -5,23 +5,55 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 	httpServer "url-shortener/internal/http-server"
-	"url-shortener/internal/lib/random"
+	"url-shortener/internal/service"
 	"url-shortener/internal/storage"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 )
 
 type Request struct {
 	Url   string `json:"url" validate:"required,url"`
 	Alias string `json:"alias,omitempty"`
+	// Password protects the link, it is never stored in plain text
+	Password string `json:"password,omitempty"`
+	// MaxClicks limits how many times the link can be opened
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// NotBefore and NotAfter bound the time the link redirects
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// RedirectCode is one of 301, 302, 307, 308, 302 by default
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// CacheControl overrides Cache-Control of the redirect
+	CacheControl string `json:"cache_control,omitempty"`
+	// QueryPassthrough merges the incoming query into the url: keep or override on conflicts
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// PathPassthrough appends the path following the alias to the url
+	PathPassthrough bool `json:"path_passthrough,omitempty"`
+	// UTM overrides default UTM parameters of the user
+	UTM storage.UTM `json:"utm"`
+	// Routes maps ios, android, desktop or bot to the url they are sent to instead of Url
+	Routes map[string]string `json:"routes,omitempty"`
+	// Countries maps ISO 3166-1 alpha-2 country codes to the url their visitors are sent to instead of Url
+	Countries map[string]string `json:"countries,omitempty"`
+	// Variants split the traffic across urls by weight, Url is used only if there are no variants
+	Variants []storage.Variant `json:"variants,omitempty"`
+	// Tags group links across folders, they are lower-cased
+	Tags   []string `json:"tags,omitempty"`
+	Folder string   `json:"folder,omitempty"`
+	// Title and Description are shown on the preview page, Notes are seen by the owner only
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Notes       string `json:"notes,omitempty"`
 }
 
 type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 	Alias  string `json:"alias,omitempty"`
+	// QR is the url of the QR code of the short link
+	QR string `json:"qr,omitempty"`
 }
 
 type Decorator func(response *Response)
@@ -44,6 +76,12 @@ func SetAlias(alias string) Decorator {
 	}
 }
 
+func SetQR(qr string) Decorator {
+	return func(response *Response) {
+		response.QR = qr
+	}
+}
+
 func NewResponse(decorators ...Decorator) Response {
 	var resp Response
 
@@ -54,7 +92,7 @@ func NewResponse(decorators ...Decorator) Response {
 	return resp
 }
 
-func Save(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
+func Save(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "http-server.Save"
 
@@ -74,49 +112,7 @@ func Save(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			return
 		}
 
-		if err := validator.New().Struct(req); err != nil {
-			log.Error(
-				fmt.Sprintf("%s: %s", "validation of url failed", err.Error()),
-				slog.String("op", op),
-			)
-			c.JSON(
-				http.StatusBadRequest,
-				NewResponse(
-					SetStatus(httpServer.StatusError),
-					SetError(httpServer.BadRequest),
-				),
-			)
-			return
-		}
-
-		if req.Alias == "" {
-			alias := random.Alias()
-			if alias == "" {
-				log.Error("failed to generate alias", slog.String("op", op))
-				c.JSON(
-					http.StatusInternalServerError,
-					NewResponse(
-						SetStatus(httpServer.StatusError),
-						SetError(httpServer.InternalError),
-					),
-				)
-				return
-			}
-			req.Alias = alias
-		}
-
 		username := c.GetString("username")
-		if username == "" {
-			log.Error("The username is missing", slog.String("op", op))
-			c.JSON(
-				http.StatusBadRequest,
-				NewResponse(
-					SetStatus(httpServer.StatusError),
-					SetError(httpServer.BadRequest),
-				),
-			)
-			return
-		}
 
 		log.Debug(
 			"try to handle save request",
@@ -126,29 +122,86 @@ func Save(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			slog.String("op", op),
 		)
 
-		if err := s.SaveURL(c, req.Url, req.Alias, username); err != nil {
-			if errors.Is(err, storage.ErrCacheSet) {
-				// failed to save url in cache
-				log.Error(err.Error(), slog.String("op", op))
+		alias, err := svc.Save(c, service.NewLink{
+			Username:         username,
+			Url:              req.Url,
+			Alias:            req.Alias,
+			Password:         req.Password,
+			MaxClicks:        req.MaxClicks,
+			NotBefore:        req.NotBefore,
+			NotAfter:         req.NotAfter,
+			RedirectCode:     req.RedirectCode,
+			CacheControl:     req.CacheControl,
+			QueryPassthrough: req.QueryPassthrough,
+			PathPassthrough:  req.PathPassthrough,
+			UTM:              req.UTM,
+			Routes:           req.Routes,
+			Countries:        req.Countries,
+			Variants:         req.Variants,
+			Tags:             req.Tags,
+			Folder:           req.Folder,
+			Metadata: service.Metadata{
+				Title:       req.Title,
+				Description: req.Description,
+				Notes:       req.Notes,
+			},
+		})
+		if err != nil {
+			if errors.Is(err, service.ErrAliasAlreadyExist) {
+				log.Info(
+					"alias already exist",
+					slog.String("op", op),
+				)
 				c.JSON(
-					http.StatusOK,
+					http.StatusBadRequest,
 					NewResponse(
-						SetStatus(httpServer.StatusOK),
-						SetAlias(httpServer.Path+username+"/"+req.Alias),
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasAlreadyExist),
 					),
 				)
 				return
 			}
-			if errors.Is(err, storage.ErrAliasAlreadyExist) {
-				log.Info(
-					"alias already exist",
+			if errors.Is(err, service.ErrUnsafeURL) {
+				log.Warn(
+					err.Error(),
+					slog.String("username", username),
+					slog.String("url", req.Url),
 					slog.String("op", op),
 				)
 				c.JSON(
 					http.StatusBadRequest,
 					NewResponse(
 						SetStatus(httpServer.StatusError),
-						SetError(httpServer.AliasAlreadyExist),
+						SetError(err.Error()),
+					),
+				)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidURL) ||
+				errors.Is(err, service.ErrInvalidMaxClicks) ||
+				errors.Is(err, service.ErrInvalidWindow) ||
+				errors.Is(err, service.ErrInvalidRedirectCode) ||
+				errors.Is(err, service.ErrInvalidCacheControl) ||
+				errors.Is(err, service.ErrInvalidQueryMode) ||
+				errors.Is(err, service.ErrInvalidRoutes) ||
+				errors.Is(err, service.ErrInvalidCountries) ||
+				errors.Is(err, service.ErrInvalidVariants) ||
+				errors.Is(err, service.ErrInvalidTags) ||
+				errors.Is(err, service.ErrInvalidFolder) ||
+				errors.Is(err, service.ErrInvalidTitle) ||
+				errors.Is(err, service.ErrInvalidDescription) ||
+				errors.Is(err, service.ErrInvalidNotes) ||
+				errors.Is(err, service.ErrInvalidAlias) ||
+				errors.Is(err, service.ErrEmptyUsername) {
+				log.Error(
+					fmt.Sprintf("%s: %s", "validation of request failed", err.Error()),
+					slog.String("op", op),
+				)
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.BadRequest),
 					),
 				)
 				return
@@ -159,7 +212,7 @@ func Save(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 				slog.String("op", op),
 			)
 			c.JSON(
-				http.StatusBadRequest,
+				http.StatusInternalServerError,
 				NewResponse(SetStatus(httpServer.StatusError),
 					SetError(httpServer.InternalError),
 				),
@@ -170,14 +223,15 @@ func Save(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 		log.Info(
 			"success handle save url",
 			slog.String("username", username),
-			slog.String("alias", req.Alias),
+			slog.String("alias", alias),
 			slog.String("op", op),
 		)
 		c.JSON(
 			http.StatusOK,
 			NewResponse(
 				SetStatus(httpServer.StatusOK),
-				SetAlias(httpServer.Path+username+"/"+req.Alias),
+				SetAlias(httpServer.Path+username+"/"+alias),
+				SetQR(httpServer.Path+username+"/"+alias+"/qr"),
 			),
 		)
 	}
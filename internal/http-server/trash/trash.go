@@ -0,0 +1,269 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	httpServer "url-shortener/internal/http-server"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Request struct {
+	Alias string `json:"alias" validate:"required"`
+}
+
+type Link struct {
+	Alias     string    `json:"alias"`
+	Url       string    `json:"url"`
+	ShortUrl  string    `json:"short_url"`
+	Clicks    int64     `json:"clicks"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// ExpiresAt is when the link is deleted permanently
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Response struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Links  []Link `json:"links,omitempty"`
+	// ShortUrl is the url of the restored link
+	ShortUrl string `json:"short_url,omitempty"`
+}
+
+type Decorator func(response *Response)
+
+func SetStatus(status string) Decorator {
+	return func(response *Response) {
+		response.Status = status
+	}
+}
+
+func SetError(err string) Decorator {
+	return func(response *Response) {
+		response.Error = err
+	}
+}
+
+func SetLinks(links []Link) Decorator {
+	return func(response *Response) {
+		response.Links = links
+	}
+}
+
+func SetShortUrl(shortUrl string) Decorator {
+	return func(response *Response) {
+		response.ShortUrl = shortUrl
+	}
+}
+
+func NewResponse(decorators ...Decorator) Response {
+	var resp Response
+
+	for _, d := range decorators {
+		d(&resp)
+	}
+
+	return resp
+}
+
+// List returns deleted links of the user that can still be restored
+func List(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.trash.List"
+
+		username := c.GetString("username")
+
+		log.Debug(
+			"try to handle list trash request",
+			slog.String("username", username),
+			slog.String("op", op),
+		)
+
+		links, err := svc.ListTrash(c, username)
+		if err != nil {
+			log.Error(
+				fmt.Sprintf("%s: %s", "failed to list trash", err.Error()),
+				slog.String("op", op),
+			)
+			c.JSON(
+				http.StatusInternalServerError,
+				NewResponse(
+					SetStatus(httpServer.StatusError),
+					SetError(httpServer.InternalError),
+				),
+			)
+			return
+		}
+
+		resp := make([]Link, 0, len(links))
+		for _, l := range links {
+			resp = append(resp, Link{
+				Alias:     l.Alias,
+				Url:       l.Url,
+				ShortUrl:  httpServer.Path + l.Username + "/" + l.Alias,
+				Clicks:    l.Clicks,
+				DeletedAt: l.DeletedAt,
+				ExpiresAt: l.ExpiresAt,
+			})
+		}
+
+		log.Info(
+			"success handle list trash",
+			slog.String("username", username),
+			slog.Int("count", len(resp)),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetLinks(resp),
+			),
+		)
+	}
+}
+
+// Restore moves a deleted link back under its alias, unless a new link took the alias meanwhile
+func Restore(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.trash.Restore"
+
+		req, ok := decode(c, log, op)
+		if !ok {
+			return
+		}
+
+		username := c.GetString("username")
+
+		log.Debug(
+			"try to handle restore request",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+
+		link, err := svc.Restore(c, username, req.Alias)
+		if err != nil {
+			if errors.Is(err, service.ErrAliasAlreadyExist) {
+				log.Info("alias taken by a new link", slog.String("alias", req.Alias), slog.String("op", op))
+				c.JSON(
+					http.StatusBadRequest,
+					NewResponse(
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.RestoreAliasTaken),
+					),
+				)
+				return
+			}
+			fail(c, log, op, err)
+			return
+		}
+
+		log.Info(
+			"success handle restore link",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusOK,
+			NewResponse(
+				SetStatus(httpServer.StatusOK),
+				SetShortUrl(httpServer.Path+username+"/"+link.Alias),
+			),
+		)
+	}
+}
+
+// Purge deletes a link from the trash permanently
+func Purge(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "http-server.trash.Purge"
+
+		req, ok := decode(c, log, op)
+		if !ok {
+			return
+		}
+
+		username := c.GetString("username")
+
+		log.Debug(
+			"try to handle purge request",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+
+		if err := svc.Purge(c, username, req.Alias); err != nil {
+			fail(c, log, op, err)
+			return
+		}
+
+		log.Info(
+			"success handle purge link",
+			slog.String("username", username),
+			slog.String("alias", req.Alias),
+			slog.String("op", op),
+		)
+		c.JSON(http.StatusOK, NewResponse(SetStatus(httpServer.StatusOK)))
+	}
+}
+
+func decode(c *gin.Context, log *slog.Logger, op string) (Request, bool) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error(
+			fmt.Sprintf("%s: %s", "failed to decode request", err.Error()),
+			slog.String("op", op),
+		)
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.BadRequest),
+			),
+		)
+		return Request{}, false
+	}
+
+	return req, true
+}
+
+// fail answers errors shared by Restore and Purge
+func fail(c *gin.Context, log *slog.Logger, op string, err error) {
+	if errors.Is(err, service.ErrAliasNotFound) {
+		log.Info("alias not found in trash", slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.AliasNotFound),
+			),
+		)
+		return
+	}
+	if errors.Is(err, service.ErrEmptyAlias) || errors.Is(err, service.ErrEmptyUsername) {
+		log.Error(err.Error(), slog.String("op", op))
+		c.JSON(
+			http.StatusBadRequest,
+			NewResponse(
+				SetStatus(httpServer.StatusError),
+				SetError(httpServer.BadRequest),
+			),
+		)
+		return
+	}
+
+	log.Error(err.Error(), slog.String("op", op))
+	c.JSON(
+		http.StatusInternalServerError,
+		NewResponse(
+			SetStatus(httpServer.StatusError),
+			SetError(httpServer.InternalError),
+		),
+	)
+}
@@ -6,8 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	httpServer "url-shortener/internal/http-server"
-	"url-shortener/internal/lib/random"
-	"url-shortener/internal/storage"
+	"url-shortener/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -53,7 +52,7 @@ func NewResponse(decorators ...Decorator) Response {
 	return resp
 }
 
-func Update(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
+func Update(log *slog.Logger, svc *service.Shortener) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "http-server.Update"
 		var req Request
@@ -73,22 +72,6 @@ func Update(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			return
 		}
 
-		if req.NewAlias == "" {
-			newAlias := random.Alias()
-			if newAlias == "" {
-				log.Error("failed to generate newAlias", slog.String("op", op))
-				c.JSON(
-					http.StatusInternalServerError,
-					NewResponse(
-						SetStatus(httpServer.StatusError),
-						SetError(httpServer.InternalError),
-					),
-				)
-				return
-			}
-			req.NewAlias = newAlias
-		}
-
 		username := c.GetString("username")
 
 		log.Debug(
@@ -99,38 +82,39 @@ func Update(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			slog.String("op", op),
 		)
 
-		err := s.UpdateAlias(c, username, req.Alias, req.NewAlias)
+		newAlias, err := svc.Rename(c, username, req.Alias, req.NewAlias)
 		if err != nil {
-			if errors.Is(err, storage.ErrCacheUpdate) {
-				// failed to update alias in cache
-				log.Error(err.Error(), slog.String("op", op))
+			if errors.Is(err, service.ErrAliasNotFound) {
+				log.Info("alias not found", slog.String("op", op))
 				c.JSON(
-					http.StatusOK,
+					http.StatusBadRequest,
 					NewResponse(
-						SetStatus(httpServer.StatusOK),
-						SetNewAlias(httpServer.Path+req.NewAlias),
+						SetStatus(httpServer.StatusError),
+						SetError(httpServer.AliasNotFound),
 					),
 				)
 				return
 			}
-			if errors.Is(err, storage.ErrAliasNotFound) {
-				log.Info("alias not found", slog.String("op", op))
+			if errors.Is(err, service.ErrNewAliasAlreadyExists) {
+				log.Info("new alias already exists", slog.String("op", op))
 				c.JSON(
 					http.StatusBadRequest,
 					NewResponse(
 						SetStatus(httpServer.StatusError),
-						SetError(httpServer.AliasNotFound),
+						SetError(httpServer.NewAliasAlreadyExists),
 					),
 				)
 				return
 			}
-			if errors.Is(err, storage.ErrNewAliasAlreadyExists) {
-				log.Info("new alias already exists", slog.String("op", op))
+			if errors.Is(err, service.ErrEmptyAlias) ||
+				errors.Is(err, service.ErrEmptyUsername) ||
+				errors.Is(err, service.ErrInvalidAlias) {
+				log.Error(err.Error(), slog.String("op", op))
 				c.JSON(
 					http.StatusBadRequest,
 					NewResponse(
 						SetStatus(httpServer.StatusError),
-						SetError(httpServer.NewAliasAlreadyExists),
+						SetError(httpServer.BadRequest),
 					),
 				)
 				return
@@ -140,7 +124,7 @@ func Update(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 				slog.String("op", op),
 			)
 			c.JSON(
-				http.StatusBadRequest,
+				http.StatusInternalServerError,
 				NewResponse(
 					SetStatus(httpServer.StatusError),
 					SetError(httpServer.InternalError),
@@ -158,7 +142,7 @@ func Update(log *slog.Logger, s storage.Storage) gin.HandlerFunc {
 			http.StatusOK,
 			NewResponse(
 				SetStatus(httpServer.StatusOK),
-				SetNewAlias(httpServer.Path+username+"/"+req.NewAlias),
+				SetNewAlias(httpServer.Path+username+"/"+newAlias),
 			),
 		)
 	}
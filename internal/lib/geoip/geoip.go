@@ -0,0 +1,372 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+var (
+	ErrInvalidDatabase = errors.New("invalid MaxMind database")
+	ErrNotFound        = errors.New("address not found in database")
+)
+
+// metadataStart marks the beginning of the metadata at the end of the file
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the size of zero bytes between the search tree and the data section
+const dataSectionSeparator = 16
+
+// maxDepth limits nesting of decoded values, so a broken file cannot loop through pointers forever
+const maxDepth = 32
+
+// Reader looks up countries in a MaxMind DB file, such as GeoLite2 Country or City.
+// The whole file is kept in memory and is never changed, so Reader is safe for concurrent use
+type Reader struct {
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads the database at {path}
+func Open(path string) (*Reader, error) {
+	const op = "geoip.Open"
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return r, nil
+}
+
+// New parses the database kept in {buf}
+func New(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataStart)
+	if start == -1 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+
+	meta, _, err := decoder{buf: buf[start+len(metadataStart):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %w", ErrInvalidDatabase, err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{
+		nodeCount:  metaUint(m, "node_count"),
+		recordSize: metaUint(m, "record_size"),
+		ipVersion:  metaUint(m, "ip_version"),
+	}
+
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start) {
+		return nil, fmt.Errorf("%w: search tree is out of file", ErrInvalidDatabase)
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+dataSectionSeparator : start]}
+
+	// IPv4 addresses are stored in IPv6 databases as ::a.b.c.d
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of {addr},
+// falling back to the country the network is registered in
+func (r *Reader) Country(addr netip.Addr) (string, error) {
+	const op = "geoip.Country"
+
+	offset, err := r.lookup(addr)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	value, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %w", op, ErrInvalidDatabase, err)
+	}
+
+	record, _ := value.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]any)
+		if code, _ := country["iso_code"].(string); code != "" {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", op, ErrNotFound)
+}
+
+// lookup walks the search tree by bits of {addr} and returns offset of its record in the data section
+func (r *Reader) lookup(addr netip.Addr) (int, error) {
+	addr = addr.Unmap()
+
+	var (
+		ip   []byte
+		node uint
+	)
+	switch {
+	case addr.Is4():
+		ip = addr.AsSlice()
+		node = r.ipv4Start
+	case addr.Is6() && r.ipVersion == 6:
+		ip = addr.AsSlice()
+	default:
+		return 0, ErrNotFound
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	if node <= r.nodeCount {
+		return 0, ErrNotFound
+	}
+
+	return int(node - r.nodeCount - dataSectionSeparator), nil
+}
+
+// record returns the left (bit 0) or the right (bit 1) record of {node}
+func (r *Reader) record(node, bit uint) uint {
+	b := r.tree[node*r.recordSize/4:]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func metaUint(m map[string]any, key string) uint {
+	v, _ := m[key].(uint64)
+	return uint(v)
+}
+
+// Data section types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder decodes values of the data section, pointers are offsets in {buf}
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at {offset} and offset of the value following it
+func (d decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("values are nested too deep")
+	}
+
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	offset++
+
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if typ == typeExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + int(b[0])
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			m[k], offset, err = d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			var value any
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	b, err = d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("unsigned integer of %d bytes", size)
+		}
+		return uintFrom(b), offset, nil
+	case typeUint128:
+		// too big for any field needed here, kept as raw bytes
+		return bytes.Clone(b), offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("int32 of %d bytes", size)
+		}
+		return int32(uint32(uintFrom(b))), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported type %d", typ)
+	}
+}
+
+// size returns the payload size of the value with {ctrl} byte, reading extended sizes at {offset}
+func (d decoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	extra := int(uintFrom(b))
+	switch size {
+	case 29:
+		return 29 + extra, offset + n, nil
+	case 30:
+		return 285 + extra, offset + n, nil
+	default:
+		return 65821 + extra, offset + n, nil
+	}
+}
+
+// pointer returns the offset a pointer with {ctrl} byte points to and offset of the value following it
+func (d decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&0x3) + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v := uint(ctrl & 0x7)
+	switch n {
+	case 1:
+		return int(v<<8 | uint(b[0])), offset + n, nil
+	case 2:
+		return int(v<<16|uint(uintFrom(b))) + 2048, offset + n, nil
+	case 3:
+		return int(v<<24|uint(uintFrom(b))) + 526336, offset + n, nil
+	default:
+		return int(uintFrom(b)), offset + n, nil
+	}
+}
+
+func (d decoder) bytes(offset, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+n > len(d.buf) {
+		return nil, errors.New("value is out of data section")
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+func uintFrom(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,155 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_Country(t *testing.T) {
+	r, err := New(buildDatabase(t))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		addr        string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "country",
+			addr:     "1.2.3.4",
+			expected: "DE",
+		},
+		{
+			name:     "registered country",
+			addr:     "5.6.7.8",
+			expected: "US",
+		},
+		{
+			name:     "ipv4 mapped ipv6",
+			addr:     "::ffff:1.2.3.200",
+			expected: "DE",
+		},
+		{
+			name:        "not in database",
+			addr:        "1.2.4.1",
+			expectedErr: ErrNotFound,
+		},
+		{
+			name:        "ipv6 in ipv4 database",
+			addr:        "2001:db8::1",
+			expectedErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			country, err := r.Country(netip.MustParseAddr(tt.addr))
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, country)
+		})
+	}
+}
+
+func TestNew_InvalidDatabase(t *testing.T) {
+	_, err := New([]byte("not a database"))
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+
+	db := buildDatabase(t)
+	_, err = New(db[len(db)-len(metadataStart)-10:])
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+}
+
+// buildDatabase returns an IPv4 database with 24 bit records where
+// 1.2.3.0/24 is in DE and 5.6.0.0/16 is registered in US
+func buildDatabase(t *testing.T) []byte {
+	t.Helper()
+
+	var data bytes.Buffer
+	de := data.Len()
+	writeMap(&data, 1)
+	writeString(&data, "country")
+	writeMap(&data, 1)
+	isoCode := data.Len()
+	writeString(&data, "iso_code")
+	writeString(&data, "DE")
+
+	us := data.Len()
+	writeMap(&data, 1)
+	writeString(&data, "registered_country")
+	writeMap(&data, 1)
+	// the key is shared with the first record by a pointer, as real databases do
+	data.Write([]byte{typePointer<<5 | byte(isoCode>>8), byte(isoCode)})
+	writeString(&data, "US")
+
+	type node struct {
+		children [2]*node
+		data     int
+	}
+	root := &node{data: -1}
+	insert := func(prefix netip.Prefix, offset int) {
+		n, ip := root, prefix.Addr().As4()
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = &node{data: -1}
+			}
+			n = n.children[bit]
+		}
+		n.data = offset
+	}
+	insert(netip.MustParsePrefix("1.2.3.0/24"), de)
+	insert(netip.MustParsePrefix("5.6.0.0/16"), us)
+
+	var nodes []*node
+	index := map[*node]int{}
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.data == -1 {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var db bytes.Buffer
+	for _, n := range nodes {
+		for _, c := range n.children {
+			record := len(nodes)
+			if c != nil && c.data != -1 {
+				record = len(nodes) + dataSectionSeparator + c.data
+			} else if c != nil {
+				record = index[c]
+			}
+			db.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	db.Write(make([]byte, dataSectionSeparator))
+	db.Write(data.Bytes())
+
+	db.Write(metadataStart)
+	writeMap(&db, 3)
+	writeString(&db, "node_count")
+	db.Write([]byte{typeUint32<<5 | 2, byte(len(nodes) >> 8), byte(len(nodes))})
+	writeString(&db, "record_size")
+	db.Write([]byte{typeUint16<<5 | 1, 24})
+	writeString(&db, "ip_version")
+	db.Write([]byte{typeUint16<<5 | 1, 4})
+
+	return db.Bytes()
+}
+
+func writeMap(b *bytes.Buffer, pairs int) {
+	b.WriteByte(typeMap<<5 | byte(pairs))
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte(typeString<<5 | byte(len(s)))
+	b.WriteString(s)
+}
@@ -0,0 +1,314 @@
+package qr
+
+// matrix is a code under construction, function modules are finder, timing, alignment,
+// format and version patterns that are never masked
+type matrix struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newMatrix(version int) *matrix {
+	size := version*4 + 17
+	m := &matrix{
+		version:  version,
+		size:     size,
+		modules:  make([][]bool, size),
+		function: make([][]bool, size),
+	}
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.function[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *matrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+func (m *matrix) drawFunctionPatterns(level Level) {
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	m.drawFinder(3, 3)
+	m.drawFinder(m.size-4, 3)
+	m.drawFinder(3, m.size-4)
+
+	positions := alignmentPositions(m.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// the corners are taken by finder patterns
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			m.drawAlignment(x, y)
+		}
+	}
+
+	// reserves format modules, they are drawn again with the chosen mask
+	m.drawFormat(level, 0)
+	m.drawVersion()
+}
+
+// drawFinder draws a finder pattern with its separator around the center {x}, {y}
+func (m *matrix) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= m.size || yy < 0 || yy >= m.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			m.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (m *matrix) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns centers of alignment patterns by both axes
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	num := version/7 + 2
+	step := (version*8 + num*3 + 5) / (num*4 - 4) * 2
+
+	result := make([]int, num)
+	result[0] = 6
+	for i, pos := num-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+var formatLevelBits = [4]int{L: 1, M: 0, Q: 3, H: 2}
+
+// formatBits returns 15 bits of {level} and {mask} protected by a BCH code
+func formatBits(level Level, mask int) int {
+	data := formatLevelBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns 18 bits of {version} protected by a BCH code
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func (m *matrix) drawFormat(level Level, mask int) {
+	bits := formatBits(level, mask)
+
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(bits, i))
+	}
+	m.setFunction(8, 7, bit(bits, 6))
+	m.setFunction(8, 8, bit(bits, 7))
+	m.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(bits, i))
+	}
+	m.setFunction(8, m.size-8, true)
+}
+
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+
+	bits := versionBits(m.version)
+
+	for i := 0; i < 18; i++ {
+		a, b := m.size-11+i%3, i/3
+		m.setFunction(a, b, bit(bits, i))
+		m.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places {data} in the zigzag order from the bottom right corner
+func (m *matrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		// the vertical timing pattern is skipped
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if !m.function[y][x] && i < len(data)*8 {
+					m.modules[y][x] = bit(int(data[i/8]), 7-i%8)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty and draws its format
+func (m *matrix) applyBestMask(level Level) {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormat(level, mask)
+		if p := m.penalty(); bestPenalty == -1 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		// masking twice restores the modules
+		m.applyMask(mask)
+	}
+
+	m.applyMask(best)
+	m.drawFormat(level, best)
+}
+
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			default:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			m.modules[y][x] = m.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty scores how hard the code is to read, following the four rules of the standard
+func (m *matrix) penalty() int {
+	const (
+		n1 = 3
+		n2 = 3
+		n3 = 40
+		n4 = 10
+	)
+
+	score := 0
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			return m.modules[x][y]
+		}
+		return m.modules[y][x]
+	}
+
+	for _, transposed := range []bool{false, true} {
+		for y := 0; y < m.size; y++ {
+			run := 1
+			for x := 1; x <= m.size; x++ {
+				if x < m.size && at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += n1 + run - 5
+				}
+				run = 1
+			}
+
+			for x := 0; x+11 <= m.size; x++ {
+				if matchesFinderLike(func(i int) bool { return at(x+i, y, transposed) }) {
+					score += n3
+				}
+			}
+		}
+	}
+
+	for y := 0; y+1 < m.size; y++ {
+		for x := 0; x+1 < m.size; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				score += n2
+			}
+		}
+	}
+
+	dark := 0
+	for _, row := range m.modules {
+		for _, c := range row {
+			if c {
+				dark++
+			}
+		}
+	}
+	total := m.size * m.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	score += k * n4
+
+	return score
+}
+
+var (
+	finderLikeBefore = [11]bool{false, false, false, false, true, false, true, true, true, false, true}
+	finderLikeAfter  = [11]bool{true, false, true, true, true, false, true, false, false, false, false}
+)
+
+// matchesFinderLike reports whether 11 modules look like a finder pattern with light space on one side
+func matchesFinderLike(at func(i int) bool) bool {
+	before, after := true, true
+	for i := 0; i < 11; i++ {
+		c := at(i)
+		before = before && c == finderLikeBefore[i]
+		after = after && c == finderLikeAfter[i]
+	}
+	return before || after
+}
+
+func bit(value, i int) bool {
+	return (value>>i)&1 == 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,165 @@
+package qr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapacity(t *testing.T) {
+	// byte mode capacities from the standard
+	tests := []struct {
+		version  int
+		expected [4]int
+	}{
+		{version: 1, expected: [4]int{17, 14, 11, 7}},
+		{version: 2, expected: [4]int{32, 26, 20, 14}},
+		{version: 5, expected: [4]int{106, 84, 60, 44}},
+		{version: 10, expected: [4]int{271, 213, 151, 119}},
+		{version: 40, expected: [4]int{2953, 2331, 1663, 1273}},
+	}
+
+	for _, tt := range tests {
+		for level := L; level <= H; level++ {
+			capacity := (dataCodewords(tt.version, level)*8 - 4 - countBits(tt.version)) / 8
+			assert.Equal(t, tt.expected[level], capacity, "version %d level %d", tt.version, level)
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD in version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	assert.Equal(t, expected, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatBits(L, 0))
+	assert.Equal(t, 0b101010000010010, formatBits(M, 0))
+	assert.Equal(t, 0b011010101011111, formatBits(Q, 0))
+	assert.Equal(t, 0b001011010001001, formatBits(H, 0))
+	assert.Equal(t, 0b110011000101111, formatBits(L, 4))
+	assert.Equal(t, 0x07C94, versionBits(7))
+	assert.Equal(t, 0x28C69, versionBits(40))
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		level    Level
+		expected int
+	}{
+		{name: "short link", content: "http://localhost:8081/pasha/docs", level: M, expected: 29},
+		{name: "version with version info", content: strings.Repeat("a", 150), level: M, expected: 49},
+		{name: "blocks of different length", content: strings.Repeat("a", 60), level: Q, expected: 37},
+		{name: "high level", content: "http://localhost:8081/pasha/docs", level: H, expected: 33},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.content, tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, code.Size)
+			assert.Equal(t, tt.content, decode(t, code, tt.level))
+		})
+	}
+
+	_, err := Encode(strings.Repeat("a", 2954), L)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+// decode reads content back from {code}, checking its format modules
+func decode(t *testing.T, code *Code, level Level) string {
+	t.Helper()
+
+	version := (code.Size - 17) / 4
+	m := newMatrix(version)
+	m.drawFunctionPatterns(level)
+
+	format := 0
+	for i := 0; i <= 5; i++ {
+		if code.Dark(8, i) {
+			format |= 1 << i
+		}
+	}
+	mask := -1
+	for candidate := 0; candidate < 8; candidate++ {
+		if formatBits(level, candidate)&0x3F == format {
+			mask = candidate
+		}
+	}
+	require.NotEqual(t, -1, mask, "format modules do not match the level")
+
+	for y := range m.modules {
+		for x := range m.modules {
+			m.modules[y][x] = code.Dark(x, y)
+		}
+	}
+	m.applyMask(mask)
+
+	var bits bitBuffer
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if !m.function[y][x] {
+					bits = append(bits, m.modules[y][x])
+				}
+			}
+		}
+	}
+	interleaved := bits.bytes()
+
+	numBlocks, eccLen := eccBlocks[level][version], eccPerBlock[level][version]
+	raw := rawModules(version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen+1; i++ {
+		for j := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				blocks[j] = append(blocks[j], interleaved[k])
+				k++
+			}
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		n := shortLen - eccLen
+		if j >= numShort {
+			n++
+		}
+		require.Equal(t, rsRemainder(block[:n], rsDivisor(eccLen)), block[n:], "block %d is corrupted", j)
+		data = append(data, block[:n]...)
+	}
+
+	var payload bitBuffer
+	for _, b := range data {
+		payload.append(int(b), 8)
+	}
+	require.Equal(t, bitBuffer{false, true, false, false}, payload[:4], "not byte mode")
+
+	length := 0
+	for _, b := range payload[4 : 4+countBits(version)] {
+		length <<= 1
+		if b {
+			length |= 1
+		}
+	}
+
+	return string(payload[4+countBits(version) : 4+countBits(version)+8*length].bytes())
+}
@@ -0,0 +1,91 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+var ErrTooSmall = errors.New("image is too small for the code")
+
+// Style is how a code is rendered
+type Style struct {
+	// Size is the width and height of the image in pixels
+	Size int
+	// Margin is the light border around the code in modules, readers need at least 4
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// scale returns pixels per module and the offset centering the code in the image,
+// modules are whole pixels so the code stays sharp
+func (c *Code) scale(style Style) (int, int, error) {
+	modules := c.Size + 2*style.Margin
+	scale := style.Size / modules
+	if scale < 1 {
+		return 0, 0, fmt.Errorf("%w: %d modules in %d pixels", ErrTooSmall, modules, style.Size)
+	}
+
+	return scale, (style.Size-scale*modules)/2 + scale*style.Margin, nil
+}
+
+// PNG writes the code as a PNG image
+func (c *Code) PNG(w io.Writer, style Style) error {
+	scale, offset, err := c.scale(style)
+	if err != nil {
+		return err
+	}
+
+	img := image.NewPaletted(
+		image.Rect(0, 0, style.Size, style.Size),
+		color.Palette{style.Background, style.Foreground},
+	)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(offset+y*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[offset+x*scale+dx] = 1
+				}
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// SVG writes the code as an SVG image, runs of dark modules in a row are drawn as one rectangle
+func (c *Code) SVG(w io.Writer, style Style) error {
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			start := x
+			for x+1 < c.Size && c.Dark(x+1, y) {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+style.Margin, y+style.Margin, x-start+1, x-start+1)
+		}
+	}
+
+	modules := c.Size + 2*style.Margin
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="%s"/><path fill="%s" d="%s"/></svg>`,
+		style.Size, style.Size, modules, modules, hex(style.Background), hex(style.Foreground), path.String(),
+	)
+	return err
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,33 @@
+package requestid
+
+import "url-shortener/internal/lib/random"
+
+const (
+	// MaxLength bounds request ids taken from clients, longer ones are replaced
+	MaxLength = 128
+	length    = 32
+)
+
+// Take returns {id} sent by a client if it is valid, or a new one.
+// Client ids end up in logs and audit events, so only printable ASCII without spaces is kept
+func Take(id string) string {
+	if !Valid(id) {
+		return random.Alias(length)
+	}
+	return id
+}
+
+// Valid reports whether {id} is non-empty, up to MaxLength bytes and printable ASCII without spaces
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		kept bool
+	}{
+		{name: "valid", id: "req-1", kept: true},
+		{name: "empty", id: ""},
+		{name: "too long", id: strings.Repeat("a", MaxLength+1)},
+		{name: "space", id: "req 1"},
+		{name: "control character", id: "req\n1"},
+		{name: "non ascii", id: "req-ё"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := Take(tt.id)
+			assert.True(t, Valid(id))
+			if tt.kept {
+				assert.Equal(t, tt.id, id)
+			} else {
+				assert.NotEqual(t, tt.id, id)
+			}
+		})
+	}
+}
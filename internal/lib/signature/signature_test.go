@@ -0,0 +1,66 @@
+package signature
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token := Sign(secret, "pasha/docs", now.Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		secret   []byte
+		value    string
+		token    string
+		now      time.Time
+		expected bool
+	}{
+		{
+			name:     "valid",
+			secret:   secret,
+			value:    "pasha/docs",
+			token:    token,
+			now:      now,
+			expected: true,
+		},
+		{
+			name:   "expired",
+			secret: secret,
+			value:  "pasha/docs",
+			token:  token,
+			now:    now.Add(2 * time.Hour),
+		},
+		{
+			name:   "other value",
+			secret: secret,
+			value:  "pasha/lms",
+			token:  token,
+			now:    now,
+		},
+		{
+			name:   "other secret",
+			secret: []byte("guess"),
+			value:  "pasha/docs",
+			token:  token,
+			now:    now,
+		},
+		{
+			name:   "malformed",
+			secret: secret,
+			value:  "pasha/docs",
+			token:  "token",
+			now:    now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Verify(tt.secret, tt.value, tt.token, tt.now))
+		})
+	}
+}
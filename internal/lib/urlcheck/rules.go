@@ -0,0 +1,141 @@
+package urlcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Rules is a blocklist. A rule is either a domain, blocking the domain and all its subdomains,
+// or a pattern containing "/" or "*", matched against host and path of the url where "*" matches any characters.
+// Empty lines and lines starting with "#" are ignored
+type Rules struct {
+	domains  map[string]struct{}
+	patterns []string
+}
+
+// ParseRules reads rules one per line from {r}
+func ParseRules(r io.Reader) (*Rules, error) {
+	rules := &Rules{domains: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules.add(line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (r *Rules) add(rule string) {
+	// patterns match urls of any scheme
+	if _, rest, ok := strings.Cut(rule, "://"); ok {
+		rule = rest
+	}
+
+	if strings.ContainsAny(rule, "/*") {
+		r.patterns = append(r.patterns, rule)
+		return
+	}
+	r.domains[strings.TrimSuffix(rule, ".")] = struct{}{}
+}
+
+// Len returns the number of rules
+func (r *Rules) Len() int {
+	return len(r.domains) + len(r.patterns)
+}
+
+// Added returns rules of {r} missing in {old}
+func (r *Rules) Added(old *Rules) *Rules {
+	added := &Rules{domains: make(map[string]struct{})}
+
+	for domain := range r.domains {
+		if _, ok := old.domains[domain]; !ok {
+			added.domains[domain] = struct{}{}
+		}
+	}
+
+	known := make(map[string]struct{}, len(old.patterns))
+	for _, p := range old.patterns {
+		known[p] = struct{}{}
+	}
+	for _, p := range r.patterns {
+		if _, ok := known[p]; !ok {
+			added.patterns = append(added.patterns, p)
+		}
+	}
+
+	return added
+}
+
+// Match reports whether {rawURL} is blocked by any of the rules, urls that cannot be parsed never match
+func (r *Rules) Match(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return r.match(u)
+}
+
+func (r *Rules) match(u *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	for domain := host; domain != ""; {
+		if _, ok := r.domains[domain]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+
+	target := host + strings.ToLower(u.EscapedPath())
+	for _, p := range r.patterns {
+		if glob(p, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// glob matches {s} against {pattern} where "*" matches any sequence of characters, "/" included
+func glob(pattern, s string) bool {
+	// the position after the last star and the position in {s} it was tried at, to backtrack to
+	star, next := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p+1, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star != -1:
+			next++
+			p, i = star, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
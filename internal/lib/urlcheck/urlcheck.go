@@ -0,0 +1,241 @@
+package urlcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrScheme         = errors.New("only http and https urls are allowed")
+	ErrPrivateNetwork = errors.New("url points to a private network")
+	ErrBlocked        = errors.New("url is blocklisted")
+)
+
+// Checker rejects urls with other schemes than http and https, urls pointing to loopback,
+// private and link-local networks, and urls matching the blocklist file.
+// The file is read again by Reload when it changes
+type Checker struct {
+	path string
+	// lookup resolves host names to check the addresses they point to, nil leaves host names unresolved
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	mu      sync.RWMutex
+	rules   *Rules
+	modTime time.Time
+	size    int64
+}
+
+// New returns a checker with rules read from the blocklist at {path}, no blocklist is used if it is empty.
+// With {resolve} host names are resolved and rejected if any of their addresses is private
+func New(path string, resolve bool) (*Checker, error) {
+	c := &Checker{path: path, rules: &Rules{domains: make(map[string]struct{})}}
+	if resolve {
+		c.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		}
+	}
+
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Check returns an error wrapping ErrScheme, ErrPrivateNetwork or ErrBlocked if {rawURL} is not allowed
+func (c *Checker) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrScheme, err)
+	}
+
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateNetwork, host)
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil && endsInNumber(host) {
+		// browsers and resolvers read hosts like 2130706433, 0x7f000001 or 127.1 as IPv4 addresses
+		if addr, err = parseIPv4(host); err != nil {
+			return fmt.Errorf("%w: %s is not a valid address", ErrPrivateNetwork, host)
+		}
+	}
+
+	if err == nil {
+		if isPrivate(addr) {
+			return fmt.Errorf("%w: %s", ErrPrivateNetwork, host)
+		}
+	} else if c.lookup != nil {
+		// hosts that do not resolve yet are allowed, they cannot point anywhere
+		addrs, _ := c.lookup(ctx, host)
+		for _, addr := range addrs {
+			if isPrivate(addr) {
+				return fmt.Errorf("%w: %s resolves to %s", ErrPrivateNetwork, host, addr)
+			}
+		}
+	}
+
+	c.mu.RLock()
+	blocked := c.rules.match(u)
+	c.mu.RUnlock()
+
+	if blocked {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, it is not routable on the internet either
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// endsInNumber reports whether the last label of {host} is a number, which makes the whole host an IPv4 address
+// in the URL standard browsers follow
+func endsInNumber(host string) bool {
+	_, err := parseIPv4Part(host[strings.LastIndex(host, ".")+1:])
+	return err == nil
+}
+
+// parseIPv4 parses {host} the way inet_aton does: one to four decimal, octal (leading 0) or hex (leading 0x) parts,
+// the last of which fills the remaining bytes
+func parseIPv4(host string) (netip.Addr, error) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, errors.New("too many parts")
+	}
+
+	var ip uint64
+	for i, part := range parts {
+		n, err := parseIPv4Part(part)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+
+		last := i == len(parts)-1
+		if !last && n > 0xff || last && n >= 1<<(8*(5-len(parts))) {
+			return netip.Addr{}, fmt.Errorf("part %q is out of range", part)
+		}
+
+		if last {
+			ip |= n
+		} else {
+			ip |= n << (8 * (3 - i))
+		}
+	}
+
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), nil
+}
+
+func parseIPv4Part(part string) (uint64, error) {
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, nil
+		}
+	case len(part) > 1 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+
+	if part == "" || part[0] == '+' || part[0] == '-' {
+		return 0, fmt.Errorf("%q is not a number", part)
+	}
+
+	return strconv.ParseUint(part, base, 32)
+}
+
+// Rules returns the rules of the blocklist as last read
+func (c *Checker) Rules() *Rules {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rules
+}
+
+// Reload reads the blocklist again if it changed since the last read and returns rules added to it,
+// nil if nothing changed. The rules are kept as they are if the file cannot be read
+func (c *Checker) Reload() (*Rules, error) {
+	const op = "urlcheck.Reload"
+
+	if c.path == "" {
+		return nil, nil
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime) && info.Size() == c.size
+	c.mu.RUnlock()
+	if unchanged {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rules, err := ParseRules(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.mu.Lock()
+	added := rules.Added(c.rules)
+	c.rules, c.modTime, c.size = rules, info.ModTime(), info.Size()
+	c.mu.Unlock()
+
+	return added, nil
+}
+
+// Watch calls Reload every {interval} until {ctx} is done, passing rules added to the blocklist to {onAdded}
+// and failures to {onError}. Non-positive {interval} disables reloading
+func (c *Checker) Watch(ctx context.Context, interval time.Duration, onAdded func(*Rules), onError func(error)) {
+	if c.path == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			added, err := c.Reload()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			if added != nil && added.Len() > 0 {
+				onAdded(added)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package urlcheck
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules_Match(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# phishing
+evil.com
+https://bank.example/login*
+*/wp-admin/*
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, rules.Len())
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{url: "https://evil.com", expected: true},
+		{url: "http://login.EVIL.com./account", expected: true},
+		{url: "https://notevil.com", expected: false},
+		{url: "https://bank.example/login/reset", expected: true},
+		{url: "http://bank.example/about", expected: false},
+		{url: "https://blog.example/wp-admin/index.php", expected: true},
+		{url: "https://blog.example/wp-admin", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rules.Match(tt.url))
+		})
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+
+	c, err := New(path, false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url         string
+		expectedErr error
+	}{
+		{url: "https://go.dev/doc"},
+		{url: "ftp://go.dev/doc", expectedErr: ErrScheme},
+		{url: "javascript:alert(1)", expectedErr: ErrScheme},
+		{url: "http://localhost:8080", expectedErr: ErrPrivateNetwork},
+		{url: "http://127.0.0.1/admin", expectedErr: ErrPrivateNetwork},
+		{url: "http://192.168.1.1", expectedErr: ErrPrivateNetwork},
+		{url: "http://[::ffff:10.0.0.1]", expectedErr: ErrPrivateNetwork},
+		{url: "http://169.254.169.254/latest/meta-data", expectedErr: ErrPrivateNetwork},
+		{url: "http://100.64.0.1", expectedErr: ErrPrivateNetwork},
+		{url: "http://2130706433/", expectedErr: ErrPrivateNetwork},
+		{url: "http://0x7f000001/", expectedErr: ErrPrivateNetwork},
+		{url: "http://0177.0.0.1/", expectedErr: ErrPrivateNetwork},
+		{url: "http://127.1/", expectedErr: ErrPrivateNetwork},
+		{url: "http://0x0A.0.1/", expectedErr: ErrPrivateNetwork},
+		{url: "http://1.2.3.4.5/", expectedErr: ErrPrivateNetwork},
+		{url: "http://134744072/"},
+		{url: "https://1password.com"},
+		{url: "https://8.8.8.8"},
+		{url: "https://www.evil.com", expectedErr: ErrBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.ErrorIs(t, c.Check(context.Background(), tt.url), tt.expectedErr)
+		})
+	}
+}
+
+func TestChecker_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+
+	c, err := New(path, false)
+	require.NoError(t, err)
+
+	added, err := c.Reload()
+	require.NoError(t, err)
+	assert.Nil(t, added)
+
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\nworse.com\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	added, err = c.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 1, added.Len())
+	assert.True(t, added.Match("https://worse.com"))
+	assert.False(t, added.Match("https://evil.com"))
+	assert.ErrorIs(t, c.Check(context.Background(), "https://worse.com"), ErrBlocked)
+
+	require.NoError(t, os.Remove(path))
+	_, err = c.Reload()
+	assert.Error(t, err)
+	assert.ErrorIs(t, c.Check(context.Background(), "https://worse.com"), ErrBlocked)
+}
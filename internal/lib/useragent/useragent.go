@@ -0,0 +1,51 @@
+package useragent
+
+import "strings"
+
+// Platforms a client is classified as
+const (
+	IOS     = "ios"
+	Android = "android"
+	Desktop = "desktop"
+	Bot     = "bot"
+)
+
+// botMarkers are substrings of lowercase User-Agent of crawlers, link previews and http libraries
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit", "embedly", "preview",
+	"headless", "curl/", "wget/", "python-requests", "go-http-client", "okhttp", "java/",
+}
+
+// IsPlatform reports whether {platform} is one of the results of Classify
+func IsPlatform(platform string) bool {
+	switch platform {
+	case IOS, Android, Desktop, Bot:
+		return true
+	}
+	return false
+}
+
+// Classify returns the platform of a client by its User-Agent header.
+// Bots are detected first, because some crawlers pretend to be mobile browsers.
+// Everything that is not a bot or a mobile device is Desktop
+func Classify(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if strings.TrimSpace(ua) == "" {
+		return Bot
+	}
+
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return Bot
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return IOS
+	case strings.Contains(ua, "android"):
+		return Android
+	}
+
+	return Desktop
+}
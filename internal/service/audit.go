@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"url-shortener/internal/storage"
+)
+
+// Audited actions
+const (
+	ActionSave     = "save"
+	ActionUpdate   = "update"
+	ActionEdit     = "edit"
+	ActionDelete   = "delete"
+	ActionRestore  = "restore"
+	ActionPurge    = "purge"
+	ActionRollback = "rollback"
+	// ActionDisable and ActionEnable are admin changes of the disabled state, owners change it with ActionEdit
+	ActionDisable = "disable"
+	ActionEnable  = "enable"
+)
+
+// ActorBlocklist is the caller of changes made when the blocklist is reloaded
+const ActorBlocklist = "blocklist"
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+var (
+	ErrInvalidAuditLimit = fmt.Errorf("limit must be between 1 and %d", MaxAuditLimit)
+	ErrInvalidCursor     = errors.New("cursor is not an audit event id")
+)
+
+// Caller is who makes a request and from where, transports put it into the context with WithCaller
+type Caller struct {
+	Username  string
+	IP        string
+	RequestID string
+}
+
+type callerKey struct{}
+
+// WithCaller puts {caller} into {ctx}, it is the actor of audit events and the author of link history entries
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	ctx = storage.WithActor(ctx, caller.Username)
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller put by WithCaller, a zero Caller if there is none
+func CallerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	return caller
+}
+
+// AuditEvents returns audit events matching {filter}, newest first.
+// Zero limit of {filter} returns DefaultAuditLimit events
+func (s *Shortener) AuditEvents(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	const op = "service.AuditEvents"
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultAuditLimit
+	}
+
+	if filter.Limit < 0 || filter.Limit > MaxAuditLimit {
+		return nil, ErrInvalidAuditLimit
+	}
+
+	if s.events == nil {
+		return []storage.AuditEvent{}, nil
+	}
+
+	events, err := s.events.ListAuditEvents(ctx, filter)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, ErrInvalidCursor
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// audit records {action} done to {alias} of {username} by the caller from {ctx}.
+// The change is already made, so a failure to record it is logged and not returned
+func (s *Shortener) audit(ctx context.Context, action, username, alias string, before, after *storage.Link) {
+	const op = "service.audit"
+
+	if s.events == nil {
+		return
+	}
+
+	caller := CallerFromContext(ctx)
+	event := storage.AuditEvent{
+		Time:      s.now(),
+		Actor:     caller.Username,
+		Action:    action,
+		Username:  username,
+		Alias:     alias,
+		Before:    snapshot(before),
+		After:     snapshot(after),
+		IP:        caller.IP,
+		RequestID: caller.RequestID,
+	}
+
+	if err := s.events.SaveAuditEvent(ctx, event); err != nil {
+		s.log.Error(
+			err.Error(),
+			slog.String("action", action),
+			slog.String("username", username),
+			slog.String("alias", alias),
+			slog.String("op", op),
+		)
+	}
+}
+
+// before returns the link as it is before a change to record it in the audit log, nil if it cannot be read
+func (s *Shortener) before(ctx context.Context, username, alias string) *storage.Link {
+	if s.events == nil {
+		return nil
+	}
+
+	link, err := s.stored(ctx, username, alias)
+	if err != nil {
+		return nil
+	}
+
+	return &link
+}
+
+// snapshot copies {link} for the audit log without its password hash
+func snapshot(link *storage.Link) *storage.Link {
+	if link == nil {
+		return nil
+	}
+
+	copied := *link
+	copied.PasswordHash = ""
+	return &copied
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAudit struct {
+	events []storage.AuditEvent
+}
+
+func (f *fakeAudit) SaveAuditEvent(_ context.Context, event storage.AuditEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeAudit) ListAuditEvents(context.Context, storage.AuditFilter) ([]storage.AuditEvent, error) {
+	return f.events, nil
+}
+
+func TestShortener_Audit(t *testing.T) {
+	events := &fakeAudit{}
+	svc := newShortener(newFakeStorage())
+	svc.events = events
+	ctx := WithCaller(context.Background(), Caller{Username: "pasha", IP: "10.0.0.1", RequestID: "req-1"})
+
+	_, err := svc.Save(ctx, NewLink{Username: "pasha", Url: "https://stepik.org/learn", Alias: "lms", Password: "secret"})
+	require.NoError(t, err)
+	_, err = svc.Rename(ctx, "pasha", "lms", "stepik")
+	require.NoError(t, err)
+	require.NoError(t, svc.Delete(ctx, "pasha", "stepik"))
+
+	_, err = svc.Rename(ctx, "pasha", "lms", "go")
+	assert.ErrorIs(t, err, ErrAliasNotFound)
+
+	require.Len(t, events.events, 3)
+
+	saved := events.events[0]
+	assert.Equal(t, ActionSave, saved.Action)
+	assert.Equal(t, "pasha", saved.Actor)
+	assert.Equal(t, "10.0.0.1", saved.IP)
+	assert.Equal(t, "req-1", saved.RequestID)
+	assert.Nil(t, saved.Before)
+	require.NotNil(t, saved.After)
+	assert.Empty(t, saved.After.PasswordHash)
+
+	renamed := events.events[1]
+	assert.Equal(t, ActionUpdate, renamed.Action)
+	assert.Equal(t, "lms", renamed.Alias)
+	assert.Equal(t, "lms", renamed.Before.Alias)
+	assert.Equal(t, "stepik", renamed.After.Alias)
+
+	deleted := events.events[2]
+	assert.Equal(t, ActionDelete, deleted.Action)
+	assert.Equal(t, "https://stepik.org/learn", deleted.Before.Url)
+	assert.Nil(t, deleted.After)
+
+	_, err = svc.AuditEvents(context.Background(), storage.AuditFilter{Limit: MaxAuditLimit + 1})
+	assert.ErrorIs(t, err, ErrInvalidAuditLimit)
+}
+
+func TestShortener_AdminDisable(t *testing.T) {
+	events := &fakeAudit{}
+	svc := newShortener(newFakeStorage())
+	svc.events = events
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "go"})
+	require.NoError(t, err)
+
+	ctx := WithCaller(context.Background(), Caller{Username: "admin-cli:root"})
+	link, err := svc.AdminDisable(ctx, "pasha", "go", true, "phishing")
+	require.NoError(t, err)
+	assert.True(t, link.Disabled)
+	assert.Equal(t, storage.DisabledByAdmin, link.DisabledBy)
+
+	link, err = svc.AdminDisable(ctx, "pasha", "go", false, "ignored")
+	require.NoError(t, err)
+	assert.False(t, link.Disabled)
+	assert.Empty(t, link.DisabledReason)
+
+	_, err = svc.AdminDisable(ctx, "pasha", "rust", true, "")
+	assert.ErrorIs(t, err, ErrAliasNotFound)
+
+	require.Len(t, events.events, 3)
+	assert.Equal(t, ActionDisable, events.events[1].Action)
+	assert.Equal(t, "admin-cli:root", events.events[1].Actor)
+	assert.Equal(t, "phishing", events.events[1].After.DisabledReason)
+	assert.Equal(t, ActionEnable, events.events[2].Action)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"url-shortener/internal/storage"
+)
+
+// Query passthrough modes of a link
+const (
+	// QueryDrop ignores the incoming query, it is the default
+	QueryDrop = ""
+	// QueryKeep adds incoming parameters the destination does not have
+	QueryKeep = "keep"
+	// QueryOverride adds incoming parameters replacing the ones of the destination
+	QueryOverride = "override"
+)
+
+var (
+	ErrInvalidQueryMode = errors.New("query_passthrough must be one of keep, override or empty")
+	ErrPathNotAllowed   = errors.New("link does not accept extra path")
+	ErrInvalidPath      = errors.New("extra path is invalid")
+)
+
+// Destination returns the url to redirect to from {link} requested with the extra escaped path {rest}
+// and the raw query {rawQuery}. Both are passed through only if the link allows it,
+// keeping their encoding as it came.
+// UTM parameters of the link and of its user are added unless the url already has them
+func (s *Shortener) Destination(ctx context.Context, link storage.Link, rest, rawQuery string) (string, error) {
+	rest = strings.Trim(rest, "/")
+
+	if rest != "" && !link.PathPassthrough {
+		return "", ErrPathNotAllowed
+	}
+
+	utm := s.user(ctx, link.Username).UTM.Override(link.UTM)
+
+	if rest == "" && (link.QueryPassthrough == QueryDrop || rawQuery == "") && utm.IsZero() {
+		return link.Url, nil
+	}
+
+	u, err := url.Parse(link.Url)
+	if err != nil {
+		return "", err
+	}
+
+	if rest != "" {
+		if err := appendPath(u, rest); err != nil {
+			return "", err
+		}
+	}
+
+	if !utm.IsZero() {
+		u.RawQuery = mergeQuery(u.RawQuery, utmQuery(utm), false)
+	}
+
+	if link.QueryPassthrough != QueryDrop && rawQuery != "" {
+		u.RawQuery = mergeQuery(u.RawQuery, rawQuery, link.QueryPassthrough == QueryOverride)
+	}
+
+	return u.String(), nil
+}
+
+func utmQuery(utm storage.UTM) string {
+	params := []struct{ key, value string }{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	}
+
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.value != "" {
+			pairs = append(pairs, p.key+"="+url.QueryEscape(p.value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// appendPath appends escaped {rest} to the path of {u}.
+// Dot segments are rejected, so the result never leaves the destination path
+func appendPath(u *url.URL, rest string) error {
+	for _, segment := range strings.Split(rest, "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil || unescaped == "" || unescaped == "." || unescaped == ".." {
+			return ErrInvalidPath
+		}
+	}
+
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + rest
+
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return ErrInvalidPath
+	}
+
+	u.Path, u.RawPath = path, escaped
+	return nil
+}
+
+// mergeQuery merges {incoming} into {destination} without re-encoding either of them.
+// On conflicting keys the destination wins unless {override} is set.
+// Incoming parameters that are not correctly escaped are dropped
+func mergeQuery(destination, incoming string, override bool) string {
+	incomingPairs := make([]string, 0)
+	incomingKeys := make(map[string]bool)
+	for _, pair := range strings.Split(incoming, "&") {
+		key, ok := queryKey(pair)
+		if !ok {
+			continue
+		}
+		incomingPairs = append(incomingPairs, pair)
+		incomingKeys[key] = true
+	}
+
+	merged := make([]string, 0)
+	destinationKeys := make(map[string]bool)
+	for _, pair := range strings.Split(destination, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _ := queryKey(pair)
+		if override && incomingKeys[key] {
+			continue
+		}
+		merged = append(merged, pair)
+		destinationKeys[key] = true
+	}
+
+	for _, pair := range incomingPairs {
+		key, _ := queryKey(pair)
+		if !override && destinationKeys[key] {
+			continue
+		}
+		merged = append(merged, pair)
+	}
+
+	return strings.Join(merged, "&")
+}
+
+// queryKey returns the unescaped key of a raw "key=value" pair
+func queryKey(pair string) (string, bool) {
+	if pair == "" || strings.ContainsAny(pair, ";#") {
+		return "", false
+	}
+
+	key, value, _ := strings.Cut(pair, "=")
+
+	key, err := url.QueryUnescape(key)
+	if err != nil || key == "" {
+		return "", false
+	}
+
+	if _, err := url.QueryUnescape(value); err != nil {
+		return "", false
+	}
+
+	return key, true
+}
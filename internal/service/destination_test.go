@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortener_Destination(t *testing.T) {
+	tests := []struct {
+		name        string
+		link        storage.Link
+		rest        string
+		rawQuery    string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "query dropped by default",
+			link:     storage.Link{Url: "https://go.dev/doc?lang=en"},
+			rawQuery: "utm_source=tg",
+			expected: "https://go.dev/doc?lang=en",
+		},
+		{
+			name:     "keep adds missing parameters",
+			link:     storage.Link{Url: "https://go.dev/doc?lang=en", QueryPassthrough: QueryKeep},
+			rawQuery: "utm_source=tg&utm_medium=post",
+			expected: "https://go.dev/doc?lang=en&utm_source=tg&utm_medium=post",
+		},
+		{
+			name:     "keep lets destination win",
+			link:     storage.Link{Url: "https://go.dev/doc?utm_source=site&lang=en", QueryPassthrough: QueryKeep},
+			rawQuery: "utm_source=tg&utm_source=vk&page=2",
+			expected: "https://go.dev/doc?utm_source=site&lang=en&page=2",
+		},
+		{
+			name:     "override lets incoming win",
+			link:     storage.Link{Url: "https://go.dev/doc?utm_source=site&lang=en", QueryPassthrough: QueryOverride},
+			rawQuery: "utm_source=tg&utm_source=vk",
+			expected: "https://go.dev/doc?lang=en&utm_source=tg&utm_source=vk",
+		},
+		{
+			name:     "encoded keys conflict with plain ones",
+			link:     storage.Link{Url: "https://go.dev/doc?utm_source=site", QueryPassthrough: QueryKeep},
+			rawQuery: "utm%5Fsource=tg",
+			expected: "https://go.dev/doc?utm_source=site",
+		},
+		{
+			name:     "encoding is kept as it came",
+			link:     storage.Link{Url: "https://go.dev/search?q=a%2Bb", QueryPassthrough: QueryKeep},
+			rawQuery: "utm_campaign=spring+sale%26more&name=%D0%BF%D0%B0%D1%88%D0%B0",
+			expected: "https://go.dev/search?q=a%2Bb&utm_campaign=spring+sale%26more&name=%D0%BF%D0%B0%D1%88%D0%B0",
+		},
+		{
+			name:     "badly escaped and empty parameters are dropped",
+			link:     storage.Link{Url: "https://go.dev/doc", QueryPassthrough: QueryKeep},
+			rawQuery: "a=%zz&&=x&b=1;c=2&d=4",
+			expected: "https://go.dev/doc?d=4",
+		},
+		{
+			name:     "fragment stays last",
+			link:     storage.Link{Url: "https://go.dev/doc#install", QueryPassthrough: QueryKeep},
+			rawQuery: "utm_source=tg",
+			expected: "https://go.dev/doc?utm_source=tg#install",
+		},
+		{
+			name:     "path appended",
+			link:     storage.Link{Url: "https://go.dev/doc/", PathPassthrough: true},
+			rest:     "/tutorial/getting-started",
+			expected: "https://go.dev/doc/tutorial/getting-started",
+		},
+		{
+			name:     "escaped slash and spaces survive",
+			link:     storage.Link{Url: "https://example.com/files", PathPassthrough: true},
+			rest:     "/a%2Fb/my%20file.txt",
+			expected: "https://example.com/files/a%2Fb/my%20file.txt",
+		},
+		{
+			name:     "path and query together",
+			link:     storage.Link{Url: "https://example.com/files?v=1#top", PathPassthrough: true, QueryPassthrough: QueryOverride},
+			rest:     "/docs",
+			rawQuery: "v=2",
+			expected: "https://example.com/files/docs?v=2#top",
+		},
+		{
+			name:     "trailing slash only is no extra path",
+			link:     storage.Link{Url: "https://go.dev/doc"},
+			rest:     "/",
+			expected: "https://go.dev/doc",
+		},
+		{
+			name:        "extra path not allowed",
+			link:        storage.Link{Url: "https://go.dev/doc"},
+			rest:        "/tutorial",
+			expectedErr: ErrPathNotAllowed,
+		},
+		{
+			name:        "dot segments rejected",
+			link:        storage.Link{Url: "https://example.com/files", PathPassthrough: true},
+			rest:        "/a/../../admin",
+			expectedErr: ErrInvalidPath,
+		},
+		{
+			name:        "encoded dot segments rejected",
+			link:        storage.Link{Url: "https://example.com/files", PathPassthrough: true},
+			rest:        "/%2e%2e/admin",
+			expectedErr: ErrInvalidPath,
+		},
+		{
+			name:        "badly escaped path rejected",
+			link:        storage.Link{Url: "https://example.com/files", PathPassthrough: true},
+			rest:        "/a%zz",
+			expectedErr: ErrInvalidPath,
+		},
+	}
+
+	svc := newShortener(newFakeStorage())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := svc.Destination(context.Background(), tt.link, tt.rest, tt.rawQuery)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, destination)
+		})
+	}
+}
+
+func TestShortener_DestinationUTM(t *testing.T) {
+	users := fakeUsers{
+		"marketing": {Username: "marketing", UTM: storage.UTM{Source: "site", Medium: "referral"}},
+	}
+
+	tests := []struct {
+		name     string
+		link     storage.Link
+		rawQuery string
+		expected string
+	}{
+		{
+			name:     "user defaults",
+			link:     storage.Link{Username: "marketing", Url: "https://go.dev/doc"},
+			expected: "https://go.dev/doc?utm_source=site&utm_medium=referral",
+		},
+		{
+			name: "link overrides user defaults",
+			link: storage.Link{
+				Username: "marketing",
+				Url:      "https://go.dev/doc",
+				UTM:      storage.UTM{Medium: "email", Campaign: "spring sale"},
+			},
+			expected: "https://go.dev/doc?utm_source=site&utm_medium=email&utm_campaign=spring+sale",
+		},
+		{
+			name:     "url parameters win",
+			link:     storage.Link{Username: "marketing", Url: "https://go.dev/doc?utm_source=blog"},
+			expected: "https://go.dev/doc?utm_source=blog&utm_medium=referral",
+		},
+		{
+			name:     "incoming query overrides utm",
+			link:     storage.Link{Username: "marketing", Url: "https://go.dev/doc", QueryPassthrough: QueryOverride},
+			rawQuery: "utm_source=tg",
+			expected: "https://go.dev/doc?utm_medium=referral&utm_source=tg",
+		},
+		{
+			name:     "user without defaults",
+			link:     storage.Link{Username: "pasha", Url: "https://go.dev/doc"},
+			expected: "https://go.dev/doc",
+		},
+	}
+
+	svc := newShortenerWithUsers(newFakeStorage(), users)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := svc.Destination(context.Background(), tt.link, "", tt.rawQuery)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, destination)
+		})
+	}
+
+	t.Run("defaults changed centrally", func(t *testing.T) {
+		now := time.Now()
+		svc.now = func() time.Time { return now }
+		link := storage.Link{Username: "marketing", Url: "https://go.dev"}
+
+		_, err := svc.Destination(context.Background(), link, "", "")
+		assert.NoError(t, err)
+
+		users["marketing"] = storage.User{Username: "marketing", UTM: storage.UTM{Source: "newsletter"}}
+
+		destination, _ := svc.Destination(context.Background(), link, "", "")
+		assert.Equal(t, "https://go.dev?utm_source=site&utm_medium=referral", destination)
+
+		now = now.Add(userTTL)
+		destination, _ = svc.Destination(context.Background(), link, "", "")
+		assert.Equal(t, "https://go.dev?utm_source=newsletter", destination)
+	})
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"url-shortener/internal/storage"
+)
+
+var (
+	ErrDisabledByAdmin  = errors.New("link is disabled by admin")
+	ErrDisabledAsUnsafe = errors.New("link is disabled as unsafe")
+)
+
+// MaxDisabledReasonLength limits the reason shown on the page of a disabled link
+const MaxDisabledReasonLength = 500
+
+var ErrDisabledReasonTooLong = fmt.Errorf("disabled reason is longer than %d characters", MaxDisabledReasonLength)
+
+// ownerDisable fills who disabled the link and why for an owner {patch} disabling or enabling it.
+// Owners cannot touch the disabled state of links disabled by admins or as unsafe, only admins enable them
+func (s *Shortener) ownerDisable(ctx context.Context, username, alias string, patch *storage.LinkPatch) error {
+	if patch.Disabled == nil {
+		patch.DisabledBy, patch.DisabledReason = nil, nil
+		return nil
+	}
+
+	var by, reason string
+	if *patch.Disabled {
+		by = storage.DisabledByOwner
+		if patch.DisabledReason != nil {
+			reason = *patch.DisabledReason
+		}
+	}
+	if len([]rune(reason)) > MaxDisabledReasonLength {
+		return ErrDisabledReasonTooLong
+	}
+
+	link, err := s.stored(ctx, username, alias)
+	if err != nil {
+		return err
+	}
+
+	if link.Disabled {
+		switch link.DisabledBy {
+		case storage.DisabledByAdmin:
+			return ErrDisabledByAdmin
+		case storage.DisabledBySafety:
+			return ErrDisabledAsUnsafe
+		}
+	}
+
+	patch.DisabledBy, patch.DisabledReason = &by, &reason
+	return nil
+}
+
+// AdminDisable disables {alias} of {username} as admin with {reason}, or enables it whoever disabled it,
+// and returns the link. The change is audited as ActionDisable or ActionEnable by the caller from {ctx}
+func (s *Shortener) AdminDisable(ctx context.Context, username, alias string, disabled bool, reason string) (storage.Link, error) {
+	const op = "service.AdminDisable"
+
+	if username == "" {
+		return storage.Link{}, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return storage.Link{}, ErrEmptyAlias
+	}
+
+	by, action := "", ActionEnable
+	if disabled {
+		by, action = storage.DisabledByAdmin, ActionDisable
+	} else {
+		reason = ""
+	}
+	if len([]rune(reason)) > MaxDisabledReasonLength {
+		return storage.Link{}, ErrDisabledReasonTooLong
+	}
+
+	before := s.before(ctx, username, alias)
+
+	link, err := s.storage.UpdateLink(ctx, username, alias, storage.LinkPatch{
+		Disabled:       &disabled,
+		DisabledBy:     &by,
+		DisabledReason: &reason,
+	})
+	if err != nil {
+		if !errors.Is(err, storage.ErrCacheUpdate) {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return storage.Link{}, ErrAliasNotFound
+			}
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	s.audit(ctx, action, username, alias, before, &link)
+
+	return link, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"url-shortener/internal/storage"
+)
+
+var ErrVersionNotFound = errors.New("link has no such version")
+
+// History returns what {alias} of {username} was before each change of its alias or url, oldest first
+func (s *Shortener) History(ctx context.Context, username, alias string) ([]storage.LinkVersion, error) {
+	const op = "service.History"
+
+	if username == "" {
+		return nil, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return nil, ErrEmptyAlias
+	}
+
+	versions, err := s.storage.LinkHistory(ctx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return nil, ErrAliasNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return versions, nil
+}
+
+// Rollback brings back the alias and url {alias} of {username} had at {version} and returns the link.
+// The rollback is recorded in the history like any other change, so it can be rolled back too.
+// It fails with ErrNewAliasAlreadyExists if another link took the old alias meanwhile, and with ErrUnsafeURL
+// if the old url is not allowed anymore, leaving the link as it is
+func (s *Shortener) Rollback(ctx context.Context, username, alias string, version int) (storage.Link, error) {
+	const op = "service.Rollback"
+
+	versions, err := s.History(ctx, username, alias)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	if version < 1 || version > len(versions) {
+		return storage.Link{}, ErrVersionNotFound
+	}
+	target := versions[version-1]
+
+	link, err := s.stored(ctx, username, alias)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	if target.Url != link.Url {
+		if err := s.checkURLs(ctx, []string{target.Url}); err != nil {
+			return storage.Link{}, err
+		}
+	}
+
+	// alias and url are changed at once, so the rollback is a single version and cannot be left halfway
+	var patch storage.LinkPatch
+	if target.Alias != alias {
+		patch.Alias = &target.Alias
+	}
+	if target.Url != link.Url {
+		patch.Url = &target.Url
+	}
+
+	after, err := s.storage.UpdateLink(ctx, username, alias, patch)
+	if err != nil {
+		if errors.Is(err, storage.ErrNewAliasAlreadyExists) {
+			return storage.Link{}, ErrNewAliasAlreadyExists
+		}
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, ErrAliasNotFound
+		}
+		if !errors.Is(err, storage.ErrCacheUpdate) {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	s.audit(ctx, ActionRollback, username, link.Alias, &link, &after)
+
+	return after, nil
+}
+
+// stored returns the link as it is in storage, a link read despite a cache failure is returned as well
+func (s *Shortener) stored(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "service.stored"
+
+	link, err := s.storage.GetLink(ctx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, ErrAliasNotFound
+		}
+		if !(errors.Is(err, storage.ErrCacheGet) || errors.Is(err, storage.ErrCacheSet)) || link.Url == "" {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return link, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_Rollback(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(ctx, NewLink{Username: "pasha", Url: "https://stepik.org/learn", Alias: "lms"})
+	require.NoError(t, err)
+	url := "https://go.dev"
+	_, err = svc.Edit(ctx, "pasha", "lms", storage.LinkPatch{Url: &url})
+	require.NoError(t, err)
+	_, err = svc.Rename(ctx, "pasha", "lms", "go")
+	require.NoError(t, err)
+
+	versions, err := svc.History(ctx, "pasha", "go")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "https://stepik.org/learn", versions[0].Url)
+	assert.Equal(t, "lms", versions[1].Alias)
+
+	_, err = svc.Rollback(ctx, "pasha", "go", 3)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+
+	_, err = svc.Save(ctx, NewLink{Username: "pasha", Url: "https://lms.yandex.ru", Alias: "lms"})
+	require.NoError(t, err)
+	_, err = svc.Rollback(ctx, "pasha", "go", 1)
+	assert.ErrorIs(t, err, ErrNewAliasAlreadyExists)
+	require.NoError(t, svc.Delete(ctx, "pasha", "lms"))
+
+	link, err := svc.Rollback(ctx, "pasha", "go", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "lms", link.Alias)
+	assert.Equal(t, "https://stepik.org/learn", link.Url)
+
+	versions, err = svc.History(ctx, "pasha", "lms")
+	require.NoError(t, err)
+	require.Len(t, versions, 3, "a rollback of alias and url is one version")
+	assert.Equal(t, "go", versions[2].Alias)
+	assert.Equal(t, "https://go.dev", versions[2].Url)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"url-shortener/internal/storage"
+)
+
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 1000
+	MaxNotesLength       = 10000
+)
+
+var (
+	ErrInvalidTitle       = fmt.Errorf("title must be a single line of up to %d printable characters", MaxTitleLength)
+	ErrInvalidDescription = fmt.Errorf("description must be up to %d printable characters", MaxDescriptionLength)
+	ErrInvalidNotes       = fmt.Errorf("notes must be up to %d printable characters", MaxNotesLength)
+)
+
+// Metadata describes a link, Title and Description are shown to visitors and Notes to the owner only
+type Metadata struct {
+	Title       string
+	Description string
+	Notes       string
+}
+
+// normalizeMetadata validates {meta} and returns it without surrounding spaces, empty fields are left empty
+func normalizeMetadata(meta Metadata) (Metadata, error) {
+	var err error
+	if meta.Title, err = normalizeText(meta.Title, MaxTitleLength, false, ErrInvalidTitle); err != nil {
+		return Metadata{}, err
+	}
+	if meta.Description, err = normalizeText(meta.Description, MaxDescriptionLength, true, ErrInvalidDescription); err != nil {
+		return Metadata{}, err
+	}
+	if meta.Notes, err = normalizeText(meta.Notes, MaxNotesLength, true, ErrInvalidNotes); err != nil {
+		return Metadata{}, err
+	}
+
+	return meta, nil
+}
+
+// normalizePatchMetadata normalizes metadata fields of {patch} that are set
+func normalizePatchMetadata(patch *storage.LinkPatch) error {
+	if patch.Title != nil {
+		title, err := normalizeText(*patch.Title, MaxTitleLength, false, ErrInvalidTitle)
+		if err != nil {
+			return err
+		}
+		patch.Title = &title
+	}
+
+	if patch.Description != nil {
+		description, err := normalizeText(*patch.Description, MaxDescriptionLength, true, ErrInvalidDescription)
+		if err != nil {
+			return err
+		}
+		patch.Description = &description
+	}
+
+	if patch.Notes != nil {
+		notes, err := normalizeText(*patch.Notes, MaxNotesLength, true, ErrInvalidNotes)
+		if err != nil {
+			return err
+		}
+		patch.Notes = &notes
+	}
+
+	return nil
+}
+
+// normalizeText trims {text} and checks it is printable, new lines and tabs are allowed in {multiline} text
+func normalizeText(text string, maxLength int, multiline bool, invalid error) (string, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxLength {
+		return "", invalid
+	}
+
+	for _, r := range text {
+		if multiline && (r == '\n' || r == '\t') {
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			return "", invalid
+		}
+	}
+
+	return text, nil
+}
+
+// Info returns {alias} of {username} with its metadata to its owner, without its password hash
+func (s *Shortener) Info(ctx context.Context, username, alias string) (storage.Link, error) {
+	if username == "" {
+		return storage.Link{}, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return storage.Link{}, ErrEmptyAlias
+	}
+
+	link, err := s.stored(ctx, username, alias)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	return *snapshot(&link), nil
+}
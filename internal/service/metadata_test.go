@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_Metadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     Metadata
+		expected Metadata
+		err      error
+	}{
+		{
+			name:     "trimmed",
+			meta:     Metadata{Title: " Go ", Description: "The Go\nprogramming language", Notes: "\tshared with the team\n"},
+			expected: Metadata{Title: "Go", Description: "The Go\nprogramming language", Notes: "shared with the team"},
+		},
+		{
+			name: "no metadata",
+		},
+		{
+			name: "multiline title",
+			meta: Metadata{Title: "Go\nlang"},
+			err:  ErrInvalidTitle,
+		},
+		{
+			name: "too long title",
+			meta: Metadata{Title: strings.Repeat("a", MaxTitleLength+1)},
+			err:  ErrInvalidTitle,
+		},
+		{
+			name: "control character in description",
+			meta: Metadata{Description: "Go\x00"},
+			err:  ErrInvalidDescription,
+		},
+		{
+			name: "too long notes",
+			meta: Metadata{Notes: strings.Repeat("a", MaxNotesLength+1)},
+			err:  ErrInvalidNotes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			svc := newShortener(s)
+
+			_, err := svc.Save(context.Background(), NewLink{
+				Username: "pasha",
+				Url:      "https://go.dev",
+				Alias:    "go",
+				Metadata: tt.meta,
+			})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			link := s.links["pasha/go"]
+			assert.Equal(t, tt.expected, Metadata{Title: link.Title, Description: link.Description, Notes: link.Notes})
+			assert.Equal(t, link.CreatedAt, link.UpdatedAt)
+		})
+	}
+}
+
+func TestShortener_Info(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+	_, err := svc.Save(context.Background(), NewLink{
+		Username: "pasha",
+		Url:      "https://go.dev",
+		Alias:    "go",
+		Password: "secret",
+		Metadata: Metadata{Title: "Go"},
+	})
+	require.NoError(t, err)
+
+	notes := " for the team "
+	_, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Notes: &notes})
+	require.NoError(t, err)
+
+	link, err := svc.Info(context.Background(), "pasha", "go")
+	require.NoError(t, err)
+	assert.Equal(t, "Go", link.Title)
+	assert.Equal(t, "for the team", link.Notes)
+	assert.Empty(t, link.PasswordHash)
+
+	_, err = svc.Info(context.Background(), "pasha", "rust")
+	assert.ErrorIs(t, err, ErrAliasNotFound)
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+	"url-shortener/internal/storage"
+)
+
+// PreviewSuffix appended to an alias opens the preview page of the link instead of redirecting,
+// so aliases cannot end with it
+const PreviewSuffix = "+"
+
+// ForcesPreview reports whether the owner of {link} shows the preview page before every redirect of their links
+func (s *Shortener) ForcesPreview(ctx context.Context, link storage.Link) bool {
+	return s.user(ctx, link.Username).ForcePreview
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"url-shortener/internal/lib/useragent"
+	"url-shortener/internal/storage"
+)
+
+var (
+	ErrInvalidRoutes    = errors.New("routes must map ios, android, desktop or bot to a valid url")
+	ErrInvalidCountries = errors.New("countries must map ISO 3166-1 alpha-2 codes to a valid url")
+)
+
+// Route returns the url the client with {userAgent} is sent to and reports whether the link has a route
+// for the platform of the client, the url of the link is the fallback for platforms without a route
+func Route(link storage.Link, userAgent string) (string, bool) {
+	if url, ok := link.Routes[useragent.Classify(userAgent)]; ok {
+		return url, true
+	}
+
+	return link.Url, false
+}
+
+// RouteCountry returns the url the client from {country} is sent to and reports whether the link
+// has a rule for the country, an empty {country} means the client could not be located
+func RouteCountry(link storage.Link, country string) (string, bool) {
+	if country == "" {
+		return "", false
+	}
+
+	url, ok := link.Countries[strings.ToUpper(country)]
+	return url, ok
+}
+
+func (s *Shortener) validateRoutes(routes map[string]string) error {
+	for platform, url := range routes {
+		if !useragent.IsPlatform(platform) {
+			return fmt.Errorf("%w: unknown platform %q", ErrInvalidRoutes, platform)
+		}
+		if err := s.validate.Var(url, "required,url"); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRoutes, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeCountries validates country rules and upper-cases their codes, as lookups return them
+func (s *Shortener) normalizeCountries(countries map[string]string) (map[string]string, error) {
+	if countries == nil {
+		return nil, nil
+	}
+
+	normalized := make(map[string]string, len(countries))
+	for code, url := range countries {
+		if !isCountryCode(code) {
+			return nil, fmt.Errorf("%w: unknown country %q", ErrInvalidCountries, code)
+		}
+		if err := s.validate.Var(url, "required,url"); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCountries, err)
+		}
+		normalized[strings.ToUpper(code)] = url
+	}
+
+	return normalized, nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_SaveCountries(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(context.Background(), NewLink{
+		Username:  "pasha",
+		Url:       "https://example.com",
+		Alias:     "shop",
+		Countries: map[string]string{"de": "https://example.de"},
+	})
+	require.NoError(t, err)
+
+	link := s.links["pasha/shop"]
+	assert.Equal(t, map[string]string{"DE": "https://example.de"}, link.Countries)
+
+	url, ok := RouteCountry(link, "DE")
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.de", url)
+
+	_, ok = RouteCountry(link, "FR")
+	assert.False(t, ok)
+
+	_, ok = RouteCountry(link, "")
+	assert.False(t, ok)
+
+	for _, countries := range []map[string]string{
+		{"Germany": "https://example.de"},
+		{"DE": "not a url"},
+	} {
+		_, err = svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://example.com", Countries: countries})
+		assert.ErrorIs(t, err, ErrInvalidCountries)
+	}
+
+	_, err = svc.Edit(context.Background(), "pasha", "shop", storage.LinkPatch{Countries: map[string]string{}})
+	require.NoError(t, err)
+	assert.Empty(t, s.links["pasha/shop"].Countries)
+}
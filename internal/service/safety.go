@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"url-shortener/internal/storage"
+)
+
+var (
+	ErrUnsafeURL    = errors.New("url is not allowed")
+	ErrLinkDisabled = errors.New("link is disabled")
+)
+
+// URLChecker tells whether a url is safe to shorten
+type URLChecker interface {
+	// Check returns an error explaining why {url} is not safe, nil if it is
+	Check(ctx context.Context, url string) error
+}
+
+// LinkLister returns links of all users
+type LinkLister interface {
+	ListAllURLs(ctx context.Context) ([]storage.Link, error)
+}
+
+// checkURLs checks every url a link redirects to, the fallback one, routes, country rules and variants.
+// Nothing is checked without a checker
+func (s *Shortener) checkURLs(ctx context.Context, urls []string) error {
+	if s.checker == nil {
+		return nil
+	}
+
+	for _, url := range urls {
+		if err := s.checker.Check(ctx, url); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnsafeURL, err)
+		}
+	}
+
+	return nil
+}
+
+// targets returns every url {link} redirects to
+func targets(url string, routes, countries map[string]string, variants []storage.Variant) []string {
+	urls := make([]string, 0, 1+len(routes)+len(countries)+len(variants))
+	if url != "" {
+		urls = append(urls, url)
+	}
+	for _, u := range routes {
+		urls = append(urls, u)
+	}
+	for _, u := range countries {
+		urls = append(urls, u)
+	}
+	for _, v := range variants {
+		urls = append(urls, v.Url)
+	}
+	return urls
+}
+
+// DisableMatching disables links of all users redirecting to any url {match}ing,
+// so links saved before their url turned out to be unsafe stop redirecting.
+// Each link disabled is audited as ActionDisable by the caller from {ctx}.
+// It returns how many links were disabled, a failure to disable one link does not stop the others
+func (s *Shortener) DisableMatching(ctx context.Context, links LinkLister, match func(url string) bool) (int, error) {
+	const op = "service.DisableMatching"
+
+	all, err := links.ListAllURLs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	disabled, by, reason := true, storage.DisabledBySafety, "url is blocklisted as unsafe"
+	var (
+		count int
+		errs  []error
+	)
+	for _, link := range all {
+		if link.Disabled || !anyMatch(targets(link.Url, link.Routes, link.Countries, link.Variants), match) {
+			continue
+		}
+
+		updated, err := s.storage.UpdateLink(ctx, link.Username, link.Alias, storage.LinkPatch{
+			Disabled:       &disabled,
+			DisabledBy:     &by,
+			DisabledReason: &reason,
+		})
+		if err != nil && !errors.Is(err, storage.ErrCacheUpdate) {
+			errs = append(errs, fmt.Errorf("%s: %s/%s: %w", op, link.Username, link.Alias, err))
+			continue
+		}
+		if err != nil {
+			s.log.Error(err.Error(), slog.String("op", op))
+		}
+
+		s.log.Warn(
+			"link disabled as unsafe",
+			slog.String("username", link.Username),
+			slog.String("alias", link.Alias),
+			slog.String("url", link.Url),
+			slog.String("op", op),
+		)
+		s.audit(ctx, ActionDisable, link.Username, link.Alias, &link, &updated)
+		count++
+	}
+
+	return count, errors.Join(errs...)
+}
+
+func anyMatch(urls []string, match func(url string) bool) bool {
+	for _, url := range urls {
+		if match(url) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errPhishing = errors.New("phishing")
+
+type fakeChecker struct{}
+
+func (fakeChecker) Check(_ context.Context, url string) error {
+	if strings.Contains(url, "evil") {
+		return errPhishing
+	}
+	return nil
+}
+
+type linkList []storage.Link
+
+func (l linkList) ListAllURLs(context.Context) ([]storage.Link, error) {
+	return l, nil
+}
+
+func TestShortener_CheckURLs(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+	svc.checker = fakeChecker{}
+
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://evil.com", Alias: "a"})
+	assert.ErrorIs(t, err, ErrUnsafeURL)
+	assert.ErrorIs(t, err, errPhishing)
+
+	_, err = svc.Save(context.Background(), NewLink{
+		Username: "pasha",
+		Url:      "https://go.dev",
+		Alias:    "b",
+		Variants: []storage.Variant{{Url: "https://evil.com/b", Weight: 1}},
+	})
+	assert.ErrorIs(t, err, ErrUnsafeURL)
+
+	_, err = svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "go"})
+	require.NoError(t, err)
+
+	evil := "https://evil.com"
+	_, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Url: &evil})
+	assert.ErrorIs(t, err, ErrUnsafeURL)
+
+	invalid := "go.dev"
+	_, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Url: &invalid})
+	assert.ErrorIs(t, err, ErrInvalidURL)
+
+	safe := "https://pkg.go.dev"
+	link, err := svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Url: &safe})
+	assert.NoError(t, err)
+	assert.Equal(t, safe, link.Url)
+}
+
+func TestShortener_DisableMatching(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	for _, link := range []NewLink{
+		{Username: "pasha", Url: "https://go.dev", Alias: "go"},
+		{Username: "pasha", Url: "https://bad.example", Alias: "bad"},
+		{Username: "vova", Url: "https://go.dev", Alias: "ios", Routes: map[string]string{"ios": "https://bad.example/app"}},
+	} {
+		_, err := svc.Save(context.Background(), link)
+		require.NoError(t, err)
+	}
+
+	var all linkList
+	for _, key := range []string{"pasha/go", "pasha/bad", "vova/ios"} {
+		all = append(all, s.links[key])
+	}
+
+	n, err := svc.DisableMatching(context.Background(), all, func(url string) bool {
+		return strings.Contains(url, "bad.example")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	link, err := svc.Resolve(context.Background(), "pasha", "bad")
+	assert.ErrorIs(t, err, ErrLinkDisabled)
+	assert.Equal(t, storage.DisabledBySafety, link.DisabledBy)
+	_, err = svc.Resolve(context.Background(), "vova", "ios")
+	assert.ErrorIs(t, err, ErrLinkDisabled)
+	_, err = svc.Resolve(context.Background(), "pasha", "go")
+	assert.NoError(t, err)
+
+	enabled := false
+	_, err = svc.Edit(context.Background(), "pasha", "bad", storage.LinkPatch{Disabled: &enabled})
+	assert.ErrorIs(t, err, ErrDisabledAsUnsafe)
+}
+
+func TestShortener_EditDisabled(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "go"})
+	require.NoError(t, err)
+
+	disabled, enabled, reason := true, false, "moved to the blog"
+	link, err := svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Disabled: &disabled, DisabledReason: &reason})
+	require.NoError(t, err)
+	assert.Equal(t, storage.DisabledByOwner, link.DisabledBy)
+
+	link, err = svc.Resolve(context.Background(), "pasha", "go")
+	assert.ErrorIs(t, err, ErrLinkDisabled)
+	assert.Equal(t, reason, link.DisabledReason)
+
+	link, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Disabled: &enabled})
+	require.NoError(t, err)
+	assert.False(t, link.Disabled)
+	assert.Empty(t, link.DisabledBy)
+	assert.Empty(t, link.DisabledReason)
+
+	admin := storage.DisabledByAdmin
+	_, err = s.UpdateLink(context.Background(), "pasha", "go", storage.LinkPatch{Disabled: &disabled, DisabledBy: &admin})
+	require.NoError(t, err)
+
+	_, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Disabled: &enabled})
+	assert.ErrorIs(t, err, ErrDisabledByAdmin)
+
+	// owners still edit other settings of links disabled by admins, but cannot claim them
+	code := 302
+	link, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{RedirectCode: &code, DisabledBy: new(string)})
+	require.NoError(t, err)
+	assert.Equal(t, storage.DisabledByAdmin, link.DisabledBy)
+}
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/lib/random"
+	"url-shortener/internal/storage"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmptyUsername         = errors.New("username is empty")
+	ErrEmptyAlias            = errors.New("alias is empty")
+	ErrInvalidURL            = errors.New("url is invalid")
+	ErrAliasGeneration       = errors.New("failed to generate alias")
+	ErrAliasNotFound         = errors.New("alias not found")
+	ErrAliasAlreadyExist     = errors.New("alias already exist")
+	ErrNewAliasAlreadyExists = errors.New("new_alias cannot use, url with this alias already exists")
+	ErrPasswordRequired      = errors.New("link is protected with password")
+	ErrWrongPassword         = errors.New("wrong link password")
+	ErrInvalidMaxClicks      = errors.New("max_clicks cannot be negative")
+	ErrLinkExhausted         = errors.New("link has no clicks left")
+	ErrInvalidWindow         = errors.New("not_after must be later than not_before")
+	ErrLinkNotActive         = errors.New("link is not active yet")
+	ErrLinkExpired           = errors.New("link is no longer active")
+	ErrInvalidRedirectCode   = errors.New("redirect_code must be one of 301, 302, 307, 308")
+	ErrInvalidCacheControl   = errors.New("cache_control must be a printable header value")
+	ErrInvalidAlias          = errors.New("alias cannot end with " + PreviewSuffix)
+)
+
+// Shortener contains the business rules shared by all transports (HTTP, gRPC, CLI)
+type Shortener struct {
+	log     *slog.Logger
+	storage storage.Storage
+	users   UserProvider
+	checker URLChecker
+	// trashRetention is how long deleted links can be restored, zero deletes them permanently
+	trashRetention time.Duration
+	// events is the audit log of link changes, nil records nothing
+	events   storage.AuditStorage
+	validate *validator.Validate
+	now      func() time.Time
+	intn     func(n int) int
+
+	mu       sync.Mutex
+	settings map[string]userEntry
+}
+
+// UserProvider returns users kept in storage, their settings apply to all their links
+type UserProvider interface {
+	GetUser(ctx context.Context, username string) (storage.User, error)
+}
+
+// New returns a Shortener, urls are not checked for safety if {checker} is nil.
+// Deleted links are kept in the trash for {trashRetention}, zero deletes them permanently.
+// Changes of links are recorded in {events} along with the Caller from the context, nil records nothing
+func New(
+	log *slog.Logger,
+	s storage.Storage,
+	users UserProvider,
+	checker URLChecker,
+	trashRetention time.Duration,
+	events storage.AuditStorage,
+) *Shortener {
+	return &Shortener{
+		log:            log,
+		storage:        s,
+		users:          users,
+		checker:        checker,
+		trashRetention: trashRetention,
+		events:         events,
+		validate:       validator.New(),
+		now:            time.Now,
+		intn:           rand.IntN,
+		settings:       make(map[string]userEntry),
+	}
+}
+
+// NewLink is a link to be saved.
+// Empty Alias is generated, empty Password leaves the link public, zero MaxClicks leaves it unlimited
+// and nil NotBefore or NotAfter leaves its activation window open on that side
+type NewLink struct {
+	Username  string
+	Url       string
+	Alias     string
+	Password  string
+	MaxClicks int64
+	NotBefore *time.Time
+	NotAfter  *time.Time
+	// RedirectCode and CacheControl shape the redirect response, zero values mean the defaults
+	RedirectCode int
+	CacheControl string
+	// QueryPassthrough is one of QueryDrop, QueryKeep, QueryOverride
+	QueryPassthrough string
+	PathPassthrough  bool
+	// UTM overrides default UTM parameters of the user
+	UTM storage.UTM
+	// Routes maps a client platform to the url it is sent to instead of Url
+	Routes map[string]string
+	// Countries maps a country code of the client to the url it is sent to instead of Url
+	Countries map[string]string
+	// Variants split the traffic of the link by weight instead of Url
+	Variants []storage.Variant
+	// Tags are lower-cased and deduplicated, empty Folder leaves the link outside folders
+	Tags   []string
+	Folder string
+	Metadata
+}
+
+// Save stores {link}, keeping only a hash of its password.
+// It returns the alias the url was saved with
+func (s *Shortener) Save(ctx context.Context, link NewLink) (string, error) {
+	const op = "service.Save"
+
+	if link.Username == "" {
+		return "", ErrEmptyUsername
+	}
+
+	if err := s.validate.Var(link.Url, "required,url"); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	if link.MaxClicks < 0 {
+		return "", ErrInvalidMaxClicks
+	}
+
+	if link.NotBefore != nil && link.NotAfter != nil && !link.NotAfter.After(*link.NotBefore) {
+		return "", ErrInvalidWindow
+	}
+
+	if err := validateRedirect(link.RedirectCode, link.CacheControl); err != nil {
+		return "", err
+	}
+
+	if err := validateQueryMode(link.QueryPassthrough); err != nil {
+		return "", err
+	}
+
+	if err := s.validateRoutes(link.Routes); err != nil {
+		return "", err
+	}
+
+	if err := s.validateVariants(link.Variants); err != nil {
+		return "", err
+	}
+
+	countries, err := s.normalizeCountries(link.Countries)
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := normalizeTags(link.Tags)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := normalizeFolder(link.Folder)
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := normalizeMetadata(link.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkURLs(ctx, targets(link.Url, link.Routes, countries, link.Variants)); err != nil {
+		return "", err
+	}
+
+	if strings.HasSuffix(link.Alias, PreviewSuffix) {
+		return "", ErrInvalidAlias
+	}
+
+	if link.Alias == "" {
+		link.Alias = random.Alias()
+		if link.Alias == "" {
+			return "", ErrAliasGeneration
+		}
+	}
+
+	now := s.now()
+	record := storage.Link{
+		Username:         link.Username,
+		Alias:            link.Alias,
+		Url:              link.Url,
+		MaxClicks:        link.MaxClicks,
+		RemainingClicks:  link.MaxClicks,
+		NotBefore:        link.NotBefore,
+		NotAfter:         link.NotAfter,
+		RedirectCode:     link.RedirectCode,
+		CacheControl:     link.CacheControl,
+		QueryPassthrough: link.QueryPassthrough,
+		PathPassthrough:  link.PathPassthrough,
+		UTM:              link.UTM,
+		Routes:           link.Routes,
+		Countries:        countries,
+		Variants:         withoutClicks(link.Variants),
+		CreatedAt:        &now,
+		UpdatedAt:        &now,
+		Tags:             tags,
+		Folder:           folder,
+		Title:            meta.Title,
+		Description:      meta.Description,
+		Notes:            meta.Notes,
+	}
+
+	if link.Password != "" {
+		hash, err := auth.HashPassword(link.Password)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		record.PasswordHash = hash
+	}
+
+	if err := s.storage.SaveLink(ctx, record); err != nil {
+		if !errors.Is(err, storage.ErrCacheSet) {
+			if errors.Is(err, storage.ErrAliasAlreadyExist) {
+				return "", ErrAliasAlreadyExist
+			}
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	s.audit(ctx, ActionSave, record.Username, record.Alias, nil, &record)
+
+	return link.Alias, nil
+}
+
+// Resolve returns link saved under {alias} for {username} if it is inside its activation window.
+// The window is checked on every call, so a link read from cache never redirects early.
+// A protected link must be checked with CheckPassword and then opened with Visit before redirecting to it.
+// A disabled link is returned along with ErrLinkDisabled, so callers can tell who disabled it and why
+func (s *Shortener) Resolve(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "service.Resolve"
+
+	if username == "" {
+		return storage.Link{}, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return storage.Link{}, ErrEmptyAlias
+	}
+
+	link, err := s.storage.GetLink(ctx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, ErrAliasNotFound
+		}
+		if !(errors.Is(err, storage.ErrCacheGet) || errors.Is(err, storage.ErrCacheSet)) || link.Url == "" {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	if link.Disabled {
+		return link, ErrLinkDisabled
+	}
+
+	if err := s.checkWindow(link); err != nil {
+		return storage.Link{}, err
+	}
+
+	return link, nil
+}
+
+func (s *Shortener) checkWindow(link storage.Link) error {
+	now := s.now()
+
+	if link.NotBefore != nil && now.Before(*link.NotBefore) {
+		return ErrLinkNotActive
+	}
+
+	if link.NotAfter != nil && !now.Before(*link.NotAfter) {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+// CheckPassword checks {password} against the password {link} is protected with.
+// Public links accept any password
+func (s *Shortener) CheckPassword(link storage.Link, password string) error {
+	if link.PasswordHash == "" {
+		return nil
+	}
+
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+
+	return nil
+}
+
+// Visit opens {link}, counting the click and consuming one of its clicks if it is click-limited.
+// It returns the link as it is in storage after the click.
+// Clicks of unlimited links are counted on a best-effort basis, a failure to count one does not stop the redirect
+func (s *Shortener) Visit(ctx context.Context, link storage.Link) (storage.Link, error) {
+	const op = "service.Visit"
+
+	if link.MaxClicks == 0 {
+		if err := s.storage.CountClick(ctx, link.Username, link.Alias); err != nil {
+			s.log.Error(err.Error(), slog.String("op", op))
+			return link, nil
+		}
+		link.Clicks++
+		return link, nil
+	}
+
+	visited, err := s.storage.UseClick(ctx, link.Username, link.Alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrClicksExhausted) {
+			return storage.Link{}, ErrLinkExhausted
+		}
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, ErrAliasNotFound
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return visited, nil
+}
+
+// Edit applies {patch} to {alias} of {username} and returns the updated link.
+// Disabling through Edit is done by the owner, DisabledBy in {patch} is ignored
+func (s *Shortener) Edit(ctx context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	const op = "service.Edit"
+
+	if username == "" {
+		return storage.Link{}, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return storage.Link{}, ErrEmptyAlias
+	}
+
+	// links are renamed by Rename, which checks the new alias
+	patch.Alias = nil
+
+	var url string
+	if patch.Url != nil {
+		if err := s.validate.Var(*patch.Url, "required,url"); err != nil {
+			return storage.Link{}, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+		}
+		url = *patch.Url
+	}
+
+	var (
+		code         int
+		cacheControl string
+	)
+	if patch.RedirectCode != nil {
+		code = *patch.RedirectCode
+	}
+	if patch.CacheControl != nil {
+		cacheControl = *patch.CacheControl
+	}
+	if err := validateRedirect(code, cacheControl); err != nil {
+		return storage.Link{}, err
+	}
+
+	if patch.QueryPassthrough != nil {
+		if err := validateQueryMode(*patch.QueryPassthrough); err != nil {
+			return storage.Link{}, err
+		}
+	}
+
+	if err := s.validateRoutes(patch.Routes); err != nil {
+		return storage.Link{}, err
+	}
+
+	if err := s.validateVariants(patch.Variants); err != nil {
+		return storage.Link{}, err
+	}
+	patch.Variants = withoutClicks(patch.Variants)
+
+	countries, err := s.normalizeCountries(patch.Countries)
+	if err != nil {
+		return storage.Link{}, err
+	}
+	patch.Countries = countries
+
+	if patch.Tags, err = normalizeTags(patch.Tags); err != nil {
+		return storage.Link{}, err
+	}
+
+	if patch.Folder != nil {
+		folder, err := normalizeFolder(*patch.Folder)
+		if err != nil {
+			return storage.Link{}, err
+		}
+		patch.Folder = &folder
+	}
+
+	if err := normalizePatchMetadata(&patch); err != nil {
+		return storage.Link{}, err
+	}
+
+	if err := s.checkURLs(ctx, targets(url, patch.Routes, patch.Countries, patch.Variants)); err != nil {
+		return storage.Link{}, err
+	}
+
+	if err := s.ownerDisable(ctx, username, alias, &patch); err != nil {
+		return storage.Link{}, err
+	}
+
+	before := s.before(ctx, username, alias)
+
+	link, err := s.storage.UpdateLink(ctx, username, alias, patch)
+	if err != nil {
+		if !errors.Is(err, storage.ErrCacheUpdate) {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return storage.Link{}, ErrAliasNotFound
+			}
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	s.audit(ctx, ActionEdit, username, alias, before, &link)
+
+	return link, nil
+}
+
+// validateRedirect checks {code} and {cacheControl} of a link, zero values are the defaults
+func validateRedirect(code int, cacheControl string) error {
+	switch code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ErrInvalidRedirectCode
+	}
+
+	for _, r := range cacheControl {
+		if r < ' ' || r > '~' {
+			return ErrInvalidCacheControl
+		}
+	}
+
+	return nil
+}
+
+func validateQueryMode(mode string) error {
+	switch mode {
+	case QueryDrop, QueryKeep, QueryOverride:
+		return nil
+	default:
+		return ErrInvalidQueryMode
+	}
+}
+
+// Delete moves {alias} of {username} to the trash, freeing the alias, or deletes it permanently without trash retention
+func (s *Shortener) Delete(ctx context.Context, username, alias string) error {
+	const op = "service.Delete"
+
+	if username == "" {
+		return ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return ErrEmptyAlias
+	}
+
+	before := s.before(ctx, username, alias)
+
+	var err error
+	if s.trashRetention > 0 {
+		now := s.now()
+		err = s.storage.TrashURL(ctx, username, alias, now, now.Add(s.trashRetention))
+	} else {
+		err = s.storage.DeleteURL(ctx, username, alias)
+	}
+	if err != nil {
+		if !errors.Is(err, storage.ErrCacheDelete) {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ErrAliasNotFound
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	s.audit(ctx, ActionDelete, username, alias, before, nil)
+
+	return nil
+}
+
+// Rename replaces {alias} of {username} with {newAlias}, generating it if it is empty.
+// It returns the alias the url is available by now
+func (s *Shortener) Rename(ctx context.Context, username, alias, newAlias string) (string, error) {
+	const op = "service.Rename"
+
+	if username == "" {
+		return "", ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return "", ErrEmptyAlias
+	}
+
+	if strings.HasSuffix(newAlias, PreviewSuffix) {
+		return "", ErrInvalidAlias
+	}
+
+	if newAlias == "" {
+		newAlias = random.Alias()
+		if newAlias == "" {
+			return "", ErrAliasGeneration
+		}
+	}
+
+	before := s.before(ctx, username, alias)
+
+	if err := s.storage.UpdateAlias(ctx, username, alias, newAlias); err != nil {
+		if !errors.Is(err, storage.ErrCacheUpdate) {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return "", ErrAliasNotFound
+			}
+			if errors.Is(err, storage.ErrNewAliasAlreadyExists) {
+				return "", ErrNewAliasAlreadyExists
+			}
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		s.log.Error(err.Error(), slog.String("op", op))
+	}
+
+	var after *storage.Link
+	if before != nil {
+		renamed := *before
+		renamed.Alias = newAlias
+		after = &renamed
+	}
+	s.audit(ctx, ActionUpdate, username, alias, before, after)
+
+	return newAlias, nil
+}
+
+// List returns links of {username} matching {filter}, tags and folder of the filter are normalized as they are on save
+func (s *Shortener) List(ctx context.Context, username string, filter storage.LinkFilter) ([]storage.Link, error) {
+	const op = "service.List"
+
+	if username == "" {
+		return nil, ErrEmptyUsername
+	}
+
+	var err error
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return nil, err
+	}
+
+	if filter.Folder, err = normalizeFolder(filter.Folder); err != nil {
+		return nil, err
+	}
+
+	links, err := s.storage.ListURLs(ctx, username, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return links, nil
+}
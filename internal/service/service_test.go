@@ -0,0 +1,749 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errConnection = errors.New("connection refused")
+
+type fakeStorage struct {
+	urls  map[string]string
+	links map[string]storage.Link
+	trash map[string]storage.TrashedLink
+	// history is kept by username and alias, renames move it to the new alias
+	history map[string][]storage.LinkVersion
+	err     error
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		urls:    make(map[string]string),
+		links:   make(map[string]storage.Link),
+		trash:   make(map[string]storage.TrashedLink),
+		history: make(map[string][]storage.LinkVersion),
+	}
+}
+
+func (f *fakeStorage) SaveLink(_ context.Context, link storage.Link) error {
+	if _, ok := f.urls[link.Username+"/"+link.Alias]; ok {
+		return storage.ErrAliasAlreadyExist
+	}
+	f.urls[link.Username+"/"+link.Alias] = link.Url
+	f.links[link.Username+"/"+link.Alias] = link
+	return f.err
+}
+
+func (f *fakeStorage) GetLink(_ context.Context, username, alias string) (storage.Link, error) {
+	url, ok := f.urls[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	link := f.links[username+"/"+alias]
+	link.Username, link.Alias, link.Url = username, alias, url
+	return link, f.err
+}
+
+func (f *fakeStorage) DeleteURL(_ context.Context, username, alias string) error {
+	if _, ok := f.urls[username+"/"+alias]; !ok {
+		return storage.ErrAliasNotFound
+	}
+	delete(f.urls, username+"/"+alias)
+	return f.err
+}
+
+func (f *fakeStorage) TrashURL(_ context.Context, username, alias string, deletedAt, expiresAt time.Time) error {
+	key := username + "/" + alias
+	url, ok := f.urls[key]
+	if !ok {
+		return storage.ErrAliasNotFound
+	}
+	link := f.links[key]
+	link.Username, link.Alias, link.Url = username, alias, url
+	f.trash[key] = storage.TrashedLink{Link: link, DeletedAt: deletedAt, ExpiresAt: expiresAt}
+	delete(f.urls, key)
+	delete(f.links, key)
+	return f.err
+}
+
+func (f *fakeStorage) ListTrash(_ context.Context, username string) ([]storage.TrashedLink, error) {
+	var links []storage.TrashedLink
+	for _, link := range f.trash {
+		if link.Username == username {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (f *fakeStorage) RestoreURL(_ context.Context, username, alias string) (storage.Link, error) {
+	key := username + "/" + alias
+	trashed, ok := f.trash[key]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	if _, ok := f.urls[key]; ok {
+		return storage.Link{}, storage.ErrAliasAlreadyExist
+	}
+	f.urls[key] = trashed.Url
+	f.links[key] = trashed.Link
+	delete(f.trash, key)
+	return trashed.Link, nil
+}
+
+func (f *fakeStorage) PurgeTrashed(_ context.Context, username, alias string) error {
+	if _, ok := f.trash[username+"/"+alias]; !ok {
+		return storage.ErrAliasNotFound
+	}
+	delete(f.trash, username+"/"+alias)
+	return nil
+}
+
+func (f *fakeStorage) EmptyTrash(_ context.Context, before time.Time) (int64, error) {
+	var n int64
+	for key, link := range f.trash {
+		if !link.ExpiresAt.After(before) {
+			delete(f.trash, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeStorage) UpdateAlias(_ context.Context, username, oldAlias, newAlias string) error {
+	url, ok := f.urls[username+"/"+oldAlias]
+	if !ok {
+		return storage.ErrAliasNotFound
+	}
+	if _, ok := f.urls[username+"/"+newAlias]; ok {
+		return storage.ErrNewAliasAlreadyExists
+	}
+	delete(f.urls, username+"/"+oldAlias)
+	f.urls[username+"/"+newAlias] = url
+	if link, ok := f.links[username+"/"+oldAlias]; ok {
+		delete(f.links, username+"/"+oldAlias)
+		link.Alias = newAlias
+		f.links[username+"/"+newAlias] = link
+	}
+	f.history[username+"/"+newAlias] = f.record(username, oldAlias, url)
+	delete(f.history, username+"/"+oldAlias)
+	return f.err
+}
+
+func (f *fakeStorage) record(username, alias, url string) []storage.LinkVersion {
+	versions := f.history[username+"/"+alias]
+	return append(versions, storage.LinkVersion{
+		Version:   len(versions) + 1,
+		Alias:     alias,
+		Url:       url,
+		ChangedBy: username,
+		ChangedAt: time.Now(),
+	})
+}
+
+func (f *fakeStorage) LinkHistory(_ context.Context, username, alias string) ([]storage.LinkVersion, error) {
+	if _, ok := f.urls[username+"/"+alias]; !ok {
+		return nil, storage.ErrAliasNotFound
+	}
+	return f.history[username+"/"+alias], nil
+}
+
+func (f *fakeStorage) UpdateLink(_ context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	if _, ok := f.urls[username+"/"+alias]; !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	link := f.links[username+"/"+alias]
+	url := f.urls[username+"/"+alias]
+	if patch.Alias != nil && *patch.Alias != alias {
+		if _, ok := f.urls[username+"/"+*patch.Alias]; ok {
+			return storage.Link{}, storage.ErrNewAliasAlreadyExists
+		}
+	}
+	if patch.Url != nil && *patch.Url != url || patch.Alias != nil && *patch.Alias != alias {
+		f.history[username+"/"+alias] = f.record(username, alias, url)
+	}
+	if patch.Url != nil {
+		link.Url = *patch.Url
+		f.urls[username+"/"+alias] = *patch.Url
+	}
+	if patch.Alias != nil && *patch.Alias != alias {
+		f.urls[username+"/"+*patch.Alias] = f.urls[username+"/"+alias]
+		f.history[username+"/"+*patch.Alias] = f.history[username+"/"+alias]
+		delete(f.urls, username+"/"+alias)
+		delete(f.history, username+"/"+alias)
+		delete(f.links, username+"/"+alias)
+		alias = *patch.Alias
+		link.Alias = alias
+	}
+	if patch.Disabled != nil {
+		link.Disabled = *patch.Disabled
+	}
+	if patch.DisabledBy != nil {
+		link.DisabledBy = *patch.DisabledBy
+	}
+	if patch.DisabledReason != nil {
+		link.DisabledReason = *patch.DisabledReason
+	}
+	if patch.RedirectCode != nil {
+		link.RedirectCode = *patch.RedirectCode
+	}
+	if patch.CacheControl != nil {
+		link.CacheControl = *patch.CacheControl
+	}
+	if patch.QueryPassthrough != nil {
+		link.QueryPassthrough = *patch.QueryPassthrough
+	}
+	if patch.PathPassthrough != nil {
+		link.PathPassthrough = *patch.PathPassthrough
+	}
+	if patch.UTM != nil {
+		link.UTM = *patch.UTM
+	}
+	if patch.Routes != nil {
+		link.Routes = patch.Routes
+	}
+	if patch.Countries != nil {
+		link.Countries = patch.Countries
+	}
+	if patch.Variants != nil {
+		link.Variants = patch.Variants
+	}
+	if patch.Tags != nil {
+		link.Tags = patch.Tags
+	}
+	if patch.Folder != nil {
+		link.Folder = *patch.Folder
+	}
+	if patch.Title != nil {
+		link.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		link.Description = *patch.Description
+	}
+	if patch.Notes != nil {
+		link.Notes = *patch.Notes
+	}
+	f.links[username+"/"+alias] = link
+	return link, f.err
+}
+
+func (f *fakeStorage) ListURLs(_ context.Context, username string, _ storage.LinkFilter) ([]storage.Link, error) {
+	links := make([]storage.Link, 0)
+	for key, url := range f.urls {
+		if u, alias, _ := strings.Cut(key, "/"); u == username {
+			links = append(links, storage.Link{Username: u, Alias: alias, Url: url})
+		}
+	}
+	return links, nil
+}
+
+func (f *fakeStorage) UseClick(_ context.Context, username, alias string) (storage.Link, error) {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	if link.RemainingClicks == 0 {
+		return storage.Link{}, storage.ErrClicksExhausted
+	}
+	link.RemainingClicks--
+	link.Clicks++
+	f.links[username+"/"+alias] = link
+	return link, f.err
+}
+
+func (f *fakeStorage) CountClick(_ context.Context, username, alias string) error {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.ErrAliasNotFound
+	}
+	link.Clicks++
+	f.links[username+"/"+alias] = link
+	return nil
+}
+
+func (f *fakeStorage) CountVariantClick(_ context.Context, username, alias, url string) error {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.ErrVariantNotFound
+	}
+	for i := range link.Variants {
+		if link.Variants[i].Url == url {
+			link.Variants[i].Clicks++
+			return nil
+		}
+	}
+	return storage.ErrVariantNotFound
+}
+
+func (f *fakeStorage) Close(context.Context) error {
+	return nil
+}
+
+type fakeUsers map[string]storage.User
+
+func (f fakeUsers) GetUser(_ context.Context, username string) (storage.User, error) {
+	user, ok := f[username]
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func newShortener(s storage.Storage) *Shortener {
+	return newShortenerWithUsers(s, fakeUsers{})
+}
+
+func newShortenerWithUsers(s storage.Storage, users UserProvider) *Shortener {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), s, users, nil, 24*time.Hour, nil)
+}
+
+func TestShortener_Save(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		url         string
+		alias       string
+		storageErr  error
+		expectedErr error
+	}{
+		{
+			name:     "with alias",
+			username: "pasha",
+			url:      "https://stepik.org/learn",
+			alias:    "lms",
+		},
+		{
+			name:     "generated alias",
+			username: "pasha",
+			url:      "https://stepik.org/learn",
+		},
+		{
+			name:       "cache degradation",
+			username:   "pasha",
+			url:        "https://stepik.org/learn",
+			alias:      "lms",
+			storageErr: storage.ErrCacheSet,
+		},
+		{
+			name:        "alias already exist",
+			username:    "pasha",
+			url:         "https://stepik.org/learn",
+			alias:       "taken",
+			expectedErr: ErrAliasAlreadyExist,
+		},
+		{
+			name:        "invalid url",
+			username:    "pasha",
+			url:         "stepik",
+			alias:       "lms",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "empty username",
+			url:         "https://stepik.org/learn",
+			alias:       "lms",
+			expectedErr: ErrEmptyUsername,
+		},
+		{
+			name:        "alias with preview suffix",
+			username:    "pasha",
+			url:         "https://stepik.org/learn",
+			alias:       "lms+",
+			expectedErr: ErrInvalidAlias,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			s.urls["pasha/taken"] = "https://go.dev"
+			s.err = tt.storageErr
+
+			alias, err := newShortener(s).Save(context.Background(), NewLink{Username: tt.username, Url: tt.url, Alias: tt.alias})
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.alias != "" {
+				assert.Equal(t, tt.alias, alias)
+			} else {
+				assert.NotEmpty(t, alias)
+			}
+			assert.Equal(t, tt.url, s.urls[tt.username+"/"+alias])
+		})
+	}
+}
+
+func TestShortener_Resolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		alias       string
+		storageErr  error
+		expectedUrl string
+		expectedErr error
+	}{
+		{
+			name:        "found",
+			username:    "pasha",
+			alias:       "lms",
+			expectedUrl: "https://stepik.org/learn",
+		},
+		{
+			name:        "cache degradation",
+			username:    "pasha",
+			alias:       "lms",
+			storageErr:  storage.ErrCacheGet,
+			expectedUrl: "https://stepik.org/learn",
+		},
+		{
+			name:        "not found",
+			username:    "pasha",
+			alias:       "gmail",
+			expectedErr: ErrAliasNotFound,
+		},
+		{
+			name:        "storage failure",
+			username:    "pasha",
+			alias:       "lms",
+			storageErr:  errConnection,
+			expectedErr: errConnection,
+		},
+		{
+			name:        "empty alias",
+			username:    "pasha",
+			expectedErr: ErrEmptyAlias,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			s.urls["pasha/lms"] = "https://stepik.org/learn"
+			s.err = tt.storageErr
+
+			link, err := newShortener(s).Resolve(context.Background(), tt.username, tt.alias)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedUrl, link.Url)
+		})
+	}
+}
+
+func TestShortener_CheckPassword(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev/doc", Alias: "docs", Password: "secret"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, s.links["pasha/docs"].PasswordHash)
+	assert.NotEqual(t, "secret", s.links["pasha/docs"].PasswordHash)
+
+	link, err := svc.Resolve(context.Background(), "pasha", "docs")
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.CheckPassword(link, "secret"))
+	assert.ErrorIs(t, svc.CheckPassword(link, ""), ErrPasswordRequired)
+	assert.ErrorIs(t, svc.CheckPassword(link, "guess"), ErrWrongPassword)
+	assert.NoError(t, svc.CheckPassword(storage.Link{Url: "https://go.dev"}, ""))
+}
+
+func TestShortener_Visit(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "invite", MaxClicks: 2})
+	assert.NoError(t, err)
+
+	link, err := svc.Resolve(context.Background(), "pasha", "invite")
+	assert.NoError(t, err)
+
+	visited, err := svc.Visit(context.Background(), link)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), visited.RemainingClicks)
+	assert.Equal(t, int64(1), visited.Clicks)
+
+	_, err = svc.Visit(context.Background(), link)
+	assert.NoError(t, err)
+
+	_, err = svc.Visit(context.Background(), link)
+	assert.ErrorIs(t, err, ErrLinkExhausted)
+
+	_, err = svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "go"})
+	assert.NoError(t, err)
+
+	unlimited, err := svc.Resolve(context.Background(), "pasha", "go")
+	assert.NoError(t, err)
+
+	visited, err = svc.Visit(context.Background(), unlimited)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), visited.Clicks)
+
+	link, err = svc.Resolve(context.Background(), "pasha", "go")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), link.Clicks)
+
+	_, err = svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", MaxClicks: -1})
+	assert.ErrorIs(t, err, ErrInvalidMaxClicks)
+}
+
+func TestShortener_ResolveWindow(t *testing.T) {
+	launch := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	end := launch.Add(24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		storageErr  error
+		expectedErr error
+	}{
+		{
+			name:        "before window",
+			now:         launch.Add(-time.Minute),
+			expectedErr: ErrLinkNotActive,
+		},
+		{
+			name:        "before window served from degraded cache",
+			now:         launch.Add(-time.Minute),
+			storageErr:  storage.ErrCacheGet,
+			expectedErr: ErrLinkNotActive,
+		},
+		{
+			name: "window start",
+			now:  launch,
+		},
+		{
+			name:        "window end",
+			now:         end,
+			expectedErr: ErrLinkExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			svc := newShortener(s)
+
+			_, err := svc.Save(context.Background(), NewLink{
+				Username:  "pasha",
+				Url:       "https://go.dev",
+				Alias:     "launch",
+				NotBefore: &launch,
+				NotAfter:  &end,
+			})
+			assert.NoError(t, err)
+
+			s.err = tt.storageErr
+			svc.now = func() time.Time { return tt.now }
+
+			link, err := svc.Resolve(context.Background(), "pasha", "launch")
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "https://go.dev", link.Url)
+		})
+	}
+
+	_, err := newShortener(newFakeStorage()).Save(context.Background(), NewLink{
+		Username:  "pasha",
+		Url:       "https://go.dev",
+		NotBefore: &end,
+		NotAfter:  &launch,
+	})
+	assert.ErrorIs(t, err, ErrInvalidWindow)
+}
+
+func TestShortener_Edit(t *testing.T) {
+	permanent := http.StatusMovedPermanently
+	invalid := http.StatusOK
+	noStore := "no-store"
+	injected := "no-store\r\nSet-Cookie: a=b"
+
+	tests := []struct {
+		name        string
+		alias       string
+		patch       storage.LinkPatch
+		expectedErr error
+	}{
+		{
+			name:  "redirect code",
+			alias: "lms",
+			patch: storage.LinkPatch{RedirectCode: &permanent},
+		},
+		{
+			name:  "cache control",
+			alias: "lms",
+			patch: storage.LinkPatch{CacheControl: &noStore},
+		},
+		{
+			name:        "invalid redirect code",
+			alias:       "lms",
+			patch:       storage.LinkPatch{RedirectCode: &invalid},
+			expectedErr: ErrInvalidRedirectCode,
+		},
+		{
+			name:        "header injection",
+			alias:       "lms",
+			patch:       storage.LinkPatch{CacheControl: &injected},
+			expectedErr: ErrInvalidCacheControl,
+		},
+		{
+			name:        "not found",
+			alias:       "gmail",
+			patch:       storage.LinkPatch{RedirectCode: &permanent},
+			expectedErr: ErrAliasNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			s.urls["pasha/lms"] = "https://stepik.org/learn"
+
+			link, err := newShortener(s).Edit(context.Background(), "pasha", tt.alias, tt.patch)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.patch.RedirectCode != nil {
+				assert.Equal(t, *tt.patch.RedirectCode, link.RedirectCode)
+			}
+			if tt.patch.CacheControl != nil {
+				assert.Equal(t, *tt.patch.CacheControl, link.CacheControl)
+			}
+		})
+	}
+}
+
+func TestShortener_Delete(t *testing.T) {
+	tests := []struct {
+		name        string
+		alias       string
+		storageErr  error
+		expectedErr error
+	}{
+		{
+			name:  "deleted",
+			alias: "lms",
+		},
+		{
+			name:       "cache degradation",
+			alias:      "lms",
+			storageErr: storage.ErrCacheDelete,
+		},
+		{
+			name:        "not found",
+			alias:       "gmail",
+			expectedErr: ErrAliasNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			s.urls["pasha/lms"] = "https://stepik.org/learn"
+			s.err = tt.storageErr
+
+			err := newShortener(s).Delete(context.Background(), "pasha", tt.alias)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotContains(t, s.urls, "pasha/"+tt.alias)
+		})
+	}
+}
+
+func TestShortener_Rename(t *testing.T) {
+	tests := []struct {
+		name        string
+		alias       string
+		newAlias    string
+		storageErr  error
+		expectedErr error
+	}{
+		{
+			name:     "renamed",
+			alias:    "lms",
+			newAlias: "yandex_lms",
+		},
+		{
+			name:  "generated new alias",
+			alias: "lms",
+		},
+		{
+			name:       "cache degradation",
+			alias:      "lms",
+			newAlias:   "yandex_lms",
+			storageErr: storage.ErrCacheUpdate,
+		},
+		{
+			name:        "new alias already exists",
+			alias:       "lms",
+			newAlias:    "kaif",
+			expectedErr: ErrNewAliasAlreadyExists,
+		},
+		{
+			name:        "not found",
+			alias:       "gmail",
+			newAlias:    "mail",
+			expectedErr: ErrAliasNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			s.urls["pasha/lms"] = "https://stepik.org/learn"
+			s.urls["pasha/kaif"] = "https://go.dev"
+			s.err = tt.storageErr
+
+			newAlias, err := newShortener(s).Rename(context.Background(), "pasha", tt.alias, tt.newAlias)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.newAlias != "" {
+				assert.Equal(t, tt.newAlias, newAlias)
+			}
+			assert.Equal(t, "https://stepik.org/learn", s.urls["pasha/"+newAlias])
+		})
+	}
+}
+
+func TestShortener_List(t *testing.T) {
+	s := newFakeStorage()
+	s.urls["pasha/lms"] = "https://stepik.org/learn"
+	s.urls["vova/lms"] = "https://stepik.org/learn"
+
+	links, err := newShortener(s).List(context.Background(), "pasha", storage.LinkFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Link{{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}}, links)
+
+	_, err = newShortener(s).List(context.Background(), "", storage.LinkFilter{})
+	assert.ErrorIs(t, err, ErrEmptyUsername)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxTags         = 20
+	MaxTagLength    = 32
+	MaxFolderLength = 64
+)
+
+var (
+	ErrInvalidTags = fmt.Errorf(
+		"a link can have up to %d tags of letters, digits, '-', '_' and '.', up to %d characters each",
+		MaxTags, MaxTagLength,
+	)
+	ErrInvalidFolder = fmt.Errorf("folder must be up to %d printable characters", MaxFolderLength)
+)
+
+// normalizeTags validates {tags} and returns them lower-cased, without duplicates and sorted, as storage keeps them.
+// Nil stays nil and empty stays empty, so patches can tell unchanged tags from removed ones
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !isTag(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTags, tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > MaxTags {
+		return nil, ErrInvalidTags
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func isTag(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+		return false
+	}
+
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeFolder validates {folder} and returns it without surrounding spaces, empty means no folder
+func normalizeFolder(folder string) (string, error) {
+	folder = strings.TrimSpace(folder)
+	if utf8.RuneCountInString(folder) > MaxFolderLength {
+		return "", ErrInvalidFolder
+	}
+
+	for _, r := range folder {
+		if !unicode.IsPrint(r) {
+			return "", ErrInvalidFolder
+		}
+	}
+
+	return folder, nil
+}
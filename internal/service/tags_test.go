@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_Tags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		folder   string
+		expected []string
+		err      error
+	}{
+		{
+			name:     "normalized",
+			tags:     []string{" Work ", "go", "work"},
+			folder:   " Projects ",
+			expected: []string{"go", "work"},
+		},
+		{
+			name: "no tags",
+		},
+		{
+			name: "space inside tag",
+			tags: []string{"go lang"},
+			err:  ErrInvalidTags,
+		},
+		{
+			name: "empty tag",
+			tags: []string{""},
+			err:  ErrInvalidTags,
+		},
+		{
+			name: "too long tag",
+			tags: []string{strings.Repeat("a", MaxTagLength+1)},
+			err:  ErrInvalidTags,
+		},
+		{
+			name:   "too long folder",
+			folder: strings.Repeat("a", MaxFolderLength+1),
+			err:    ErrInvalidFolder,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStorage()
+			svc := newShortener(s)
+
+			_, err := svc.Save(context.Background(), NewLink{
+				Username: "pasha",
+				Url:      "https://go.dev",
+				Alias:    "go",
+				Tags:     tt.tags,
+				Folder:   tt.folder,
+			})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, s.links["pasha/go"].Tags)
+			assert.Equal(t, strings.TrimSpace(tt.folder), s.links["pasha/go"].Folder)
+		})
+	}
+}
+
+func TestShortener_EditTags(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "go", Tags: []string{"go"}})
+	require.NoError(t, err)
+
+	folder := "docs"
+	link, err := svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Tags: []string{"Lang", "go"}, Folder: &folder})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "lang"}, link.Tags)
+	assert.Equal(t, "docs", link.Folder)
+
+	link, err = svc.Edit(context.Background(), "pasha", "go", storage.LinkPatch{Tags: []string{}})
+	require.NoError(t, err)
+	assert.Empty(t, link.Tags)
+	assert.Equal(t, "docs", link.Folder)
+}
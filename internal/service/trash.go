@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"url-shortener/internal/storage"
+)
+
+// ListTrash returns deleted links of {username} that can still be restored, recently deleted first
+func (s *Shortener) ListTrash(ctx context.Context, username string) ([]storage.TrashedLink, error) {
+	const op = "service.ListTrash"
+
+	if username == "" {
+		return nil, ErrEmptyUsername
+	}
+
+	links, err := s.storage.ListTrash(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return links, nil
+}
+
+// Restore moves {alias} of {username} back from the trash and returns the link.
+// It fails with ErrAliasAlreadyExist if a new link took the alias meanwhile, the deleted one stays in the trash then
+func (s *Shortener) Restore(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "service.Restore"
+
+	if username == "" {
+		return storage.Link{}, ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return storage.Link{}, ErrEmptyAlias
+	}
+
+	link, err := s.storage.RestoreURL(ctx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, ErrAliasNotFound
+		}
+		if errors.Is(err, storage.ErrAliasAlreadyExist) {
+			return storage.Link{}, ErrAliasAlreadyExist
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.audit(ctx, ActionRestore, username, alias, nil, &link)
+
+	return link, nil
+}
+
+// Purge deletes {alias} of {username} from the trash permanently
+func (s *Shortener) Purge(ctx context.Context, username, alias string) error {
+	const op = "service.Purge"
+
+	if username == "" {
+		return ErrEmptyUsername
+	}
+
+	if alias == "" {
+		return ErrEmptyAlias
+	}
+
+	if err := s.storage.PurgeTrashed(ctx, username, alias); err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return ErrAliasNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.audit(ctx, ActionPurge, username, alias, nil, nil)
+
+	return nil
+}
+
+// EmptyTrash deletes links of all users whose retention in the trash has passed and returns how many
+func (s *Shortener) EmptyTrash(ctx context.Context) (int64, error) {
+	const op = "service.EmptyTrash"
+
+	n, err := s.storage.EmptyTrash(ctx, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n, nil
+}
+
+// EmptyTrashEvery calls EmptyTrash every {interval} until {ctx} is done, non-positive {interval} disables it
+func (s *Shortener) EmptyTrashEvery(ctx context.Context, interval time.Duration) {
+	const op = "service.EmptyTrashEvery"
+
+	if interval <= 0 {
+		s.log.Warn("trash cleanup is disabled, expired links stay in the trash", slog.String("op", op))
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.EmptyTrash(ctx)
+			if err != nil {
+				s.log.Error(err.Error(), slog.String("op", op))
+				continue
+			}
+			if n > 0 {
+				s.log.Info("expired trash emptied", slog.Int64("links", n), slog.String("op", op))
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_Trash(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	_, err := svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://stepik.org/learn", Alias: "lms"})
+	require.NoError(t, err)
+	require.NoError(t, svc.Delete(context.Background(), "pasha", "lms"))
+
+	trashed, err := svc.ListTrash(context.Background(), "pasha")
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	assert.Equal(t, now.Add(24*time.Hour), trashed[0].ExpiresAt)
+
+	_, err = svc.Save(context.Background(), NewLink{Username: "pasha", Url: "https://go.dev", Alias: "lms"})
+	require.NoError(t, err)
+	_, err = svc.Restore(context.Background(), "pasha", "lms")
+	assert.ErrorIs(t, err, ErrAliasAlreadyExist)
+
+	_, err = svc.Rename(context.Background(), "pasha", "lms", "go")
+	require.NoError(t, err)
+	link, err := svc.Restore(context.Background(), "pasha", "lms")
+	require.NoError(t, err)
+	assert.Equal(t, "https://stepik.org/learn", link.Url)
+
+	assert.ErrorIs(t, svc.Purge(context.Background(), "pasha", "lms"), ErrAliasNotFound)
+
+	require.NoError(t, svc.Delete(context.Background(), "pasha", "lms"))
+	now = now.Add(25 * time.Hour)
+	n, err := svc.EmptyTrash(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestShortener_EmptyTrashEveryDisabled(t *testing.T) {
+	svc := newShortener(newFakeStorage())
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		done := make(chan struct{})
+		go func() {
+			svc.EmptyTrashEvery(context.Background(), interval)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("EmptyTrashEvery(%s) did not return", interval)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"url-shortener/internal/storage"
+)
+
+// userTTL is how long settings of a user are reused before they are read from storage again
+const userTTL = time.Minute
+
+type userEntry struct {
+	user    storage.User
+	expires time.Time
+}
+
+// user returns settings of {username} applying to all their links, users unknown to storage have the defaults.
+// They are kept for userTTL, and a failure to read them falls back to the defaults for the redirect
+func (s *Shortener) user(ctx context.Context, username string) storage.User {
+	const op = "service.user"
+
+	if s.users == nil {
+		return storage.User{}
+	}
+
+	now := s.now()
+
+	s.mu.Lock()
+	entry, ok := s.settings[username]
+	s.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.user
+	}
+
+	user, err := s.users.GetUser(ctx, username)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		s.log.Error(err.Error(), slog.String("op", op))
+		return storage.User{}
+	}
+
+	s.mu.Lock()
+	s.settings[username] = userEntry{user: user, expires: now.Add(userTTL)}
+	s.mu.Unlock()
+
+	return user
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"url-shortener/internal/storage"
+)
+
+// maxVariantWeight keeps the sum of weights far from overflow
+const maxVariantWeight = 1_000_000
+
+var ErrInvalidVariants = errors.New("variants must have distinct valid urls and a weight from 1 to 1000000")
+
+// PickVariant returns index of the variant of {link} the client is sent to, or -1 if the link has no variants.
+// The variant with {sticky} url is kept while the link still has it, so a visitor sees the same variant,
+// otherwise a variant is picked at random by weight
+func (s *Shortener) PickVariant(link storage.Link, sticky string) int {
+	if len(link.Variants) == 0 {
+		return -1
+	}
+
+	total := 0
+	for i, v := range link.Variants {
+		if sticky != "" && v.Url == sticky {
+			return i
+		}
+		total += v.Weight
+	}
+
+	if total <= 0 {
+		return 0
+	}
+
+	n := s.intn(total)
+	for i, v := range link.Variants {
+		if n < v.Weight {
+			return i
+		}
+		n -= v.Weight
+	}
+
+	return len(link.Variants) - 1
+}
+
+// CountVariant counts a click of the variant at {index} of {link}.
+// The variant is found by its url in storage, variants may have been reordered since {link} was read
+func (s *Shortener) CountVariant(ctx context.Context, link storage.Link, index int) error {
+	const op = "service.CountVariant"
+
+	if index < 0 || index >= len(link.Variants) {
+		return fmt.Errorf("%s: %w", op, storage.ErrVariantNotFound)
+	}
+
+	if err := s.storage.CountVariantClick(ctx, link.Username, link.Alias, link.Variants[index].Url); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// validateVariants requires distinct urls, clicks are counted by the url of the variant
+func (s *Shortener) validateVariants(variants []storage.Variant) error {
+	urls := make(map[string]struct{}, len(variants))
+	for _, v := range variants {
+		if v.Weight < 1 || v.Weight > maxVariantWeight {
+			return ErrInvalidVariants
+		}
+		if _, ok := urls[v.Url]; ok {
+			return fmt.Errorf("%w: %s is repeated", ErrInvalidVariants, v.Url)
+		}
+		urls[v.Url] = struct{}{}
+		if err := s.validate.Var(v.Url, "required,url"); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidVariants, err)
+		}
+	}
+
+	return nil
+}
+
+// withoutClicks returns a copy of {variants} with zero clicks, clicks are counted by storage only
+func withoutClicks(variants []storage.Variant) []storage.Variant {
+	if variants == nil {
+		return nil
+	}
+
+	reset := make([]storage.Variant, 0, len(variants))
+	for _, v := range variants {
+		reset = append(reset, storage.Variant{Url: v.Url, Weight: v.Weight})
+	}
+
+	return reset
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_PickVariant(t *testing.T) {
+	link := storage.Link{
+		Username: "pasha",
+		Alias:    "landing",
+		Url:      "https://example.com",
+		Variants: []storage.Variant{
+			{Url: "https://example.com/a", Weight: 1},
+			{Url: "https://example.com/b", Weight: 3},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		link     storage.Link
+		sticky   string
+		n        int
+		expected int
+	}{
+		{
+			name:     "no variants",
+			link:     storage.Link{Url: "https://example.com"},
+			expected: -1,
+		},
+		{
+			name:     "first by weight",
+			link:     link,
+			n:        0,
+			expected: 0,
+		},
+		{
+			name:     "second by weight",
+			link:     link,
+			n:        1,
+			expected: 1,
+		},
+		{
+			name:     "last by weight",
+			link:     link,
+			n:        3,
+			expected: 1,
+		},
+		{
+			name:     "sticky",
+			link:     link,
+			sticky:   "https://example.com/a",
+			n:        3,
+			expected: 0,
+		},
+		{
+			name:     "sticky variant removed",
+			link:     link,
+			sticky:   "https://example.com/c",
+			n:        3,
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newShortener(newFakeStorage())
+			svc.intn = func(total int) int {
+				assert.Equal(t, 4, total)
+				return tt.n
+			}
+
+			assert.Equal(t, tt.expected, svc.PickVariant(tt.link, tt.sticky))
+		})
+	}
+}
+
+func TestShortener_SaveVariants(t *testing.T) {
+	s := newFakeStorage()
+	svc := newShortener(s)
+
+	_, err := svc.Save(context.Background(), NewLink{
+		Username: "pasha",
+		Url:      "https://example.com",
+		Alias:    "landing",
+		Variants: []storage.Variant{{Url: "https://example.com/a", Weight: 1, Clicks: 10}},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, s.links["pasha/landing"].Variants[0].Clicks)
+
+	link, err := svc.Resolve(context.Background(), "pasha", "landing")
+	require.NoError(t, err)
+	require.NoError(t, svc.CountVariant(context.Background(), link, 0))
+	assert.Equal(t, int64(1), s.links["pasha/landing"].Variants[0].Clicks)
+
+	_, err = svc.Save(context.Background(), NewLink{
+		Username: "pasha",
+		Url:      "https://example.com",
+		Variants: []storage.Variant{{Url: "https://example.com/a", Weight: 0}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidVariants)
+
+	_, err = svc.Save(context.Background(), NewLink{
+		Username: "pasha",
+		Url:      "https://example.com",
+		Variants: []storage.Variant{{Url: "https://example.com/a", Weight: 1}, {Url: "https://example.com/a", Weight: 2}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidVariants)
+}
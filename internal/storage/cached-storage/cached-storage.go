@@ -0,0 +1,196 @@
+package cachedStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/cache"
+	"url-shortener/internal/storage"
+)
+
+// Storage wraps any storage.Storage with cache-aside caching.
+// The underlying storage is the source of truth: cache failures never fail an operation
+// that succeeded in storage, they are reported with storage.ErrCache* alongside the result.
+// Click-limited links are never cached, their remaining clicks are always counted in storage
+type Storage struct {
+	storage storage.Storage
+	cache   cache.Cache
+}
+
+// Cacheable reports whether {link} may be kept in cache, anything filling the cache must follow it
+func Cacheable(link storage.Link) bool {
+	return link.MaxClicks == 0
+}
+
+func New(s storage.Storage, c cache.Cache) *Storage {
+	return &Storage{
+		storage: s,
+		cache:   c,
+	}
+}
+
+func (s *Storage) Close(ctx context.Context) error {
+	err1 := s.cache.Close(ctx)
+	err2 := s.storage.Close(ctx)
+
+	if err1 != nil && err2 != nil {
+		return fmt.Errorf("%w && %w", err1, err2)
+	} else if err1 != nil {
+		return err1
+	} else if err2 != nil {
+		return err2
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveLink(ctx context.Context, link storage.Link) error {
+	const op = "cachedStorage.SaveLink"
+
+	if err := s.storage.SaveLink(ctx, link); err != nil {
+		return err
+	}
+
+	if !Cacheable(link) {
+		return nil
+	}
+
+	if err := s.cache.Set(ctx, link); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheSet, err)
+	}
+
+	return nil
+}
+
+// GetLink returns link from cache, falling back to storage on a miss or a cache failure.
+// Cached links keep their password hash, so protected links are checked on every hit.
+// If the link was found in storage but the cache could not be read or filled,
+// the link is returned together with storage.ErrCacheGet or storage.ErrCacheSet
+func (s *Storage) GetLink(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "cachedStorage.GetLink"
+
+	link, cacheErr := s.cache.Get(ctx, username, alias)
+	if cacheErr == nil {
+		return link, nil
+	}
+
+	link, err := s.storage.GetLink(ctx, username, alias)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	if !errors.Is(cacheErr, cache.ErrNotFound) {
+		return link, fmt.Errorf("%s: %w: %w", op, storage.ErrCacheGet, cacheErr)
+	}
+
+	if !Cacheable(link) {
+		return link, nil
+	}
+
+	if err := s.cache.Set(ctx, link); err != nil {
+		return link, fmt.Errorf("%s: %w: %w", op, storage.ErrCacheSet, err)
+	}
+
+	return link, nil
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, username, alias string) error {
+	const op = "cachedStorage.DeleteURL"
+
+	if err := s.storage.DeleteURL(ctx, username, alias); err != nil {
+		return err
+	}
+
+	if err := s.cache.Delete(ctx, username, alias); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheDelete, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TrashURL(ctx context.Context, username, alias string, deletedAt, expiresAt time.Time) error {
+	const op = "cachedStorage.TrashURL"
+
+	if err := s.storage.TrashURL(ctx, username, alias, deletedAt, expiresAt); err != nil {
+		return err
+	}
+
+	if err := s.cache.Delete(ctx, username, alias); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheDelete, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListTrash(ctx context.Context, username string) ([]storage.TrashedLink, error) {
+	return s.storage.ListTrash(ctx, username)
+}
+
+// RestoreURL does not cache the restored link, it is cached on the next read
+func (s *Storage) RestoreURL(ctx context.Context, username, alias string) (storage.Link, error) {
+	return s.storage.RestoreURL(ctx, username, alias)
+}
+
+func (s *Storage) PurgeTrashed(ctx context.Context, username, alias string) error {
+	return s.storage.PurgeTrashed(ctx, username, alias)
+}
+
+func (s *Storage) EmptyTrash(ctx context.Context, before time.Time) (int64, error) {
+	return s.storage.EmptyTrash(ctx, before)
+}
+
+func (s *Storage) UpdateAlias(ctx context.Context, username, oldAlias, newAlias string) error {
+	const op = "cachedStorage.UpdateAlias"
+
+	if err := s.storage.UpdateAlias(ctx, username, oldAlias, newAlias); err != nil {
+		return err
+	}
+
+	// the link is cached again under the new alias on the next read
+	if err := s.cache.Delete(ctx, username, oldAlias); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheUpdate, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateLink(ctx context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	const op = "cachedStorage.UpdateLink"
+
+	link, err := s.storage.UpdateLink(ctx, username, alias, patch)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	// a renamed link is cached again under its new alias on the next read
+	if err := s.cache.Delete(ctx, username, alias); err != nil {
+		return link, fmt.Errorf("%s: %w: %w", op, storage.ErrCacheUpdate, err)
+	}
+
+	return link, nil
+}
+
+func (s *Storage) LinkHistory(ctx context.Context, username, alias string) ([]storage.LinkVersion, error) {
+	return s.storage.LinkHistory(ctx, username, alias)
+}
+
+func (s *Storage) ListURLs(ctx context.Context, username string, filter storage.LinkFilter) ([]storage.Link, error) {
+	return s.storage.ListURLs(ctx, username, filter)
+}
+
+// CountClick counts in storage only, so clicks of cached links are not up to date
+// until the link is evicted, links are listed from storage anyway
+func (s *Storage) CountClick(ctx context.Context, username, alias string) error {
+	return s.storage.CountClick(ctx, username, alias)
+}
+
+// CountVariantClick counts in storage only, so clicks of cached links are not up to date
+// until the link is evicted, links are listed from storage anyway
+func (s *Storage) CountVariantClick(ctx context.Context, username, alias, url string) error {
+	return s.storage.CountVariantClick(ctx, username, alias, url)
+}
+
+func (s *Storage) UseClick(ctx context.Context, username, alias string) (storage.Link, error) {
+	return s.storage.UseClick(ctx, username, alias)
+}
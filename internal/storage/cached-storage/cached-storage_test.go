@@ -0,0 +1,358 @@
+package cachedStorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/cache"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errCacheDown = errors.New("cache is down")
+
+type fakeStorage struct {
+	links map[string]storage.Link
+	reads int
+}
+
+func (f *fakeStorage) SaveLink(_ context.Context, link storage.Link) error {
+	if _, ok := f.links[link.Username+"/"+link.Alias]; ok {
+		return storage.ErrAliasAlreadyExist
+	}
+	f.links[link.Username+"/"+link.Alias] = link
+	return nil
+}
+
+func (f *fakeStorage) GetLink(_ context.Context, username, alias string) (storage.Link, error) {
+	f.reads++
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	return link, nil
+}
+
+func (f *fakeStorage) DeleteURL(_ context.Context, username, alias string) error {
+	if _, ok := f.links[username+"/"+alias]; !ok {
+		return storage.ErrAliasNotFound
+	}
+	delete(f.links, username+"/"+alias)
+	return nil
+}
+
+func (f *fakeStorage) TrashURL(ctx context.Context, username, alias string, _, _ time.Time) error {
+	return f.DeleteURL(ctx, username, alias)
+}
+
+func (f *fakeStorage) ListTrash(context.Context, string) ([]storage.TrashedLink, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) RestoreURL(context.Context, string, string) (storage.Link, error) {
+	return storage.Link{}, storage.ErrAliasNotFound
+}
+
+func (f *fakeStorage) PurgeTrashed(context.Context, string, string) error {
+	return storage.ErrAliasNotFound
+}
+
+func (f *fakeStorage) EmptyTrash(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeStorage) LinkHistory(context.Context, string, string) ([]storage.LinkVersion, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) UpdateAlias(_ context.Context, username, oldAlias, newAlias string) error {
+	link, ok := f.links[username+"/"+oldAlias]
+	if !ok {
+		return storage.ErrAliasNotFound
+	}
+	delete(f.links, username+"/"+oldAlias)
+	link.Alias = newAlias
+	f.links[username+"/"+newAlias] = link
+	return nil
+}
+
+func (f *fakeStorage) UpdateLink(_ context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	if patch.Url != nil {
+		link.Url = *patch.Url
+	}
+	if patch.Disabled != nil {
+		link.Disabled = *patch.Disabled
+	}
+	if patch.DisabledBy != nil {
+		link.DisabledBy = *patch.DisabledBy
+	}
+	if patch.DisabledReason != nil {
+		link.DisabledReason = *patch.DisabledReason
+	}
+	if patch.RedirectCode != nil {
+		link.RedirectCode = *patch.RedirectCode
+	}
+	if patch.CacheControl != nil {
+		link.CacheControl = *patch.CacheControl
+	}
+	if patch.QueryPassthrough != nil {
+		link.QueryPassthrough = *patch.QueryPassthrough
+	}
+	if patch.PathPassthrough != nil {
+		link.PathPassthrough = *patch.PathPassthrough
+	}
+	if patch.UTM != nil {
+		link.UTM = *patch.UTM
+	}
+	if patch.Routes != nil {
+		link.Routes = patch.Routes
+	}
+	if patch.Countries != nil {
+		link.Countries = patch.Countries
+	}
+	if patch.Variants != nil {
+		link.Variants = patch.Variants
+	}
+	f.links[username+"/"+alias] = link
+	return link, nil
+}
+
+func (f *fakeStorage) ListURLs(_ context.Context, username string, _ storage.LinkFilter) ([]storage.Link, error) {
+	links := make([]storage.Link, 0)
+	for _, link := range f.links {
+		if link.Username == username {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (f *fakeStorage) UseClick(_ context.Context, username, alias string) (storage.Link, error) {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, storage.ErrAliasNotFound
+	}
+	if link.RemainingClicks == 0 {
+		return storage.Link{}, storage.ErrClicksExhausted
+	}
+	link.RemainingClicks--
+	link.Clicks++
+	f.links[username+"/"+alias] = link
+	return link, nil
+}
+
+func (f *fakeStorage) CountClick(_ context.Context, username, alias string) error {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.ErrAliasNotFound
+	}
+	link.Clicks++
+	f.links[username+"/"+alias] = link
+	return nil
+}
+
+func (f *fakeStorage) CountVariantClick(_ context.Context, username, alias, url string) error {
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.ErrVariantNotFound
+	}
+	for i := range link.Variants {
+		if link.Variants[i].Url == url {
+			link.Variants[i].Clicks++
+			return nil
+		}
+	}
+	return storage.ErrVariantNotFound
+}
+
+func (f *fakeStorage) Close(context.Context) error {
+	return nil
+}
+
+type fakeCache struct {
+	links map[string]storage.Link
+	err   error
+}
+
+func (f *fakeCache) Set(_ context.Context, link storage.Link) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.links[link.Username+"/"+link.Alias] = link
+	return nil
+}
+
+func (f *fakeCache) Get(_ context.Context, username, alias string) (storage.Link, error) {
+	if f.err != nil {
+		return storage.Link{}, f.err
+	}
+	link, ok := f.links[username+"/"+alias]
+	if !ok {
+		return storage.Link{}, cache.ErrNotFound
+	}
+	return link, nil
+}
+
+func (f *fakeCache) Delete(_ context.Context, username, alias string) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.links, username+"/"+alias)
+	return nil
+}
+
+func (f *fakeCache) Flush(context.Context) error {
+	f.links = make(map[string]storage.Link)
+	return nil
+}
+
+func (f *fakeCache) Keys(context.Context) ([]cache.KeyType, error) {
+	keys := make([]cache.KeyType, 0, len(f.links))
+	for key := range f.links {
+		username, alias, _ := strings.Cut(key, "/")
+		keys = append(keys, cache.KeyType{Username: username, Alias: alias})
+	}
+	return keys, nil
+}
+
+func (f *fakeCache) Close(context.Context) error {
+	return nil
+}
+
+var lms = storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}
+
+func newStorage() (*Storage, *fakeStorage, *fakeCache) {
+	s := &fakeStorage{links: map[string]storage.Link{"pasha/lms": lms}}
+	c := &fakeCache{links: make(map[string]storage.Link)}
+	return New(s, c), s, c
+}
+
+func TestStorage_GetLink(t *testing.T) {
+	t.Run("miss fills cache", func(t *testing.T) {
+		cs, s, c := newStorage()
+
+		link, err := cs.GetLink(context.Background(), "pasha", "lms")
+		assert.NoError(t, err)
+		assert.Equal(t, lms, link)
+		assert.Equal(t, lms, c.links["pasha/lms"])
+
+		link, err = cs.GetLink(context.Background(), "pasha", "lms")
+		assert.NoError(t, err)
+		assert.Equal(t, lms, link)
+		assert.Equal(t, 1, s.reads)
+	})
+
+	t.Run("cached link keeps password hash", func(t *testing.T) {
+		cs, s, c := newStorage()
+		protected := storage.Link{Username: "pasha", Alias: "docs", Url: "https://go.dev/doc", PasswordHash: "hash"}
+		s.links["pasha/docs"] = protected
+
+		_, err := cs.GetLink(context.Background(), "pasha", "docs")
+		assert.NoError(t, err)
+		assert.Equal(t, "hash", c.links["pasha/docs"].PasswordHash)
+
+		link, err := cs.GetLink(context.Background(), "pasha", "docs")
+		assert.NoError(t, err)
+		assert.Equal(t, protected, link)
+	})
+
+	t.Run("limited link is not cached", func(t *testing.T) {
+		cs, s, c := newStorage()
+		s.links["pasha/invite"] = storage.Link{Username: "pasha", Alias: "invite", Url: "https://go.dev", MaxClicks: 1, RemainingClicks: 1}
+
+		_, err := cs.GetLink(context.Background(), "pasha", "invite")
+		assert.NoError(t, err)
+		assert.NotContains(t, c.links, "pasha/invite")
+
+		_, err = cs.UseClick(context.Background(), "pasha", "invite")
+		assert.NoError(t, err)
+		_, err = cs.UseClick(context.Background(), "pasha", "invite")
+		assert.ErrorIs(t, err, storage.ErrClicksExhausted)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		cs, _, _ := newStorage()
+
+		_, err := cs.GetLink(context.Background(), "pasha", "gmail")
+		assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+	})
+
+	t.Run("cache failure falls back to storage", func(t *testing.T) {
+		cs, _, c := newStorage()
+		c.err = errCacheDown
+
+		link, err := cs.GetLink(context.Background(), "pasha", "lms")
+		assert.ErrorIs(t, err, storage.ErrCacheGet)
+		assert.Equal(t, lms, link)
+	})
+
+	t.Run("cache failure does not hide not found", func(t *testing.T) {
+		cs, _, c := newStorage()
+		c.err = errCacheDown
+
+		_, err := cs.GetLink(context.Background(), "pasha", "gmail")
+		assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+		assert.NotErrorIs(t, err, storage.ErrCacheGet)
+	})
+}
+
+func TestStorage_SaveLink(t *testing.T) {
+	cs, s, c := newStorage()
+	golang := storage.Link{Username: "pasha", Alias: "go", Url: "https://go.dev"}
+
+	assert.NoError(t, cs.SaveLink(context.Background(), golang))
+	assert.Equal(t, golang, s.links["pasha/go"])
+	assert.Equal(t, golang, c.links["pasha/go"])
+
+	assert.ErrorIs(t, cs.SaveLink(context.Background(), golang), storage.ErrAliasAlreadyExist)
+
+	c.err = errCacheDown
+	golang.Alias = "golang"
+	err := cs.SaveLink(context.Background(), golang)
+	assert.ErrorIs(t, err, storage.ErrCacheSet)
+	assert.Equal(t, golang, s.links["pasha/golang"])
+}
+
+func TestStorage_DeleteURL(t *testing.T) {
+	cs, s, c := newStorage()
+	c.links["pasha/lms"] = lms
+
+	assert.NoError(t, cs.DeleteURL(context.Background(), "pasha", "lms"))
+	assert.NotContains(t, s.links, "pasha/lms")
+	assert.NotContains(t, c.links, "pasha/lms")
+
+	assert.ErrorIs(t, cs.DeleteURL(context.Background(), "pasha", "lms"), storage.ErrAliasNotFound)
+}
+
+func TestStorage_UpdateAlias(t *testing.T) {
+	cs, s, c := newStorage()
+	c.links["pasha/lms"] = lms
+
+	assert.NoError(t, cs.UpdateAlias(context.Background(), "pasha", "lms", "yandex_lms"))
+	assert.Contains(t, s.links, "pasha/yandex_lms")
+	assert.NotContains(t, c.links, "pasha/lms")
+
+	c.err = errCacheDown
+	err := cs.UpdateAlias(context.Background(), "pasha", "yandex_lms", "lms")
+	assert.ErrorIs(t, err, storage.ErrCacheUpdate)
+	assert.Contains(t, s.links, "pasha/lms")
+}
+
+func TestStorage_UpdateLink(t *testing.T) {
+	cs, s, c := newStorage()
+	c.links["pasha/lms"] = lms
+	code := 301
+
+	link, err := cs.UpdateLink(context.Background(), "pasha", "lms", storage.LinkPatch{RedirectCode: &code})
+	assert.NoError(t, err)
+	assert.Equal(t, 301, link.RedirectCode)
+	assert.Equal(t, 301, s.links["pasha/lms"].RedirectCode)
+	assert.NotContains(t, c.links, "pasha/lms")
+}
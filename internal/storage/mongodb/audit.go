@@ -0,0 +1,138 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"url-shortener/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Audit struct {
+	*mongo.Collection
+}
+
+// AuditRecord is an audit event, links are kept as they were in the links collection
+type AuditRecord struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Time      time.Time          `bson:"time"`
+	Actor     string             `bson:"actor"`
+	Action    string             `bson:"action"`
+	Username  string             `bson:"username"`
+	Alias     string             `bson:"alias"`
+	Before    *Record            `bson:"before,omitempty"`
+	After     *Record            `bson:"after,omitempty"`
+	IP        string             `bson:"ip,omitempty"`
+	RequestID string             `bson:"request_id,omitempty"`
+}
+
+func (s *Store) SaveAuditEvent(ctx context.Context, event storage.AuditEvent) error {
+	const op = "mongodb.SaveAuditEvent"
+
+	record := AuditRecord{
+		Time:      event.Time.UTC(),
+		Actor:     event.Actor,
+		Action:    event.Action,
+		Username:  event.Username,
+		Alias:     event.Alias,
+		Before:    toRecordPtr(event.Before),
+		After:     toRecordPtr(event.After),
+		IP:        event.IP,
+		RequestID: event.RequestID,
+	}
+
+	if _, err := s.audit.InsertOne(ctx, record); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	const op = "mongodb.ListAuditEvents"
+
+	query := bson.D{}
+	match := func(field, value string) {
+		if value != "" {
+			query = append(query, bson.E{Key: field, Value: value})
+		}
+	}
+	match("actor", filter.Actor)
+	match("action", filter.Action)
+	match("username", filter.Username)
+	match("alias", filter.Alias)
+
+	bounds := bson.D{}
+	if !filter.Since.IsZero() {
+		bounds = append(bounds, bson.E{Key: "$gte", Value: filter.Since.UTC()})
+	}
+	if !filter.Until.IsZero() {
+		bounds = append(bounds, bson.E{Key: "$lt", Value: filter.Until.UTC()})
+	}
+	if len(bounds) > 0 {
+		query = append(query, bson.E{Key: "time", Value: bounds})
+	}
+
+	if filter.Cursor != "" {
+		id, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		query = append(query, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := s.audit.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var records []AuditRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events := make([]storage.AuditEvent, 0, len(records))
+	for _, r := range records {
+		events = append(events, storage.AuditEvent{
+			ID:        r.ID.Hex(),
+			Time:      r.Time,
+			Actor:     r.Actor,
+			Action:    r.Action,
+			Username:  r.Username,
+			Alias:     r.Alias,
+			Before:    r.Before.toLinkPtr(),
+			After:     r.After.toLinkPtr(),
+			IP:        r.IP,
+			RequestID: r.RequestID,
+		})
+	}
+
+	return events, nil
+}
+
+func toRecordPtr(link *storage.Link) *Record {
+	if link == nil {
+		return nil
+	}
+
+	record := toRecord(*link)
+	return &record
+}
+
+func (r *Record) toLinkPtr() *storage.Link {
+	if r == nil {
+		return nil
+	}
+
+	link := r.toLink()
+	return &link
+}
@@ -0,0 +1,73 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VersionRecord is the alias and url a link had before a change, kept in the link document
+type VersionRecord struct {
+	Alias     string    `bson:"alias"`
+	Url       string    `bson:"url"`
+	ChangedBy string    `bson:"changed_by"`
+	ChangedAt time.Time `bson:"changed_at"`
+}
+
+func (s *Store) LinkHistory(ctx context.Context, username, alias string) ([]storage.LinkVersion, error) {
+	const op = "mongodb.LinkHistory"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+	opts := options.FindOne().SetProjection(bson.D{{Key: "history", Value: 1}})
+
+	var result Record
+	err := s.records.FindOne(ctx, filter, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, storage.ErrAliasNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions := make([]storage.LinkVersion, 0, len(result.History))
+	for i, v := range result.History {
+		versions = append(versions, storage.LinkVersion{
+			Version:   i + 1,
+			Alias:     v.Alias,
+			Url:       v.Url,
+			ChangedBy: v.ChangedBy,
+			ChangedAt: v.ChangedAt,
+		})
+	}
+
+	return versions, nil
+}
+
+// recordVersion is an update pipeline stage appending the alias and url the link has before the update
+// to its history, so the history is written atomically with the change.
+// With {changed} the version is recorded only if the expression is true
+func recordVersion(changedBy string, changed any) bson.D {
+	current := bson.D{{Key: "$ifNull", Value: bson.A{"$history", bson.A{}}}}
+
+	var history any = bson.D{{Key: "$concatArrays", Value: bson.A{current, bson.A{bson.D{
+		{Key: "alias", Value: "$alias"},
+		{Key: "url", Value: "$url"},
+		{Key: "changed_by", Value: literal(changedBy)},
+		{Key: "changed_at", Value: time.Now().UTC()},
+	}}}}}
+	if changed != nil {
+		history = bson.D{{Key: "$cond", Value: bson.A{changed, history, current}}}
+	}
+
+	return bson.D{{Key: "$set", Value: bson.D{{Key: "history", Value: history}}}}
+}
+
+// literal keeps values starting with $ from being read as field paths in pipeline stages
+func literal(v any) bson.D {
+	return bson.D{{Key: "$literal", Value: v}}
+}
@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// managedIndex is an index the store relies on, it is identified by the name of its model
+type managedIndex struct {
+	collection *mongo.Collection
+	model      mongo.IndexModel
+}
+
+func (s *Store) indexes() []managedIndex {
+	return []managedIndex{
+		{
+			// makes (username, alias) pairs unique, so concurrent saves and renames
+			// cannot create duplicates
+			collection: s.records.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}, {Key: "alias", Value: int32(1)}},
+				Options: options.Index().SetName("username_alias_unique").SetUnique(true),
+			},
+		},
+		{
+			// filters links of a user by tag, the index is multikey over the tags array
+			collection: s.records.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}, {Key: "tags", Value: int32(1)}},
+				Options: options.Index().SetName("username_tags"),
+			},
+		},
+		{
+			collection: s.records.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}, {Key: "folder", Value: int32(1)}},
+				Options: options.Index().SetName("username_folder"),
+			},
+		},
+		{
+			// a link deleted again replaces its earlier copy in the trash
+			collection: s.trash.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}, {Key: "alias", Value: int32(1)}},
+				Options: options.Index().SetName("trash_username_alias_unique").SetUnique(true),
+			},
+		},
+		{
+			// removes trashed links once their retention has passed, EmptyTrash only catches up with it
+			collection: s.trash.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: int32(1)}},
+				Options: options.Index().SetName("trash_expires_at_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		{
+			// audit events are queried by the changed link, by actor and by time
+			collection: s.audit.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}, {Key: "alias", Value: int32(1)}},
+				Options: options.Index().SetName("audit_username_alias"),
+			},
+		},
+		{
+			collection: s.audit.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "actor", Value: int32(1)}},
+				Options: options.Index().SetName("audit_actor"),
+			},
+		},
+		{
+			collection: s.audit.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "time", Value: int32(1)}},
+				Options: options.Index().SetName("audit_time"),
+			},
+		},
+		{
+			collection: s.users.Collection,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: int32(1)}},
+				Options: options.Index().SetName("username_unique").SetUnique(true),
+			},
+		},
+	}
+}
+
+// SyncIndexes creates missing managed indexes and recreates the ones whose definition changed.
+// Indexes created by other means are left untouched
+func (s *Store) SyncIndexes(ctx context.Context) error {
+	const op = "mongodb.SyncIndexes"
+
+	for _, index := range s.indexes() {
+		if err := syncIndex(ctx, index); err != nil {
+			return fmt.Errorf("%s: %s.%s: %w", op, index.collection.Name(), *index.model.Options.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func syncIndex(ctx context.Context, index managedIndex) error {
+	specs, err := index.collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if spec.Name != *index.model.Options.Name {
+			continue
+		}
+
+		same, err := sameIndex(spec, index.model)
+		if err != nil {
+			return err
+		}
+
+		if same {
+			return nil
+		}
+
+		if _, err := index.collection.Indexes().DropOne(ctx, spec.Name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := index.collection.Indexes().CreateOne(ctx, index.model); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("collection contains duplicates, remove them and restart: %w", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func sameIndex(spec *mongo.IndexSpecification, model mongo.IndexModel) (bool, error) {
+	keys, err := bson.Marshal(model.Keys)
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(keys, spec.KeysDocument) {
+		return false, nil
+	}
+
+	unique := model.Options.Unique != nil && *model.Options.Unique
+	if unique != (spec.Unique != nil && *spec.Unique) {
+		return false, nil
+	}
+
+	if (model.Options.ExpireAfterSeconds == nil) != (spec.ExpireAfterSeconds == nil) {
+		return false, nil
+	}
+
+	if model.Options.ExpireAfterSeconds != nil && *model.Options.ExpireAfterSeconds != *spec.ExpireAfterSeconds {
+		return false, nil
+	}
+
+	return true, nil
+}
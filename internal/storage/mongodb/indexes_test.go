@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestStore_TrashTTLIndex(t *testing.T) {
+	// Connect does not reach the server, the collections are only needed for their names
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+
+	db := client.Database("test")
+	s := &Store{
+		records: Records{Collection: db.Collection("urls")},
+		users:   Users{Collection: db.Collection("users")},
+		trash:   Trash{Collection: db.Collection("trash")},
+		audit:   Audit{Collection: db.Collection("audit")},
+	}
+
+	var ttl []managedIndex
+	for _, index := range s.indexes() {
+		if index.model.Options.ExpireAfterSeconds != nil {
+			ttl = append(ttl, index)
+		}
+	}
+
+	require.Len(t, ttl, 1)
+	assert.Equal(t, "trash", ttl[0].collection.Name())
+	assert.Equal(t, bson.D{{Key: "expires_at", Value: int32(1)}}, ttl[0].model.Keys)
+	assert.Equal(t, int32(0), *ttl[0].model.Options.ExpireAfterSeconds)
+	assert.Equal(t, "trash_expires_at_ttl", *ttl[0].model.Options.Name)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"time"
-	"url-shortener/internal/cache"
 	"url-shortener/internal/storage"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,20 +14,87 @@ import (
 
 type Store struct {
 	records Records
-	cache   cache.Cache
+	users   Users
+	trash   Trash
+	audit   Audit
 }
 
 type Records struct {
 	*mongo.Collection
 }
 
+type Users struct {
+	*mongo.Collection
+}
+
 type Record struct {
 	Username string `bson:"username"`
 	Alias    string `bson:"alias"`
 	Url      string `bson:"url"`
+	// PasswordHash protects the link with a password, empty means the link is public
+	PasswordHash string `bson:"password_hash,omitempty"`
+	// MaxClicks limits how many times the link can be opened, zero means no limit
+	MaxClicks       int64 `bson:"max_clicks,omitempty"`
+	RemainingClicks int64 `bson:"remaining_clicks,omitempty"`
+	// NotBefore and NotAfter bound the time the link redirects, nil means no bound
+	NotBefore *time.Time `bson:"not_before,omitempty"`
+	NotAfter  *time.Time `bson:"not_after,omitempty"`
+	// RedirectCode and CacheControl shape the redirect response, zero values mean the defaults
+	RedirectCode int    `bson:"redirect_code,omitempty"`
+	CacheControl string `bson:"cache_control,omitempty"`
+	// QueryPassthrough and PathPassthrough pass the incoming request through to the url
+	QueryPassthrough string `bson:"query_passthrough,omitempty"`
+	PathPassthrough  bool   `bson:"path_passthrough,omitempty"`
+	// UTM overrides default UTM parameters of the user
+	UTM *UTMRecord `bson:"utm,omitempty"`
+	// Routes maps a client platform to the url it is sent to
+	Routes map[string]string `bson:"routes,omitempty"`
+	// Countries maps a country code of the client to the url it is sent to
+	Countries map[string]string `bson:"countries,omitempty"`
+	// Variants split the traffic of the link by weight
+	Variants []VariantRecord `bson:"variants,omitempty"`
+	// CreatedAt of links saved before it was recorded is backfilled on start, UpdatedAt is the last change
+	CreatedAt *time.Time `bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `bson:"updated_at,omitempty"`
+	Clicks    int64      `bson:"clicks,omitempty"`
+	// Title, Description and Notes describe the link
+	Title       string `bson:"title,omitempty"`
+	Description string `bson:"description,omitempty"`
+	Notes       string `bson:"notes,omitempty"`
+	// Disabled links do not redirect
+	Disabled       bool   `bson:"disabled,omitempty"`
+	DisabledBy     string `bson:"disabled_by,omitempty"`
+	DisabledReason string `bson:"disabled_reason,omitempty"`
+	// Tags and Folder group links of the user
+	Tags   []string `bson:"tags,omitempty"`
+	Folder string   `bson:"folder,omitempty"`
+	// History is what the link was before each change of its alias or url, it is not part of storage.Link
+	History []VersionRecord `bson:"history,omitempty"`
+}
+
+type VariantRecord struct {
+	Url    string `bson:"url"`
+	Weight int    `bson:"weight"`
+	Clicks int64  `bson:"clicks"`
+}
+
+type UserRecord struct {
+	Username     string     `bson:"username"`
+	PasswordHash string     `bson:"password_hash"`
+	Disabled     bool       `bson:"disabled"`
+	UTM          *UTMRecord `bson:"utm,omitempty"`
+	ForcePreview bool       `bson:"force_preview,omitempty"`
+}
+
+type UTMRecord struct {
+	Source   string `bson:"source,omitempty"`
+	Medium   string `bson:"medium,omitempty"`
+	Campaign string `bson:"campaign,omitempty"`
+	Term     string `bson:"term,omitempty"`
+	Content  string `bson:"content,omitempty"`
 }
 
-func MustNew(timeout time.Duration, c cache.Cache, connString string, dbName string, collectionName string) *Store {
+func MustNew(timeout time.Duration, connString string, dbName string, collectionName string, usersCollectionName string, trashCollectionName string, auditCollectionName string) *Store {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -46,134 +112,681 @@ func MustNew(timeout time.Duration, c cache.Cache, connString string, dbName str
 			Collection: client.Database(dbName).Collection(collectionName),
 		}
 
-		return &Store{
+		users := Users{
+			Collection: client.Database(dbName).Collection(usersCollectionName),
+		}
+
+		trash := Trash{
+			Collection: client.Database(dbName).Collection(trashCollectionName),
+		}
+
+		audit := Audit{
+			Collection: client.Database(dbName).Collection(auditCollectionName),
+		}
+
+		s := &Store{
 			records: records,
-			cache:   c,
+			users:   users,
+			trash:   trash,
+			audit:   audit,
+		}
+
+		if err := s.SyncIndexes(ctx); err != nil {
+			panic(err)
+		}
+
+		if err := s.backfillCreatedAt(ctx); err != nil {
+			panic(err)
 		}
+
+		return s
 	}
 
 	return newFunc()
 }
 
+// backfillCreatedAt sets created_at of links saved before it was recorded to their first change
+// or, if they have none, to the time in their ObjectID. It does nothing once all links have it
+func (s *Store) backfillCreatedAt(ctx context.Context) error {
+	const op = "mongodb.backfillCreatedAt"
+
+	filter := bson.D{{Key: "created_at", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "created_at", Value: bson.D{{Key: "$ifNull", Value: bson.A{
+			bson.D{{Key: "$min", Value: "$history.changed_at"}},
+			bson.D{{Key: "$toDate", Value: "$_id"}},
+		}}}}}}},
+		{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: bson.D{{Key: "$ifNull", Value: bson.A{
+			bson.D{{Key: "$max", Value: "$history.changed_at"}},
+			"$created_at",
+		}}}}}}},
+	}
+
+	if _, err := s.records.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (s *Store) Close(ctx context.Context) error {
+	return s.records.Database().Client().Disconnect(ctx)
+}
+
+func (s *Store) SaveLink(ctx context.Context, link storage.Link) error {
+	const op = "mongodb.SaveLink"
 
-	err1 := s.cache.Close(ctx)
-	err2 := s.records.Database().Client().Disconnect(ctx)
+	_, err := s.records.InsertOne(ctx, toRecord(link))
 
-	if err1 != nil && err2 != nil {
-		return fmt.Errorf("%w && %w", err1, err2)
-	} else if err1 != nil {
-		return err1
-	} else if err2 != nil {
-		return err2
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+		}
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Store) SaveURL(ctx context.Context, url, alias, username string) error {
-	const op = "mongodb.SaveURL"
+func (s *Store) GetLink(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "mongodb.GetLink"
 
 	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
 
 	var result Record
 	err := s.records.FindOne(ctx, filter).Decode(&result)
-	if !errors.Is(err, mongo.ErrNoDocuments) {
-		return storage.ErrAliasAlreadyExist
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.Link{}, storage.ErrAliasNotFound
+	} else if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = s.records.InsertOne(ctx, Record{
-		Username: username,
-		Alias:    alias,
-		Url:      url,
-	})
+	return result.toLink(), nil
+}
+
+func (s *Store) DeleteURL(ctx context.Context, username, alias string) error {
+	const op = "mongodb.DeleteURL"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
 
+	res, err := s.records.DeleteOne(ctx, filter)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.cache.Set(ctx, url, alias, username); err != nil {
-		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheSet, err)
+	if res.DeletedCount == 0 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateAlias(ctx context.Context, username, oldAlias, newAlias string) error {
+	const op = "mongodb.UpdateAlias"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: oldAlias}}
+	update := mongo.Pipeline{
+		recordVersion(storage.ActorFromContext(ctx, username), nil),
+		{{Key: "$set", Value: bson.D{
+			{Key: "alias", Value: literal(newAlias)},
+			{Key: "updated_at", Value: time.Now().UTC()},
+		}}},
+	}
+
+	res, err := s.records.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return storage.ErrNewAliasAlreadyExists
+		}
+		return fmt.Errorf("%s: failed to update alias: %w", op, err)
+	}
+
+	if res.MatchedCount == 0 {
+		return storage.ErrAliasNotFound
 	}
 
 	return nil
 }
 
-func (s *Store) GetURL(ctx context.Context, username, alias string) (string, error) {
-	const op = "mongodb.GetURL"
+func (s *Store) UpdateLink(ctx context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	const op = "mongodb.UpdateLink"
+
+	set := bson.D{}
+	if patch.Alias != nil {
+		set = append(set, bson.E{Key: "alias", Value: *patch.Alias})
+	}
+	if patch.Url != nil {
+		set = append(set, bson.E{Key: "url", Value: *patch.Url})
+	}
+	if patch.Disabled != nil {
+		set = append(set, bson.E{Key: "disabled", Value: *patch.Disabled})
+	}
+	if patch.DisabledBy != nil {
+		set = append(set, bson.E{Key: "disabled_by", Value: *patch.DisabledBy})
+	}
+	if patch.DisabledReason != nil {
+		set = append(set, bson.E{Key: "disabled_reason", Value: *patch.DisabledReason})
+	}
+	if patch.RedirectCode != nil {
+		set = append(set, bson.E{Key: "redirect_code", Value: *patch.RedirectCode})
+	}
+	if patch.CacheControl != nil {
+		set = append(set, bson.E{Key: "cache_control", Value: *patch.CacheControl})
+	}
+	if patch.QueryPassthrough != nil {
+		set = append(set, bson.E{Key: "query_passthrough", Value: *patch.QueryPassthrough})
+	}
+	if patch.PathPassthrough != nil {
+		set = append(set, bson.E{Key: "path_passthrough", Value: *patch.PathPassthrough})
+	}
+	if patch.UTM != nil {
+		set = append(set, bson.E{Key: "utm", Value: toUTMRecord(*patch.UTM)})
+	}
+	if patch.Routes != nil {
+		set = append(set, bson.E{Key: "routes", Value: nilIfEmpty(patch.Routes)})
+	}
+	if patch.Countries != nil {
+		set = append(set, bson.E{Key: "countries", Value: nilIfEmpty(patch.Countries)})
+	}
+	if patch.Variants != nil {
+		set = append(set, bson.E{Key: "variants", Value: toVariantRecords(patch.Variants)})
+	}
+	if patch.Tags != nil {
+		var tags []string
+		if len(patch.Tags) > 0 {
+			tags = patch.Tags
+		}
+		set = append(set, bson.E{Key: "tags", Value: tags})
+	}
+	if patch.Folder != nil {
+		set = append(set, bson.E{Key: "folder", Value: *patch.Folder})
+	}
 
-	var returningErr error = fmt.Errorf("%s: ", op)
+	if patch.Title != nil {
+		set = append(set, bson.E{Key: "title", Value: *patch.Title})
+	}
+	if patch.Description != nil {
+		set = append(set, bson.E{Key: "description", Value: *patch.Description})
+	}
+	if patch.Notes != nil {
+		set = append(set, bson.E{Key: "notes", Value: *patch.Notes})
+	}
 
-	if url, err := s.cache.Get(ctx, username, alias); err == nil {
-		return url, nil
-	} else {
-		returningErr = fmt.Errorf("%w: %w: %w", returningErr, storage.ErrCacheGet, err)
+	if len(set) == 0 {
+		return s.GetLink(ctx, username, alias)
 	}
+	set = append(set, bson.E{Key: "updated_at", Value: time.Now().UTC()})
 
 	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+	var update any = bson.D{{Key: "$set", Value: set}}
+	if patch.Url != nil || patch.Alias != nil {
+		// a pipeline sees the alias and url before the update, so they can be recorded along with it
+		var changed bson.A
+		if patch.Url != nil {
+			changed = append(changed, bson.D{{Key: "$ne", Value: bson.A{"$url", literal(*patch.Url)}}})
+		}
+		if patch.Alias != nil {
+			changed = append(changed, bson.D{{Key: "$ne", Value: bson.A{"$alias", literal(*patch.Alias)}}})
+		}
+		literals := make(bson.D, 0, len(set))
+		for _, e := range set {
+			literals = append(literals, bson.E{Key: e.Key, Value: literal(e.Value)})
+		}
+		update = mongo.Pipeline{
+			recordVersion(storage.ActorFromContext(ctx, username), bson.D{{Key: "$or", Value: changed}}),
+			{{Key: "$set", Value: literals}},
+		}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	var result Record
-	err := s.records.FindOne(ctx, filter).Decode(&result)
+	err := s.records.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
 	if errors.Is(err, mongo.ErrNoDocuments) {
-		return "", storage.ErrAliasNotFound
+		return storage.Link{}, storage.ErrAliasNotFound
+	} else if mongo.IsDuplicateKeyError(err) {
+		return storage.Link{}, storage.ErrNewAliasAlreadyExists
 	} else if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result.toLink(), nil
+}
+
+func (s *Store) ListURLs(ctx context.Context, username string, linkFilter storage.LinkFilter) ([]storage.Link, error) {
+	const op = "mongodb.ListURLs"
+
+	filter := bson.D{{Key: "username", Value: username}}
+	if len(linkFilter.Tags) > 0 {
+		filter = append(filter, bson.E{Key: "tags", Value: bson.D{{Key: "$all", Value: linkFilter.Tags}}})
+	}
+	if linkFilter.Folder != "" {
+		filter = append(filter, bson.E{Key: "folder", Value: linkFilter.Folder})
+	}
+
+	cursor, err := s.records.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if errors.Is(returningErr, storage.ErrCacheGet) {
-		return result.Url, returningErr
+	links := make([]storage.Link, 0, len(records))
+	for _, r := range records {
+		links = append(links, r.toLink())
 	}
 
-	return result.Url, nil
+	return links, nil
 }
 
-func (s *Store) DeleteURL(ctx context.Context, username, alias string) error {
-	const op = "mongodb.DeleteURL"
+func (s *Store) UseClick(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "mongodb.UseClick"
+
+	filter := bson.D{
+		{Key: "username", Value: username},
+		{Key: "alias", Value: alias},
+		{Key: "remaining_clicks", Value: bson.D{{Key: "$gt", Value: 0}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{
+		{Key: "remaining_clicks", Value: -1},
+		{Key: "clicks", Value: 1},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result Record
+	err := s.records.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err == nil {
+		return result.toLink(), nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.GetLink(ctx, username, alias); err != nil {
+		return storage.Link{}, err
+	}
+
+	return storage.Link{}, storage.ErrClicksExhausted
+}
+
+func (s *Store) CountClick(ctx context.Context, username, alias string) error {
+	const op = "mongodb.CountClick"
 
 	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "clicks", Value: 1}}}}
 
-	res, err := s.records.DeleteOne(ctx, filter)
+	res, err := s.records.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-
-	if res.DeletedCount == 0 {
+	if res.MatchedCount == 0 {
 		return storage.ErrAliasNotFound
 	}
 
-	if err := s.cache.Delete(ctx, username, alias); err != nil {
-		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheDelete, err)
+	return nil
+}
+
+// CountVariantClick increments clicks of the first variant with {url} through the positional operator
+func (s *Store) CountVariantClick(ctx context.Context, username, alias, url string) error {
+	const op = "mongodb.CountVariantClick"
+
+	filter := bson.D{
+		{Key: "username", Value: username},
+		{Key: "alias", Value: alias},
+		{Key: "variants.url", Value: url},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "variants.$.clicks", Value: 1}}}}
+
+	res, err := s.records.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrVariantNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SaveUser(ctx context.Context, username, passwordHash string) error {
+	const op = "mongodb.SaveUser"
+
+	filter := bson.D{{Key: "username", Value: username}}
+	update := bson.D{{Key: "$setOnInsert", Value: UserRecord{
+		Username:     username,
+		PasswordHash: passwordHash,
+	}}}
+
+	res, err := s.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return storage.ErrUserAlreadyExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.MatchedCount != 0 {
+		return storage.ErrUserAlreadyExists
 	}
 
 	return nil
 }
 
-func (s *Store) UpdateAlias(ctx context.Context, username, oldAlias, newAlias string) error {
-	const op = "mongodb.UpdateAlias"
+func (s *Store) GetUser(ctx context.Context, username string) (storage.User, error) {
+	const op = "mongodb.GetUser"
 
-	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: newAlias}}
+	filter := bson.D{{Key: "username", Value: username}}
 
-	var result Record
-	err := s.records.FindOne(ctx, filter).Decode(&result)
-	if !errors.Is(err, mongo.ErrNoDocuments) {
-		return storage.ErrNewAliasAlreadyExists
+	var result UserRecord
+	err := s.users.FindOne(ctx, filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.User{}, storage.ErrUserNotFound
+	} else if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	filter = bson.D{{Key: "username", Value: username}, {Key: "alias", Value: oldAlias}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "username", Value: username}, {Key: "alias", Value: newAlias}}}}
+	return storage.User{
+		Username:     result.Username,
+		PasswordHash: result.PasswordHash,
+		Disabled:     result.Disabled,
+		UTM:          result.UTM.toUTM(),
+		ForcePreview: result.ForcePreview,
+	}, nil
+}
 
-	res, err := s.records.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return fmt.Errorf("%s: failed to update alias", op)
+func (s *Store) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	const op = "mongodb.SetUserDisabled"
+
+	filter := bson.D{{Key: "username", Value: username}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "disabled", Value: disabled}}}}
+
+	if _, err := s.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if res.ModifiedCount == 0 {
-		return storage.ErrAliasNotFound
+	return nil
+}
+
+func (s *Store) SetUserUTM(ctx context.Context, username string, utm storage.UTM) error {
+	const op = "mongodb.SetUserUTM"
+
+	filter := bson.D{{Key: "username", Value: username}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "utm", Value: toUTMRecord(utm)}}}}
+
+	if _, err := s.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.cache.Update(ctx, username, oldAlias, newAlias); err != nil {
-		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheUpdate, err)
+	return nil
+}
+
+func (s *Store) SetUserForcePreview(ctx context.Context, username string, force bool) error {
+	const op = "mongodb.SetUserForcePreview"
+
+	filter := bson.D{{Key: "username", Value: username}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "force_preview", Value: force}}}}
+
+	if _, err := s.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
+
+func (s *Store) ListAllURLs(ctx context.Context) ([]storage.Link, error) {
+	const op = "mongodb.ListAllURLs"
+
+	cursor, err := s.records.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	links := make([]storage.Link, 0, len(records))
+	for _, r := range records {
+		links = append(links, r.toLink())
+	}
+
+	return links, nil
+}
+
+// ReassignURLs moves links one by one, since a standalone server has no transactions,
+// so a conflict found midway leaves the links moved by then with {to} and counts them
+func (s *Store) ReassignURLs(ctx context.Context, from, to string) (int64, error) {
+	const op = "mongodb.ReassignURLs"
+
+	aliases, err := s.records.Distinct(ctx, "alias", bson.D{{Key: "username", Value: from}})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(aliases) == 0 {
+		users, err := s.users.CountDocuments(ctx, bson.D{{Key: "username", Value: from}})
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if users == 0 {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return 0, nil
+	}
+
+	filter := bson.D{
+		{Key: "username", Value: to},
+		{Key: "alias", Value: bson.D{{Key: "$in", Value: aliases}}},
+	}
+
+	cnt, err := s.records.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cnt != 0 {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "username", Value: to}}}}
+
+	var moved int64
+	for _, alias := range aliases {
+		filter := bson.D{{Key: "username", Value: from}, {Key: "alias", Value: alias}}
+
+		res, err := s.records.UpdateOne(ctx, filter, update)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return moved, fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+			}
+			return moved, fmt.Errorf("%s: %w", op, err)
+		}
+		moved += res.ModifiedCount
+	}
+
+	return moved, nil
+}
+
+func (s *Store) PurgeURLs(ctx context.Context, username string) (int64, error) {
+	const op = "mongodb.PurgeURLs"
+
+	res, err := s.records.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (s *Store) Stats(ctx context.Context) (storage.Stats, error) {
+	const op = "mongodb.Stats"
+
+	stats := storage.Stats{LinksPerUser: make(map[string]int64)}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$username"},
+			{Key: "links", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := s.records.Aggregate(ctx, pipeline)
+	if err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var groups []struct {
+		Username string `bson:"_id"`
+		Links    int64  `bson:"links"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, g := range groups {
+		stats.LinksPerUser[g.Username] = g.Links
+		stats.Links += g.Links
+	}
+
+	if stats.Users, err = s.users.CountDocuments(ctx, bson.D{}); err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if stats.DisabledUsers, err = s.users.CountDocuments(ctx, bson.D{{Key: "disabled", Value: true}}); err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+func toRecord(link storage.Link) Record {
+	return Record{
+		Username:         link.Username,
+		Alias:            link.Alias,
+		Url:              link.Url,
+		PasswordHash:     link.PasswordHash,
+		MaxClicks:        link.MaxClicks,
+		RemainingClicks:  link.RemainingClicks,
+		NotBefore:        link.NotBefore,
+		NotAfter:         link.NotAfter,
+		RedirectCode:     link.RedirectCode,
+		CacheControl:     link.CacheControl,
+		QueryPassthrough: link.QueryPassthrough,
+		PathPassthrough:  link.PathPassthrough,
+		UTM:              toUTMRecord(link.UTM),
+		Routes:           link.Routes,
+		Countries:        link.Countries,
+		Variants:         toVariantRecords(link.Variants),
+		CreatedAt:        link.CreatedAt,
+		UpdatedAt:        link.UpdatedAt,
+		Title:            link.Title,
+		Description:      link.Description,
+		Notes:            link.Notes,
+		Clicks:           link.Clicks,
+		Disabled:         link.Disabled,
+		DisabledBy:       link.DisabledBy,
+		DisabledReason:   link.DisabledReason,
+		Tags:             link.Tags,
+		Folder:           link.Folder,
+	}
+}
+
+func (r Record) toLink() storage.Link {
+	return storage.Link{
+		Username:         r.Username,
+		Alias:            r.Alias,
+		Url:              r.Url,
+		PasswordHash:     r.PasswordHash,
+		MaxClicks:        r.MaxClicks,
+		RemainingClicks:  r.RemainingClicks,
+		NotBefore:        r.NotBefore,
+		NotAfter:         r.NotAfter,
+		RedirectCode:     r.RedirectCode,
+		CacheControl:     r.CacheControl,
+		QueryPassthrough: r.QueryPassthrough,
+		PathPassthrough:  r.PathPassthrough,
+		UTM:              r.UTM.toUTM(),
+		Routes:           r.Routes,
+		Countries:        r.Countries,
+		Variants:         toVariants(r.Variants),
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
+		Title:            r.Title,
+		Description:      r.Description,
+		Notes:            r.Notes,
+		Clicks:           r.Clicks,
+		Disabled:         r.Disabled,
+		DisabledBy:       r.DisabledBy,
+		DisabledReason:   r.DisabledReason,
+		Tags:             r.Tags,
+		Folder:           r.Folder,
+	}
+}
+
+// nilIfEmpty keeps removed routes and country rules out of documents
+func nilIfEmpty(targets map[string]string) map[string]string {
+	if len(targets) == 0 {
+		return nil
+	}
+	return targets
+}
+
+// toVariantRecords returns nil for no {variants}, so links without variants do not store them
+func toVariantRecords(variants []storage.Variant) []VariantRecord {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	records := make([]VariantRecord, 0, len(variants))
+	for _, v := range variants {
+		records = append(records, VariantRecord{Url: v.Url, Weight: v.Weight, Clicks: v.Clicks})
+	}
+
+	return records
+}
+
+func toVariants(records []VariantRecord) []storage.Variant {
+	if len(records) == 0 {
+		return nil
+	}
+
+	variants := make([]storage.Variant, 0, len(records))
+	for _, r := range records {
+		variants = append(variants, storage.Variant{Url: r.Url, Weight: r.Weight, Clicks: r.Clicks})
+	}
+
+	return variants
+}
+
+// toUTMRecord returns nil for empty {utm}, so links and users without UTM parameters do not store them
+func toUTMRecord(utm storage.UTM) *UTMRecord {
+	if utm.IsZero() {
+		return nil
+	}
+
+	return &UTMRecord{
+		Source:   utm.Source,
+		Medium:   utm.Medium,
+		Campaign: utm.Campaign,
+		Term:     utm.Term,
+		Content:  utm.Content,
+	}
+}
+
+func (r *UTMRecord) toUTM() storage.UTM {
+	if r == nil {
+		return storage.UTM{}
+	}
+
+	return storage.UTM{
+		Source:   r.Source,
+		Medium:   r.Medium,
+		Campaign: r.Campaign,
+		Term:     r.Term,
+		Content:  r.Content,
+	}
+}
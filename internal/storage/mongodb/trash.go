@@ -0,0 +1,139 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Trash struct {
+	*mongo.Collection
+}
+
+// TrashRecord is a deleted link, the link record is kept as it was in the links collection
+type TrashRecord struct {
+	Username  string    `bson:"username"`
+	Alias     string    `bson:"alias"`
+	Link      Record    `bson:"link"`
+	DeletedAt time.Time `bson:"deleted_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// TrashURL moves the link without a transaction, which needs a replica set.
+// The link is put back if it cannot be written to the trash
+func (s *Store) TrashURL(ctx context.Context, username, alias string, deletedAt, expiresAt time.Time) error {
+	const op = "mongodb.TrashURL"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+
+	var record Record
+	err := s.records.FindOneAndDelete(ctx, filter).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.ErrAliasNotFound
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	update := bson.D{{Key: "$set", Value: TrashRecord{
+		Username:  username,
+		Alias:     alias,
+		Link:      record,
+		DeletedAt: deletedAt.UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	}}}
+
+	if _, err := s.trash.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		if _, restoreErr := s.records.InsertOne(ctx, record); restoreErr != nil {
+			return fmt.Errorf("%s: link lost: %w", op, errors.Join(err, restoreErr))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) ListTrash(ctx context.Context, username string) ([]storage.TrashedLink, error) {
+	const op = "mongodb.ListTrash"
+
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	cursor, err := s.trash.Find(ctx, bson.D{{Key: "username", Value: username}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var records []TrashRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	links := make([]storage.TrashedLink, 0, len(records))
+	for _, r := range records {
+		links = append(links, storage.TrashedLink{Link: r.Link.toLink(), DeletedAt: r.DeletedAt, ExpiresAt: r.ExpiresAt})
+	}
+
+	return links, nil
+}
+
+func (s *Store) RestoreURL(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "mongodb.RestoreURL"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+
+	var record TrashRecord
+	err := s.trash.FindOne(ctx, filter).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.Link{}, storage.ErrAliasNotFound
+	} else if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.records.InsertOne(ctx, record.Link); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.trash.DeleteOne(ctx, filter); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return record.Link.toLink(), nil
+}
+
+func (s *Store) PurgeTrashed(ctx context.Context, username, alias string) error {
+	const op = "mongodb.PurgeTrashed"
+
+	filter := bson.D{{Key: "username", Value: username}, {Key: "alias", Value: alias}}
+
+	res, err := s.trash.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.DeletedCount == 0 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) EmptyTrash(ctx context.Context, before time.Time) (int64, error) {
+	const op = "mongodb.EmptyTrash"
+
+	filter := bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: before.UTC()}}}}
+
+	res, err := s.trash.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.DeletedCount, nil
+}
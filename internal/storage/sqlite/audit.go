@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"url-shortener/internal/storage"
+)
+
+func (s *Store) SaveAuditEvent(ctx context.Context, event storage.AuditEvent) error {
+	const op = "sqlite.SaveAuditEvent"
+
+	before, err := encodeSnapshot(event.Before)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	after, err := encodeSnapshot(event.After)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO audit (time, actor, action, username, alias, before, after, ip, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.ExecContext(
+		ctx, query,
+		event.Time.UTC(), event.Actor, event.Action, event.Username, event.Alias, before, after, event.IP, event.RequestID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	const op = "sqlite.ListAuditEvents"
+
+	var (
+		conditions []string
+		args       []any
+	)
+	match := func(column, value string) {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	match("actor", filter.Actor)
+	match("action", filter.Action)
+	match("username", filter.Username)
+	match("alias", filter.Alias)
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.Cursor != "" {
+		id, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		conditions = append(conditions, "id < ?")
+		args = append(args, id)
+	}
+
+	query := `SELECT id, time, actor, action, username, alias, before, after, ip, request_id FROM audit`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	events := make([]storage.AuditEvent, 0)
+	for rows.Next() {
+		var (
+			event         storage.AuditEvent
+			id            int64
+			before, after string
+		)
+		err := rows.Scan(
+			&id, &event.Time, &event.Actor, &event.Action, &event.Username, &event.Alias,
+			&before, &after, &event.IP, &event.RequestID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		event.ID = strconv.FormatInt(id, 10)
+		if event.Before, err = decodeSnapshot(before); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if event.After, err = decodeSnapshot(after); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// encodeSnapshot keeps a link of an audit event as JSON, an absent link is kept as an empty string
+func encodeSnapshot(link *storage.Link) (string, error) {
+	if link == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func decodeSnapshot(data string) (*storage.Link, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var link storage.Link
+	if err := json.Unmarshal([]byte(data), &link); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
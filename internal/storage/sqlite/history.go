@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/storage"
+)
+
+func (s *Store) LinkHistory(ctx context.Context, username, alias string) ([]storage.LinkVersion, error) {
+	const op = "sqlite.LinkHistory"
+
+	id, _, err := linkID(ctx, s.db, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions, err := history(ctx, s.db, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return versions, nil
+}
+
+// linkID returns id and url of the link saved by {alias}, history entries refer to the id so they survive renames
+func linkID(ctx context.Context, q querier, username, alias string) (int64, string, error) {
+	query := `
+		SELECT l.id, l.url
+		FROM users AS u
+		JOIN urls AS l ON u.id = l.user_id
+		WHERE u.username = ? AND l.alias = ?
+	`
+
+	var (
+		id  int64
+		url string
+	)
+	if err := q.QueryRowContext(ctx, query, username, alias).Scan(&id, &url); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", storage.ErrAliasNotFound
+		}
+		return 0, "", err
+	}
+
+	return id, url, nil
+}
+
+func history(ctx context.Context, q querier, urlID int64) ([]storage.LinkVersion, error) {
+	query := `SELECT alias, url, changed_by, changed_at FROM link_history WHERE url_id = ? ORDER BY id`
+
+	rows, err := q.QueryContext(ctx, query, urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	versions := make([]storage.LinkVersion, 0)
+	for rows.Next() {
+		v := storage.LinkVersion{Version: len(versions) + 1}
+		if err := rows.Scan(&v.Alias, &v.Url, &v.ChangedBy, &v.ChangedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// recordVersion appends what the link was before a change to its history
+func recordVersion(ctx context.Context, q querier, urlID int64, v storage.LinkVersion) error {
+	query := `INSERT INTO link_history (url_id, alias, url, changed_by, changed_at) VALUES (?, ?, ?, ?, ?)`
+
+	if _, err := q.ExecContext(ctx, query, urlID, v.Alias, v.Url, v.ChangedBy, v.ChangedAt.UTC()); err != nil {
+		return fmt.Errorf("failed to record link version: %w", err)
+	}
+
+	return nil
+}
+
+// encodeHistory keeps the history of a trashed link as a JSON array, no history is stored as an empty string
+func encodeHistory(versions []storage.LinkVersion) (string, error) {
+	if len(versions) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func decodeHistory(data string) ([]storage.LinkVersion, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var versions []storage.LinkVersion
+	if err := json.Unmarshal([]byte(data), &versions); err != nil {
+		return nil, fmt.Errorf("failed to decode history: %w", err)
+	}
+
+	return versions, nil
+}
+
+// newVersion is the version a link had before {changedBy} changed it now
+func newVersion(alias, url, changedBy string) storage.LinkVersion {
+	return storage.LinkVersion{Alias: alias, Url: url, ChangedBy: changedBy, ChangedAt: time.Now()}
+}
@@ -0,0 +1,267 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+var (
+	ErrSchemaTooNew     = errors.New("database schema is newer than the binary supports")
+	ErrUnknownVersion   = errors.New("unknown schema version")
+	ErrInvalidMigration = errors.New("invalid migration")
+)
+
+// Migration is a versioned schema change, read from migrations/{version}_{name}.{up|down}.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration with the time it was applied, zero if it is pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrator applies embedded migrations and records them in the "schema_migrations" table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the newest schema version known to the binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the schema version of the database, 0 if no migrations were applied
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	const op = "sqlite.Migrator.Version"
+
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var version int
+	if err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// Check fails with ErrSchemaTooNew if the database was migrated by a newer binary
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version > m.Latest() {
+		return fmt.Errorf("%w: database version %d, latest known version %d", ErrSchemaTooNew, version, m.Latest())
+	}
+
+	return nil
+}
+
+// Status returns all known migrations with the time they were applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "sqlite.Migrator.Status"
+
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, MigrationStatus{Migration: migration, AppliedAt: applied[migration.Version]})
+	}
+
+	return statuses, nil
+}
+
+// MigrateTo applies up or down migrations until the database has schema {version}
+func (m *Migrator) MigrateTo(ctx context.Context, version int) error {
+	const op = "sqlite.Migrator.MigrateTo"
+
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("%s: %w: %d", op, ErrUnknownVersion, version)
+	}
+
+	if err := m.Check(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	current, err := m.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > current && migration.Version <= version {
+			if err := m.apply(ctx, migration, true); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= current && migration.Version > version {
+			if err := m.apply(ctx, migration, false); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	script := migration.Up
+	if !up {
+		script = migration.Down
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, migration.Version, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+			"version" INTEGER PRIMARY KEY,
+			"applied_at" TIMESTAMP NOT NULL
+		);`
+
+	_, err := m.db.ExecContext(ctx, query)
+	return err
+}
+
+// loadMigrations reads migrations from {fsys} and checks that versions are contiguous
+// and every migration has both up and down scripts
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+
+		rest, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, file)
+		}
+
+		prefix, name, ok := strings.Cut(rest, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, file)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != name {
+			return nil, fmt.Errorf("%w: %s: version %d is used by %s", ErrInvalidMigration, file, version, migration.Name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%w: %04d_%s must have up and down scripts", ErrInvalidMigration, migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("%w: version %d is missing", ErrInvalidMigration, i+1)
+		}
+	}
+
+	return migrations, nil
+}
@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = 5 * time.Second
+
+func TestMigrator_FreshDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := MustOpen(filepath.Join(t.TempDir(), "data.db"))
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	require.NoError(t, m.MigrateTo(ctx, m.Latest()))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.False(t, s.AppliedAt.IsZero(), "migration %d is not applied", s.Version)
+	}
+
+	require.NoError(t, m.MigrateTo(ctx, 0))
+
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	var tables int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations'`).Scan(&tables))
+	assert.Equal(t, 0, tables)
+}
+
+func TestMigrator_ExistingDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+	db := MustOpen(path)
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE "users" ("id" INTEGER PRIMARY KEY, "username" TEXT NOT NULL UNIQUE);
+		CREATE TABLE "urls" (
+			"id" INTEGER PRIMARY KEY,
+			"user_id" INT NOT NULL,
+			"alias" TEXT NOT NULL,
+			"url" TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			UNIQUE (user_id, alias)
+		);
+		INSERT INTO users (id, username) VALUES (1, 'pasha');
+		INSERT INTO urls (user_id, alias, url) VALUES (1, 'lms', 'https://stepik.org/learn');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s := MustNew(timeout, path)
+
+	link, err := s.GetLink(ctx, "pasha", "lms")
+	require.NoError(t, err)
+	assert.Equal(t, "https://stepik.org/learn", link.Url)
+	assert.Empty(t, link.PasswordHash)
+	require.NotNil(t, link.CreatedAt, "created_at is backfilled")
+	assert.WithinDuration(t, time.Now(), *link.CreatedAt, time.Minute)
+	assert.Equal(t, link.CreatedAt, link.UpdatedAt)
+
+	var raw string
+	require.NoError(t, s.db.QueryRowContext(ctx, `SELECT CAST("created_at" AS TEXT) FROM "urls"`).Scan(&raw))
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d+\+00:00$`, raw, "created_at is backfilled in the format Go writes")
+}
+
+func TestMigrator_NewerSchema(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+	db := MustOpen(path)
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, m.MigrateTo(ctx, m.Latest()))
+
+	_, err = db.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, CURRENT_TIMESTAMP)`, m.Latest()+1)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, m.Check(ctx), ErrSchemaTooNew)
+	assert.ErrorIs(t, m.MigrateTo(ctx, m.Latest()), ErrSchemaTooNew)
+	assert.Panics(t, func() { MustNew(timeout, path) })
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			fsys: fstest.MapFS{
+				"migrations/0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id INTEGER);")},
+				"migrations/0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+				"migrations/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+				"migrations/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+			},
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"migrations/0001_init.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing version",
+			fsys: fstest.MapFS{
+				"migrations/0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+				"migrations/0001_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+				"migrations/0003_third.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+				"migrations/0003_third.down.sql": {Data: []byte("DROP TABLE c;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad name",
+			fsys: fstest.MapFS{
+				"migrations/init.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.fsys)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMigration)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	migrations, err := loadMigrations(migrationsFS)
+	require.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+}
@@ -0,0 +1,19 @@
+-- Tables existed before versioned migrations were introduced,
+-- so IF NOT EXISTS lets this migration baseline existing databases
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" INTEGER PRIMARY KEY,
+    "username" TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS "urls" (
+    "id" INTEGER PRIMARY KEY,
+    "user_id" INT NOT NULL,
+    "alias" TEXT NOT NULL,
+    "url" TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, alias)
+);
+
+-- Users own links and are created along with their first link, registered ones also have a password
+ALTER TABLE "users" ADD COLUMN "password_hash" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "disabled" INTEGER NOT NULL DEFAULT 0;
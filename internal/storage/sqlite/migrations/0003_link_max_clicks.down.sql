@@ -0,0 +1,2 @@
+ALTER TABLE "urls" DROP COLUMN "remaining_clicks";
+ALTER TABLE "urls" DROP COLUMN "max_clicks";
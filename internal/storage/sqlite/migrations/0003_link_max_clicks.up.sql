@@ -0,0 +1,2 @@
+ALTER TABLE "urls" ADD COLUMN "max_clicks" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "urls" ADD COLUMN "remaining_clicks" INTEGER NOT NULL DEFAULT 0;
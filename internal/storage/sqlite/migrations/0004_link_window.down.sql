@@ -0,0 +1,2 @@
+ALTER TABLE "urls" DROP COLUMN "not_after";
+ALTER TABLE "urls" DROP COLUMN "not_before";
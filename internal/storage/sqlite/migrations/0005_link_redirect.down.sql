@@ -0,0 +1,2 @@
+ALTER TABLE "urls" DROP COLUMN "cache_control";
+ALTER TABLE "urls" DROP COLUMN "redirect_code";
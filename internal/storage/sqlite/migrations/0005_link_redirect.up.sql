@@ -0,0 +1,2 @@
+ALTER TABLE "urls" ADD COLUMN "redirect_code" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "urls" ADD COLUMN "cache_control" TEXT NOT NULL DEFAULT '';
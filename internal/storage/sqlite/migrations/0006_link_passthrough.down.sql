@@ -0,0 +1,2 @@
+ALTER TABLE "urls" DROP COLUMN "path_passthrough";
+ALTER TABLE "urls" DROP COLUMN "query_passthrough";
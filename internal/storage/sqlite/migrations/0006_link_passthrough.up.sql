@@ -0,0 +1,2 @@
+ALTER TABLE "urls" ADD COLUMN "query_passthrough" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "urls" ADD COLUMN "path_passthrough" INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+ALTER TABLE "users" DROP COLUMN "utm_content";
+ALTER TABLE "users" DROP COLUMN "utm_term";
+ALTER TABLE "users" DROP COLUMN "utm_campaign";
+ALTER TABLE "users" DROP COLUMN "utm_medium";
+ALTER TABLE "users" DROP COLUMN "utm_source";
+
+ALTER TABLE "urls" DROP COLUMN "utm_content";
+ALTER TABLE "urls" DROP COLUMN "utm_term";
+ALTER TABLE "urls" DROP COLUMN "utm_campaign";
+ALTER TABLE "urls" DROP COLUMN "utm_medium";
+ALTER TABLE "urls" DROP COLUMN "utm_source";
@@ -0,0 +1 @@
+ALTER TABLE "urls" ADD COLUMN "routes" TEXT NOT NULL DEFAULT '';
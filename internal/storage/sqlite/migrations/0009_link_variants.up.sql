@@ -0,0 +1 @@
+ALTER TABLE "urls" ADD COLUMN "variants" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE "urls" ADD COLUMN "countries" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE "users" DROP COLUMN "force_preview";
+
+ALTER TABLE "urls" DROP COLUMN "clicks";
+ALTER TABLE "urls" DROP COLUMN "created_at";
@@ -0,0 +1,4 @@
+ALTER TABLE "urls" ADD COLUMN "created_at" TIMESTAMP;
+ALTER TABLE "urls" ADD COLUMN "clicks" INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE "users" ADD COLUMN "force_preview" INTEGER NOT NULL DEFAULT 0;
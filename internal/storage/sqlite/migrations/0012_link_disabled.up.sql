@@ -0,0 +1 @@
+ALTER TABLE "urls" ADD COLUMN "disabled" INTEGER NOT NULL DEFAULT 0;
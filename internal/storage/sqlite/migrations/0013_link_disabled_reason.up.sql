@@ -0,0 +1,2 @@
+ALTER TABLE "urls" ADD COLUMN "disabled_by" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "urls" ADD COLUMN "disabled_reason" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Deleted links are kept as JSON until they expire, their aliases are free for new links meanwhile
+CREATE TABLE IF NOT EXISTS "trash" (
+    "user_id" INT NOT NULL,
+    "alias" TEXT NOT NULL,
+    "link" TEXT NOT NULL,
+    "deleted_at" TIMESTAMP NOT NULL,
+    "expires_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, alias)
+);
+
+CREATE INDEX IF NOT EXISTS "trash_expires_at" ON "trash" ("expires_at");
@@ -0,0 +1,2 @@
+ALTER TABLE "trash" DROP COLUMN "history";
+DROP TABLE "link_history";
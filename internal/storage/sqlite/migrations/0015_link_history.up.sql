@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS "link_history" (
+    "id" INTEGER PRIMARY KEY,
+    "url_id" INT NOT NULL,
+    "alias" TEXT NOT NULL,
+    "url" TEXT NOT NULL,
+    "changed_by" TEXT NOT NULL,
+    "changed_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY (url_id) REFERENCES urls(id)
+);
+
+CREATE INDEX IF NOT EXISTS "link_history_url_id" ON "link_history" ("url_id");
+
+-- trashed links keep their history as JSON to get it back on restore
+ALTER TABLE "trash" ADD COLUMN "history" TEXT NOT NULL DEFAULT '';
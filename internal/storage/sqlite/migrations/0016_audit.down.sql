@@ -0,0 +1,3 @@
+DROP TRIGGER "audit_no_delete";
+DROP TRIGGER "audit_no_update";
+DROP TABLE "audit";
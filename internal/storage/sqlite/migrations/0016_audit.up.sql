@@ -0,0 +1,27 @@
+-- Audit events are append-only, the triggers reject any change of recorded events
+CREATE TABLE IF NOT EXISTS "audit" (
+    "id" INTEGER PRIMARY KEY,
+    "time" TIMESTAMP NOT NULL,
+    "actor" TEXT NOT NULL,
+    "action" TEXT NOT NULL,
+    "username" TEXT NOT NULL,
+    "alias" TEXT NOT NULL,
+    "before" TEXT NOT NULL DEFAULT '',
+    "after" TEXT NOT NULL DEFAULT '',
+    "ip" TEXT NOT NULL DEFAULT '',
+    "request_id" TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS "audit_username_alias" ON "audit" ("username", "alias");
+CREATE INDEX IF NOT EXISTS "audit_actor" ON "audit" ("actor");
+CREATE INDEX IF NOT EXISTS "audit_time" ON "audit" ("time");
+
+CREATE TRIGGER IF NOT EXISTS "audit_no_update" BEFORE UPDATE ON "audit"
+BEGIN
+    SELECT RAISE(ABORT, 'audit events cannot be changed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS "audit_no_delete" BEFORE DELETE ON "audit"
+BEGIN
+    SELECT RAISE(ABORT, 'audit events cannot be deleted');
+END;
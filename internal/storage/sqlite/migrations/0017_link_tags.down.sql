@@ -0,0 +1,3 @@
+DROP TABLE "link_tags";
+DROP INDEX "urls_user_id_folder";
+ALTER TABLE "urls" DROP COLUMN "folder";
@@ -0,0 +1,13 @@
+-- A link has any number of tags and at most one folder, both are indexed to filter links of a user by them
+ALTER TABLE "urls" ADD COLUMN "folder" TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS "urls_user_id_folder" ON "urls" ("user_id", "folder");
+
+CREATE TABLE IF NOT EXISTS "link_tags" (
+    "url_id" INT NOT NULL,
+    "tag" TEXT NOT NULL,
+    FOREIGN KEY (url_id) REFERENCES urls(id),
+    PRIMARY KEY (url_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS "link_tags_tag" ON "link_tags" ("tag", "url_id");
@@ -0,0 +1,4 @@
+ALTER TABLE "urls" DROP COLUMN "notes";
+ALTER TABLE "urls" DROP COLUMN "description";
+ALTER TABLE "urls" DROP COLUMN "title";
+ALTER TABLE "urls" DROP COLUMN "updated_at";
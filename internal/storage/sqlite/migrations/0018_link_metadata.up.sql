@@ -0,0 +1,22 @@
+-- Title and description are shown to visitors, notes to the owner only
+ALTER TABLE "urls" ADD COLUMN "updated_at" TIMESTAMP;
+ALTER TABLE "urls" ADD COLUMN "title" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "urls" ADD COLUMN "description" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "urls" ADD COLUMN "notes" TEXT NOT NULL DEFAULT '';
+
+-- Backfilled values are approximate: the creation time of older links was never stored,
+-- so created_at is their first recorded change, which is at or after creation,
+-- or the time of this migration for links never changed.
+-- Every value uses the format Go writes, "YYYY-MM-DD HH:MM:SS.SSS+00:00" in UTC, as link_history does
+UPDATE "urls"
+SET "created_at" = COALESCE(
+    (SELECT MIN("changed_at") FROM "link_history" WHERE "url_id" = "urls"."id"),
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+)
+WHERE "created_at" IS NULL;
+
+UPDATE "urls"
+SET "updated_at" = COALESCE(
+    (SELECT MAX("changed_at") FROM "link_history" WHERE "url_id" = "urls"."id"),
+    "created_at"
+);
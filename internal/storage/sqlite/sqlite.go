@@ -3,21 +3,23 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
-	"url-shortener/internal/cache"
 	"url-shortener/internal/storage"
 
 	"github.com/mattn/go-sqlite3"
 )
 
 type Store struct {
-	db    *sql.DB
-	cache cache.Cache
+	db *sql.DB
 }
 
-func MustNew(timeout time.Duration, c cache.Cache, storagePath string) *Store {
+// MustNew opens the database and applies pending migrations.
+// It panics if the database schema is newer than the binary knows
+func MustNew(timeout time.Duration, storagePath string) *Store {
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 
@@ -25,73 +27,47 @@ func MustNew(timeout time.Duration, c cache.Cache, storagePath string) *Store {
 
 	mainFunc := func() *Store {
 
-		db, err := sql.Open("sqlite3", storagePath)
+		db := MustOpen(storagePath)
+
+		m, err := NewMigrator(db)
 		if err != nil {
 			panic(err)
 		}
 
-		if err := db.Ping(); err != nil {
+		if err := m.Check(ctx); err != nil {
 			panic(err)
 		}
 
-		query1 := `
-			CREATE TABLE IF NOT EXISTS "users" (
-				"id" INTEGER PRIMARY KEY,
-				"username" TEXT NOT NULL UNIQUE
-			);
-		`
-
-		query2 := `CREATE TABLE IF NOT EXISTS "urls" (
-				"id" INTEGER PRIMARY KEY,
-				"user_id" INT NOT NULL,
-				"alias" TEXT NOT NULL,
-				"url" TEXT NOT NULL,
-				FOREIGN KEY (user_id) REFERENCES users(id),
-				UNIQUE (user_id, alias)
-			);`
-
-		stmt, err := db.PrepareContext(ctx, query1)
-		if err != nil {
+		if err := m.MigrateTo(ctx, m.Latest()); err != nil {
 			panic(err)
 		}
 
-		if _, err := stmt.Exec(); err != nil {
-			panic(err)
-		}
+		return &Store{db: db}
+	}
 
-		stmt, err = db.PrepareContext(ctx, query2)
-		if err != nil {
-			panic(err)
-		}
+	return mainFunc()
+}
 
-		if _, err := stmt.Exec(); err != nil {
-			panic(err)
-		}
+// MustOpen opens the database without touching its schema
+func MustOpen(storagePath string) *sql.DB {
+	db, err := sql.Open("sqlite3", storagePath)
+	if err != nil {
+		panic(err)
+	}
 
-		return &Store{db: db, cache: c}
+	if err := db.Ping(); err != nil {
+		panic(err)
 	}
 
-	return mainFunc()
+	return db
 }
 
 func (s *Store) Close(ctx context.Context) error {
 
-	res := make(chan error)
-	defer close(res)
+	res := make(chan error, 1)
 
 	go func() {
-		err1 := s.cache.Close(ctx)
-		err2 := s.db.Close()
-
-		if err1 != nil && err2 != nil {
-			res <- fmt.Errorf("%w && %w", err1, err2)
-		} else if err1 != nil {
-			res <- err1
-		} else if err2 != nil {
-			res <- err2
-		}
-
-		res <- nil
+		res <- s.db.Close()
 	}()
 
 	select {
@@ -102,115 +78,893 @@ func (s *Store) Close(ctx context.Context) error {
 	}
 }
 
-func (s *Store) SaveURL(ctx context.Context, url, alias, username string) error {
-	const op = "sqlite.SaveURL"
+func (s *Store) SaveLink(ctx context.Context, link storage.Link) error {
+	const op = "sqlite.SaveLink"
 
-	var userId int64
-	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&userId)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := insertLink(ctx, tx, link); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// insertLink inserts {link} with its tags for its user, inserting the user if it does not exist, and returns id of the link
+func insertLink(ctx context.Context, q querier, link storage.Link) (int64, error) {
+	userId, err := userID(ctx, q, link.Username)
+	if err != nil {
+		return 0, err
+	}
+
+	routes, err := encodeTargets(link.Routes)
+	if err != nil {
+		return 0, err
+	}
+
+	countries, err := encodeTargets(link.Countries)
+	if err != nil {
+		return 0, err
+	}
+
+	variants, err := encodeVariants(link.Variants)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO urls (
+			user_id, alias, url, password_hash, max_clicks, remaining_clicks,
+			not_before, not_after, redirect_code, cache_control, query_passthrough, path_passthrough,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content, routes, variants, countries,
+			created_at, clicks, disabled, disabled_by, disabled_reason, folder,
+			updated_at, title, description, notes
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	res, err := q.ExecContext(
+		ctx, query,
+		userId, link.Alias, link.Url, link.PasswordHash, link.MaxClicks, link.RemainingClicks,
+		utc(link.NotBefore), utc(link.NotAfter), link.RedirectCode, link.CacheControl,
+		link.QueryPassthrough, link.PathPassthrough,
+		link.UTM.Source, link.UTM.Medium, link.UTM.Campaign, link.UTM.Term, link.UTM.Content,
+		routes, variants, countries, utc(link.CreatedAt), link.Clicks,
+		link.Disabled, link.DisabledBy, link.DisabledReason, link.Folder,
+		utc(link.UpdatedAt), link.Title, link.Description, link.Notes,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save (user_id, alias, url): %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setTags(ctx, q, id, link.Tags); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *Store) GetLink(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "sqlite.GetLink"
+
+	link, err := getLink(ctx, s.db, username, alias)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			return storage.Link{}, storage.ErrAliasNotFound
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
 
-			res, err := s.db.ExecContext(ctx, "INSERT INTO users (username) VALUES (?)", username)
-			if err != nil {
-				return fmt.Errorf("%s: failed to insert new user: %w", op, err)
-			}
+	return link, nil
+}
 
-			userId, err = res.LastInsertId()
-			if err != nil {
-				return fmt.Errorf("%s: failed to get last inserted id: %w", op, err)
-			}
-		} else {
-			return fmt.Errorf("%s: failed to select user_id: %w", op, err)
+func getLink(ctx context.Context, q querier, username, alias string) (storage.Link, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM users AS u
+		JOIN urls AS l ON u.id = l.user_id
+		WHERE u.username = ? AND l.alias = ?
+	`
+
+	return scanLink(q.QueryRowContext(ctx, query, username, alias))
+}
+
+func (s *Store) DeleteURL(ctx context.Context, username, alias string) error {
+	const op = "sqlite.DeleteURL"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	id, _, err := linkID(ctx, tx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return err
 		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM link_history WHERE url_id = ?`, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setTags(ctx, tx, id, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	query := `INSERT INTO urls (user_id, alias, url) VALUES (?, ?, ?);`
+	if _, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateAlias(ctx context.Context, username, alias, newAlias string) error {
+	const op = "sqlite.UpdateAlias"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
 
-	_, err = s.db.ExecContext(ctx, query, userId, alias, url)
+	id, url, err := linkID(ctx, tx, username, alias)
 	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `UPDATE urls SET alias = ?, updated_at = ? WHERE id = ?`
+
+	if _, err := tx.ExecContext(ctx, query, newAlias, time.Now().UTC(), id); err != nil {
 		var sqliteErr sqlite3.Error
 		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
-			return fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+			return storage.ErrNewAliasAlreadyExists
 		}
-		return fmt.Errorf("%s: failed to save (user_id, alias, url): %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := recordVersion(ctx, tx, id, newVersion(alias, url, storage.ActorFromContext(ctx, username))); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.cache.Set(ctx, url, alias, username); err != nil {
-		return fmt.Errorf("%s: %w: %w", op, storage.ErrCacheSet, err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Store) GetURL(ctx context.Context, username, alias string) (string, error) {
-	const op = "sqlite.GetURL"
+func (s *Store) UpdateLink(ctx context.Context, username, alias string, patch storage.LinkPatch) (storage.Link, error) {
+	const op = "sqlite.UpdateLink"
+
+	var (
+		set  []string
+		args []any
+	)
+	if patch.Alias != nil {
+		set = append(set, "alias = ?")
+		args = append(args, *patch.Alias)
+	}
+	if patch.Url != nil {
+		set = append(set, "url = ?")
+		args = append(args, *patch.Url)
+	}
+	if patch.Disabled != nil {
+		set = append(set, "disabled = ?")
+		args = append(args, *patch.Disabled)
+	}
+	if patch.DisabledBy != nil {
+		set = append(set, "disabled_by = ?")
+		args = append(args, *patch.DisabledBy)
+	}
+	if patch.DisabledReason != nil {
+		set = append(set, "disabled_reason = ?")
+		args = append(args, *patch.DisabledReason)
+	}
+	if patch.RedirectCode != nil {
+		set = append(set, "redirect_code = ?")
+		args = append(args, *patch.RedirectCode)
+	}
+	if patch.CacheControl != nil {
+		set = append(set, "cache_control = ?")
+		args = append(args, *patch.CacheControl)
+	}
+	if patch.QueryPassthrough != nil {
+		set = append(set, "query_passthrough = ?")
+		args = append(args, *patch.QueryPassthrough)
+	}
+	if patch.PathPassthrough != nil {
+		set = append(set, "path_passthrough = ?")
+		args = append(args, *patch.PathPassthrough)
+	}
+	if patch.UTM != nil {
+		set = append(set, "utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_term = ?, utm_content = ?")
+		args = append(args, patch.UTM.Source, patch.UTM.Medium, patch.UTM.Campaign, patch.UTM.Term, patch.UTM.Content)
+	}
+	if patch.Routes != nil {
+		routes, err := encodeTargets(patch.Routes)
+		if err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		set = append(set, "routes = ?")
+		args = append(args, routes)
+	}
+	if patch.Countries != nil {
+		countries, err := encodeTargets(patch.Countries)
+		if err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		set = append(set, "countries = ?")
+		args = append(args, countries)
+	}
+	if patch.Variants != nil {
+		variants, err := encodeVariants(patch.Variants)
+		if err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+		set = append(set, "variants = ?")
+		args = append(args, variants)
+	}
+	if patch.Folder != nil {
+		set = append(set, "folder = ?")
+		args = append(args, *patch.Folder)
+	}
+	if patch.Title != nil {
+		set = append(set, "title = ?")
+		args = append(args, *patch.Title)
+	}
+	if patch.Description != nil {
+		set = append(set, "description = ?")
+		args = append(args, *patch.Description)
+	}
+	if patch.Notes != nil {
+		set = append(set, "notes = ?")
+		args = append(args, *patch.Notes)
+	}
+
+	if len(set) == 0 && patch.Tags == nil {
+		return s.GetLink(ctx, username, alias)
+	}
+	set = append(set, "updated_at = ?")
+	args = append(args, time.Now().UTC())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	id, url, err := linkID(ctx, tx, username, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return storage.Link{}, err
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `UPDATE urls SET ` + strings.Join(set, ", ") + ` WHERE id = ?`
+
+	if _, err := tx.ExecContext(ctx, query, append(args, id)...); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return storage.Link{}, storage.ErrNewAliasAlreadyExists
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if patch.Tags != nil {
+		if err := setTags(ctx, tx, id, patch.Tags); err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
 
-	if url, err := s.cache.Get(ctx, username, alias); err == nil {
-		return url, nil
+	urlChanged := patch.Url != nil && *patch.Url != url
+	aliasChanged := patch.Alias != nil && *patch.Alias != alias
+	if urlChanged || aliasChanged {
+		if err := recordVersion(ctx, tx, id, newVersion(alias, url, storage.ActorFromContext(ctx, username))); err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if patch.Alias != nil {
+		alias = *patch.Alias
+	}
+
+	return s.GetLink(ctx, username, alias)
+}
+
+func (s *Store) ListURLs(ctx context.Context, username string, filter storage.LinkFilter) ([]storage.Link, error) {
+	const op = "sqlite.ListURLs"
+
 	query := `
-		SELECT url
+		SELECT ` + linkColumns + `
 		FROM users AS u
 		JOIN urls AS l ON u.id = l.user_id
-		WHERE u.username = ? AND l.alias = ?
+		WHERE u.username = ?
 	`
+	args := []any{username}
 
-	var url string
-	err := s.db.QueryRowContext(ctx, query, username, alias).Scan(&url)
+	if filter.Folder != "" {
+		query += ` AND l.folder = ?`
+		args = append(args, filter.Folder)
+	}
+	for _, tag := range filter.Tags {
+		query += ` AND l.id IN (SELECT url_id FROM link_tags WHERE tag = ?)`
+		args = append(args, tag)
+	}
+	query += ` ORDER BY l.id`
 
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]storage.Link, 0)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return links, nil
+}
+
+// UseClick reads the link in the transaction taking the click,
+// so the link returned is the state the click was taken from, whatever edits follow
+func (s *Store) UseClick(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "sqlite.UseClick"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		UPDATE urls SET remaining_clicks = remaining_clicks - 1, clicks = clicks + 1
+		WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ? AND remaining_clicks > 0
+	`
+
+	res, err := tx.ExecContext(ctx, query, username, alias)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	link, err := getLink(ctx, tx, username, alias)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", storage.ErrAliasNotFound
+			return storage.Link{}, storage.ErrAliasNotFound
 		}
-		return "", fmt.Errorf("%s: %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return url, nil
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return storage.Link{}, storage.ErrClicksExhausted
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return link, nil
 }
 
-func (s *Store) DeleteURL(ctx context.Context, username, alias string) error {
-	const op = "sqlite.DeleteURL"
+func (s *Store) CountClick(ctx context.Context, username, alias string) error {
+	const op = "sqlite.CountClick"
 
-	query := `DELETE FROM urls WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?`
+	query := `
+		UPDATE urls SET clicks = clicks + 1
+		WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?
+	`
 
 	res, err := s.db.ExecContext(ctx, query, username, alias)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if cnt, _ := res.RowsAffected(); cnt == int64(0) {
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cnt == 0 {
 		return storage.ErrAliasNotFound
 	}
 
-	if err := s.cache.Delete(ctx, username, alias); err != nil {
-		return storage.ErrCacheDelete
+	return nil
+}
+
+// CountVariantClick increments clicks of the first variant with {url} inside the JSON array in a single statement,
+// so concurrent redirects do not lose clicks
+func (s *Store) CountVariantClick(ctx context.Context, username, alias, url string) error {
+	const op = "sqlite.CountVariantClick"
+
+	query := `
+		UPDATE urls SET variants = (
+			SELECT json_set(urls.variants, '$[' || v.key || '].clicks', COALESCE(json_extract(v.value, '$.clicks'), 0) + 1)
+			FROM json_each(urls.variants) v
+			WHERE json_extract(v.value, '$.url') = ?
+			ORDER BY v.key LIMIT 1
+		)
+		WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?
+			AND variants != '' AND EXISTS (
+				SELECT 1 FROM json_each(urls.variants) v WHERE json_extract(v.value, '$.url') = ?
+			)
+	`
+
+	res, err := s.db.ExecContext(ctx, query, url, username, alias, url)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cnt == 0 {
+		return storage.ErrVariantNotFound
 	}
 
 	return nil
 }
 
-func (s *Store) UpdateAlias(ctx context.Context, username, alias, newAlias string) error {
-	const op = "sqlite.UpdateAlias"
+// SaveUser sets the password of a user created along with its links or settings,
+// a user that already has a password exists
+func (s *Store) SaveUser(ctx context.Context, username, passwordHash string) error {
+	const op = "sqlite.SaveUser"
 
-	query := `UPDATE urls SET alias = ? WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?`
+	query := `
+		INSERT INTO users (username, password_hash) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET password_hash = excluded.password_hash
+		WHERE users.password_hash = ''
+	`
 
-	res, err := s.db.ExecContext(ctx, query, newAlias, username, alias)
+	res, err := s.db.ExecContext(ctx, query, username, passwordHash)
 	if err != nil {
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
-			return storage.ErrNewAliasAlreadyExists
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cnt == 0 {
+		return storage.ErrUserAlreadyExists
+	}
+
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, username string) (storage.User, error) {
+	const op = "sqlite.GetUser"
+
+	query := `
+		SELECT password_hash, disabled, utm_source, utm_medium, utm_campaign, utm_term, utm_content, force_preview
+		FROM users WHERE username = ?
+	`
+
+	user := storage.User{Username: username}
+	err := s.db.QueryRowContext(ctx, query, username).Scan(
+		&user.PasswordHash, &user.Disabled,
+		&user.UTM.Source, &user.UTM.Medium, &user.UTM.Campaign, &user.UTM.Term, &user.UTM.Content,
+		&user.ForcePreview,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.User{}, storage.ErrUserNotFound
 		}
+		return storage.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Store) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	const op = "sqlite.SetUserDisabled"
+
+	query := `
+		INSERT INTO users (username, disabled) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET disabled = excluded.disabled
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, username, disabled); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if cnt, _ := res.RowsAffected(); cnt == int64(0) {
-		return storage.ErrAliasNotFound
+	return nil
+}
+
+func (s *Store) SetUserUTM(ctx context.Context, username string, utm storage.UTM) error {
+	const op = "sqlite.SetUserUTM"
+
+	query := `
+		INSERT INTO users (username, utm_source, utm_medium, utm_campaign, utm_term, utm_content)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET
+			utm_source = excluded.utm_source,
+			utm_medium = excluded.utm_medium,
+			utm_campaign = excluded.utm_campaign,
+			utm_term = excluded.utm_term,
+			utm_content = excluded.utm_content
+	`
+
+	_, err := s.db.ExecContext(ctx, query, username, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.cache.Update(ctx, username, alias, newAlias); err != nil {
-		return storage.ErrCacheUpdate
+	return nil
+}
+
+func (s *Store) SetUserForcePreview(ctx context.Context, username string, force bool) error {
+	const op = "sqlite.SetUserForcePreview"
+
+	query := `
+		INSERT INTO users (username, force_preview) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET force_preview = excluded.force_preview
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, username, force); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
+
+func (s *Store) ListAllURLs(ctx context.Context) ([]storage.Link, error) {
+	const op = "sqlite.ListAllURLs"
+
+	query := `
+		SELECT ` + linkColumns + `
+		FROM users AS u
+		JOIN urls AS l ON u.id = l.user_id
+		ORDER BY l.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]storage.Link, 0)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return links, nil
+}
+
+func (s *Store) ReassignURLs(ctx context.Context, from, to string) (int64, error) {
+	const op = "sqlite.ReassignURLs"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// nothing is written, not even the new owner, unless there are links to move
+	var fromId, cnt int64
+	query := `SELECT u.id, (SELECT COUNT(*) FROM urls WHERE user_id = u.id) FROM users AS u WHERE u.username = ?`
+	if err := tx.QueryRowContext(ctx, query, from).Scan(&fromId, &cnt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if cnt == 0 {
+		return 0, nil
+	}
+
+	toId, err := userID(ctx, tx, to)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `UPDATE urls SET user_id = ? WHERE user_id = ?`
+
+	res, err := tx.ExecContext(ctx, query, toId, fromId)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnt, _ = res.RowsAffected()
+	return cnt, nil
+}
+
+func (s *Store) PurgeURLs(ctx context.Context, username string) (int64, error) {
+	const op = "sqlite.PurgeURLs"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		DELETE FROM link_history
+		WHERE url_id IN (SELECT id FROM urls WHERE user_id = (SELECT id FROM users WHERE username = ?))
+	`
+
+	if _, err := tx.ExecContext(ctx, query, username); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		DELETE FROM link_tags
+		WHERE url_id IN (SELECT id FROM urls WHERE user_id = (SELECT id FROM users WHERE username = ?))
+	`
+
+	if _, err := tx.ExecContext(ctx, query, username); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `DELETE FROM urls WHERE user_id = (SELECT id FROM users WHERE username = ?)`
+
+	res, err := tx.ExecContext(ctx, query, username)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnt, _ := res.RowsAffected()
+	return cnt, nil
+}
+
+func (s *Store) Stats(ctx context.Context) (storage.Stats, error) {
+	const op = "sqlite.Stats"
+
+	stats := storage.Stats{LinksPerUser: make(map[string]int64)}
+
+	query := `
+		SELECT u.username, COUNT(*)
+		FROM users AS u
+		JOIN urls AS l ON u.id = l.user_id
+		GROUP BY u.username
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			username string
+			cnt      int64
+		)
+		if err := rows.Scan(&username, &cnt); err != nil {
+			return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.LinksPerUser[username] = cnt
+		stats.Links += cnt
+	}
+
+	if err := rows.Err(); err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `SELECT COUNT(*), COALESCE(SUM(disabled), 0) FROM users`
+
+	if err := s.db.QueryRowContext(ctx, query).Scan(&stats.Users, &stats.DisabledUsers); err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// linkColumns are read by scanLink
+const linkColumns = `
+	u.username, l.alias, l.url, l.password_hash, l.max_clicks, l.remaining_clicks,
+	l.not_before, l.not_after, l.redirect_code, l.cache_control, l.query_passthrough, l.path_passthrough,
+	l.utm_source, l.utm_medium, l.utm_campaign, l.utm_term, l.utm_content, l.routes, l.variants, l.countries,
+	l.created_at, l.clicks, l.disabled, l.disabled_by, l.disabled_reason, l.folder,
+	l.updated_at, l.title, l.description, l.notes,
+	(SELECT json_group_array(tag) FROM link_tags WHERE url_id = l.id)
+`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row scanner) (storage.Link, error) {
+	var (
+		link                 storage.Link
+		notBefore, notAfter  sql.NullTime
+		createdAt, updatedAt sql.NullTime
+		routes, variants     string
+		countries, tags      string
+	)
+
+	err := row.Scan(
+		&link.Username, &link.Alias, &link.Url, &link.PasswordHash,
+		&link.MaxClicks, &link.RemainingClicks, &notBefore, &notAfter,
+		&link.RedirectCode, &link.CacheControl, &link.QueryPassthrough, &link.PathPassthrough,
+		&link.UTM.Source, &link.UTM.Medium, &link.UTM.Campaign, &link.UTM.Term, &link.UTM.Content,
+		&routes, &variants, &countries, &createdAt, &link.Clicks,
+		&link.Disabled, &link.DisabledBy, &link.DisabledReason, &link.Folder,
+		&updatedAt, &link.Title, &link.Description, &link.Notes, &tags,
+	)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	if link.Tags, err = decodeTags(tags); err != nil {
+		return storage.Link{}, err
+	}
+
+	if link.Routes, err = decodeTargets(routes); err != nil {
+		return storage.Link{}, err
+	}
+	if link.Countries, err = decodeTargets(countries); err != nil {
+		return storage.Link{}, err
+	}
+	if link.Variants, err = decodeVariants(variants); err != nil {
+		return storage.Link{}, err
+	}
+
+	if notBefore.Valid {
+		link.NotBefore = &notBefore.Time
+	}
+	if notAfter.Valid {
+		link.NotAfter = &notAfter.Time
+	}
+	if createdAt.Valid {
+		link.CreatedAt = &createdAt.Time
+	}
+	if updatedAt.Valid {
+		link.UpdatedAt = &updatedAt.Time
+	}
+
+	return link, nil
+}
+
+// encodeTargets stores routes or country rules as a JSON object, no targets are stored as an empty string
+func encodeTargets(targets map[string]string) (string, error) {
+	if len(targets) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode targets: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func decodeTargets(data string) (map[string]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var targets map[string]string
+	if err := json.Unmarshal([]byte(data), &targets); err != nil {
+		return nil, fmt.Errorf("failed to decode targets: %w", err)
+	}
+
+	return targets, nil
+}
+
+// encodeVariants stores variants as a JSON array, no variants are stored as an empty string
+func encodeVariants(variants []storage.Variant) (string, error) {
+	if len(variants) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode variants: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func decodeVariants(data string) ([]storage.Variant, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var variants []storage.Variant
+	if err := json.Unmarshal([]byte(data), &variants); err != nil {
+		return nil, fmt.Errorf("failed to decode variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+// utc keeps stored times comparable regardless of the server time zone
+func utc(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// userID returns id of {username}, inserting the user if it does not exist
+func userID(ctx context.Context, q querier, username string) (int64, error) {
+	var userId int64
+	err := q.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&userId)
+	if err == nil {
+		return userId, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to select user_id: %w", err)
+	}
+
+	res, err := q.ExecContext(ctx, "INSERT INTO users (username) VALUES (?)", username)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert new user: %w", err)
+	}
+
+	userId, err = res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last inserted id: %w", err)
+	}
+
+	return userId, nil
+}
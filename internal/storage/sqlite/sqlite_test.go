@@ -0,0 +1,390 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"url-shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_UseClick(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	require.NoError(t, s.SaveLink(ctx, storage.Link{
+		Username:        "pasha",
+		Alias:           "invite",
+		Url:             "https://go.dev",
+		MaxClicks:       10,
+		RemainingClicks: 10,
+	}))
+
+	var (
+		wg        sync.WaitGroup
+		used      atomic.Int64
+		exhausted atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.UseClick(ctx, "pasha", "invite")
+			if err == nil {
+				used.Add(1)
+			} else if assert.ErrorIs(t, err, storage.ErrClicksExhausted) {
+				exhausted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), used.Load())
+	assert.Equal(t, int64(40), exhausted.Load())
+
+	_, err := s.UseClick(ctx, "pasha", "gmail")
+	assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+}
+
+func TestStore_UpdateLink(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}))
+
+	code, cacheControl := 301, "public, max-age=60"
+
+	link, err := s.UpdateLink(ctx, "pasha", "lms", storage.LinkPatch{RedirectCode: &code})
+	require.NoError(t, err)
+	assert.Equal(t, 301, link.RedirectCode)
+	assert.Empty(t, link.CacheControl)
+
+	link, err = s.UpdateLink(ctx, "pasha", "lms", storage.LinkPatch{CacheControl: &cacheControl})
+	require.NoError(t, err)
+	assert.Equal(t, 301, link.RedirectCode)
+	assert.Equal(t, cacheControl, link.CacheControl)
+
+	routes := map[string]string{"ios": "https://apps.apple.com/app/stepik"}
+	link, err = s.UpdateLink(ctx, "pasha", "lms", storage.LinkPatch{Routes: routes})
+	require.NoError(t, err)
+	assert.Equal(t, routes, link.Routes)
+
+	link, err = s.UpdateLink(ctx, "pasha", "lms", storage.LinkPatch{Routes: map[string]string{}})
+	require.NoError(t, err)
+	assert.Nil(t, link.Routes)
+
+	_, err = s.UpdateLink(ctx, "pasha", "gmail", storage.LinkPatch{RedirectCode: &code})
+	assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+}
+
+func TestStore_CountVariantClick(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	require.NoError(t, s.SaveLink(ctx, storage.Link{
+		Username: "pasha",
+		Alias:    "landing",
+		Url:      "https://example.com",
+		Variants: []storage.Variant{
+			{Url: "https://example.com/a", Weight: 1},
+			{Url: "https://example.com/b", Weight: 1},
+		},
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.CountVariantClick(ctx, "pasha", "landing", fmt.Sprintf("https://example.com/%c", 'a'+i%2)))
+		}()
+	}
+	wg.Wait()
+
+	link, err := s.GetLink(ctx, "pasha", "landing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), link.Variants[0].Clicks)
+	assert.Equal(t, int64(10), link.Variants[1].Clicks)
+
+	// variants reordered after the variant was picked
+	variants := []storage.Variant{link.Variants[1], link.Variants[0]}
+	_, err = s.UpdateLink(ctx, "pasha", "landing", storage.LinkPatch{Variants: variants})
+	require.NoError(t, err)
+	require.NoError(t, s.CountVariantClick(ctx, "pasha", "landing", "https://example.com/a"))
+
+	link, err = s.GetLink(ctx, "pasha", "landing")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", link.Variants[1].Url)
+	assert.Equal(t, int64(11), link.Variants[1].Clicks)
+
+	assert.ErrorIs(t, s.CountVariantClick(ctx, "pasha", "landing", "https://example.com/c"), storage.ErrVariantNotFound)
+	assert.ErrorIs(t, s.CountVariantClick(ctx, "pasha", "gmail", "https://example.com/a"), storage.ErrVariantNotFound)
+}
+
+func TestStore_Trash(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	routes := map[string]string{"ios": "https://apps.apple.com/app/stepik"}
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn", Routes: routes}))
+
+	now := time.Now()
+	require.NoError(t, s.TrashURL(ctx, "pasha", "lms", now, now.Add(time.Hour)))
+	assert.ErrorIs(t, s.TrashURL(ctx, "pasha", "lms", now, now.Add(time.Hour)), storage.ErrAliasNotFound)
+
+	_, err := s.GetLink(ctx, "pasha", "lms")
+	assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+
+	trashed, err := s.ListTrash(ctx, "pasha")
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	assert.Equal(t, routes, trashed[0].Routes)
+	assert.WithinDuration(t, now.Add(time.Hour), trashed[0].ExpiresAt, time.Second)
+
+	// the alias is free while the link is in the trash
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "lms", Url: "https://go.dev"}))
+	_, err = s.RestoreURL(ctx, "pasha", "lms")
+	assert.ErrorIs(t, err, storage.ErrAliasAlreadyExist)
+
+	require.NoError(t, s.UpdateAlias(ctx, "pasha", "lms", "go"))
+	link, err := s.RestoreURL(ctx, "pasha", "lms")
+	require.NoError(t, err)
+	assert.Equal(t, "https://stepik.org/learn", link.Url)
+
+	_, err = s.RestoreURL(ctx, "pasha", "lms")
+	assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+
+	require.NoError(t, s.TrashURL(ctx, "pasha", "lms", now, now.Add(time.Hour)))
+	require.NoError(t, s.TrashURL(ctx, "pasha", "go", now, now.Add(time.Minute)))
+
+	n, err := s.EmptyTrash(ctx, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, s.PurgeTrashed(ctx, "pasha", "lms"))
+	assert.ErrorIs(t, s.PurgeTrashed(ctx, "pasha", "lms"), storage.ErrAliasNotFound)
+
+	trashed, err = s.ListTrash(ctx, "pasha")
+	require.NoError(t, err)
+	assert.Empty(t, trashed)
+}
+
+func TestStore_LinkHistory(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}))
+	url := "https://go.dev"
+	_, err := s.UpdateLink(ctx, "pasha", "lms", storage.LinkPatch{Url: &url})
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateAlias(ctx, "pasha", "lms", "go"))
+
+	versions, err := s.LinkHistory(ctx, "pasha", "go")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, storage.LinkVersion{Version: 1, Alias: "lms", Url: "https://stepik.org/learn", ChangedBy: "pasha", ChangedAt: versions[0].ChangedAt}, versions[0])
+	assert.Equal(t, "lms", versions[1].Alias)
+	assert.Equal(t, "https://go.dev", versions[1].Url)
+
+	// the history follows the link through the trash
+	now := time.Now()
+	require.NoError(t, s.TrashURL(ctx, "pasha", "go", now, now.Add(time.Hour)))
+	_, err = s.LinkHistory(ctx, "pasha", "go")
+	assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+	_, err = s.RestoreURL(ctx, "pasha", "go")
+	require.NoError(t, err)
+
+	restored, err := s.LinkHistory(ctx, "pasha", "go")
+	require.NoError(t, err)
+	assert.Len(t, restored, 2)
+
+	// a rename with a new url is one version, and nothing changes if the alias is taken
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "taken", Url: "https://go.dev/doc"}))
+	alias, url := "taken", "https://stepik.org/learn"
+	_, err = s.UpdateLink(ctx, "pasha", "go", storage.LinkPatch{Alias: &alias, Url: &url})
+	assert.ErrorIs(t, err, storage.ErrNewAliasAlreadyExists)
+
+	alias = "lms"
+	link, err := s.UpdateLink(storage.WithActor(ctx, "admin"), "pasha", "go", storage.LinkPatch{Alias: &alias, Url: &url})
+	require.NoError(t, err)
+	assert.Equal(t, "lms", link.Alias)
+	assert.Equal(t, url, link.Url)
+
+	versions, err = s.LinkHistory(ctx, "pasha", "lms")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "go", versions[2].Alias)
+	assert.Equal(t, "https://go.dev", versions[2].Url)
+	assert.Equal(t, "admin", versions[2].ChangedBy)
+}
+
+func TestStore_AuditEvents(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	start := time.Now()
+	lms := storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}
+	events := []storage.AuditEvent{
+		{Time: start, Actor: "pasha", Action: "save", Username: "pasha", Alias: "lms", After: &lms, IP: "10.0.0.1", RequestID: "req-1"},
+		{Time: start.Add(time.Second), Actor: "pasha", Action: "delete", Username: "pasha", Alias: "lms", Before: &lms},
+		{Time: start.Add(2 * time.Second), Actor: "vova", Action: "save", Username: "vova", Alias: "go"},
+	}
+	for _, event := range events {
+		require.NoError(t, s.SaveAuditEvent(ctx, event))
+	}
+
+	page, err := s.ListAuditEvents(ctx, storage.AuditFilter{Actor: "pasha", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "delete", page[0].Action)
+	assert.Equal(t, &lms, page[0].Before)
+	assert.Nil(t, page[0].After)
+
+	page, err = s.ListAuditEvents(ctx, storage.AuditFilter{Actor: "pasha", Cursor: page[0].ID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "req-1", page[0].RequestID)
+
+	page, err = s.ListAuditEvents(ctx, storage.AuditFilter{Since: start.Add(time.Second), Until: start.Add(2 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "delete", page[0].Action)
+
+	_, err = s.ListAuditEvents(ctx, storage.AuditFilter{Cursor: "next"})
+	assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+
+	// recorded events cannot be changed
+	_, err = s.db.ExecContext(ctx, `DELETE FROM audit`)
+	assert.Error(t, err)
+}
+
+func TestStore_ListURLsFilter(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	links := []storage.Link{
+		{Username: "pasha", Alias: "go", Url: "https://go.dev", Tags: []string{"go", "lang"}, Folder: "docs"},
+		{Username: "pasha", Alias: "rust", Url: "https://rust-lang.org", Tags: []string{"lang"}},
+		{Username: "vova", Alias: "go", Url: "https://go.dev", Tags: []string{"go"}, Folder: "docs"},
+	}
+	for _, link := range links {
+		require.NoError(t, s.SaveLink(ctx, link))
+	}
+
+	aliases := func(filter storage.LinkFilter) []string {
+		found, err := s.ListURLs(ctx, "pasha", filter)
+		require.NoError(t, err)
+		res := make([]string, 0, len(found))
+		for _, link := range found {
+			res = append(res, link.Alias)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"go", "rust"}, aliases(storage.LinkFilter{}))
+	assert.Equal(t, []string{"go", "rust"}, aliases(storage.LinkFilter{Tags: []string{"lang"}}))
+	assert.Equal(t, []string{"go"}, aliases(storage.LinkFilter{Tags: []string{"lang", "go"}}))
+	assert.Equal(t, []string{"go"}, aliases(storage.LinkFilter{Folder: "docs"}))
+	assert.Empty(t, aliases(storage.LinkFilter{Tags: []string{"go"}, Folder: "misc"}))
+
+	link, err := s.GetLink(ctx, "pasha", "go")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "lang"}, link.Tags)
+	assert.Equal(t, "docs", link.Folder)
+
+	folder := ""
+	link, err = s.UpdateLink(ctx, "pasha", "go", storage.LinkPatch{Tags: []string{"web"}, Folder: &folder})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web"}, link.Tags)
+	assert.Empty(t, link.Folder)
+	assert.Equal(t, []string{"go"}, aliases(storage.LinkFilter{Tags: []string{"web"}}))
+
+	// tags come back with a link restored from the trash
+	now := time.Now()
+	require.NoError(t, s.TrashURL(ctx, "pasha", "go", now, now.Add(time.Hour)))
+	assert.Empty(t, aliases(storage.LinkFilter{Tags: []string{"web"}}))
+	_, err = s.RestoreURL(ctx, "pasha", "go")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go"}, aliases(storage.LinkFilter{Tags: []string{"web"}}))
+}
+
+func TestStore_LinkMetadata(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, s.SaveLink(ctx, storage.Link{
+		Username: "pasha", Alias: "go", Url: "https://go.dev",
+		CreatedAt: &created, UpdatedAt: &created,
+		Title: "Go", Description: "The Go programming language", Notes: "for the team",
+	}))
+
+	link, err := s.GetLink(ctx, "pasha", "go")
+	require.NoError(t, err)
+	assert.Equal(t, "Go", link.Title)
+	assert.Equal(t, "The Go programming language", link.Description)
+	assert.Equal(t, "for the team", link.Notes)
+	assert.True(t, created.Equal(*link.UpdatedAt))
+
+	title, notes := "Go docs", ""
+	link, err = s.UpdateLink(ctx, "pasha", "go", storage.LinkPatch{Title: &title, Notes: &notes})
+	require.NoError(t, err)
+	assert.Equal(t, "Go docs", link.Title)
+	assert.Equal(t, "The Go programming language", link.Description)
+	assert.Empty(t, link.Notes)
+	assert.True(t, created.Equal(*link.CreatedAt))
+	assert.True(t, link.UpdatedAt.After(created))
+
+	updated := *link.UpdatedAt
+	require.NoError(t, s.CountClick(ctx, "pasha", "go"))
+	link, err = s.GetLink(ctx, "pasha", "go")
+	require.NoError(t, err)
+	assert.True(t, updated.Equal(*link.UpdatedAt), "clicks do not change updated_at")
+}
+
+func TestStore_Users(t *testing.T) {
+	ctx := context.Background()
+	s := MustNew(timeout, filepath.Join(t.TempDir(), "data.db"))
+
+	require.NoError(t, s.SaveLink(ctx, storage.Link{Username: "pasha", Alias: "lms", Url: "https://stepik.org/learn"}))
+	require.NoError(t, s.SetUserDisabled(ctx, "vova", true))
+
+	stats, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Users, "owners created along with their links are users")
+	assert.Equal(t, int64(1), stats.DisabledUsers)
+
+	// the owner of links registers, but only once
+	require.NoError(t, s.SaveUser(ctx, "pasha", "hash"))
+	assert.ErrorIs(t, s.SaveUser(ctx, "pasha", "other"), storage.ErrUserAlreadyExists)
+
+	user, err := s.GetUser(ctx, "pasha")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.PasswordHash)
+
+	_, err = s.ReassignURLs(ctx, "kolya", "masha")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = s.GetUser(ctx, "masha")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound, "nothing is written for an unknown user")
+
+	cnt, err := s.ReassignURLs(ctx, "vova", "masha")
+	require.NoError(t, err)
+	assert.Zero(t, cnt)
+	_, err = s.GetUser(ctx, "masha")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound, "nothing is written for a user without links")
+
+	cnt, err = s.ReassignURLs(ctx, "pasha", "masha")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	stats, err = s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Users)
+	assert.Equal(t, map[string]int64{"masha": 1}, stats.LinksPerUser)
+}
@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+// setTags replaces tags of the link with {urlID}
+func setTags(ctx context.Context, q querier, urlID int64, tags []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM link_tags WHERE url_id = ?`, urlID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := q.ExecContext(ctx, `INSERT OR IGNORE INTO link_tags (url_id, tag) VALUES (?, ?)`, urlID, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeTags reads the JSON array aggregated by linkColumns, sorting it as the aggregation keeps no order
+func decodeTags(data string) ([]string, error) {
+	var tags []string
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
@@ -0,0 +1,222 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/storage"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// TrashURL keeps the link and its history as JSON in the trash, so the trash does not follow changes of the urls table
+func (s *Store) TrashURL(ctx context.Context, username, alias string, deletedAt, expiresAt time.Time) error {
+	const op = "sqlite.TrashURL"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		SELECT ` + linkColumns + `
+		FROM users AS u
+		JOIN urls AS l ON u.id = l.user_id
+		WHERE u.username = ? AND l.alias = ?
+	`
+
+	link, err := scanLink(tx.QueryRowContext(ctx, query, username, alias))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrAliasNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, _, err := linkID(ctx, tx, username, alias)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions, err := history(ctx, tx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	historyData, err := encodeHistory(versions)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM link_history WHERE url_id = ?`, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setTags(ctx, tx, id, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		INSERT INTO trash (user_id, alias, link, history, deleted_at, expires_at)
+		VALUES ((SELECT id FROM users WHERE username = ?), ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, alias) DO UPDATE SET
+			link = excluded.link,
+			history = excluded.history,
+			deleted_at = excluded.deleted_at,
+			expires_at = excluded.expires_at
+	`
+
+	_, err = tx.ExecContext(ctx, query, username, alias, string(data), historyData, deletedAt.UTC(), expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) ListTrash(ctx context.Context, username string) ([]storage.TrashedLink, error) {
+	const op = "sqlite.ListTrash"
+
+	query := `
+		SELECT t.link, t.deleted_at, t.expires_at
+		FROM users AS u
+		JOIN trash AS t ON u.id = t.user_id
+		WHERE u.username = ?
+		ORDER BY t.deleted_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]storage.TrashedLink, 0)
+	for rows.Next() {
+		var (
+			link storage.TrashedLink
+			data string
+		)
+		if err := rows.Scan(&data, &link.DeletedAt, &link.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal([]byte(data), &link.Link); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return links, nil
+}
+
+func (s *Store) RestoreURL(ctx context.Context, username, alias string) (storage.Link, error) {
+	const op = "sqlite.RestoreURL"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		SELECT t.link, t.history
+		FROM users AS u
+		JOIN trash AS t ON u.id = t.user_id
+		WHERE u.username = ? AND t.alias = ?
+	`
+
+	var data, historyData string
+	if err := tx.QueryRowContext(ctx, query, username, alias).Scan(&data, &historyData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.Link{}, storage.ErrAliasNotFound
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var link storage.Link
+	if err := json.Unmarshal([]byte(data), &link); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions, err := decodeHistory(historyData)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := insertLink(ctx, tx, link)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, storage.ErrAliasAlreadyExist)
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range versions {
+		if err := recordVersion(ctx, tx, id, v); err != nil {
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	query = `DELETE FROM trash WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?`
+
+	if _, err := tx.ExecContext(ctx, query, username, alias); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return link, nil
+}
+
+func (s *Store) PurgeTrashed(ctx context.Context, username, alias string) error {
+	const op = "sqlite.PurgeTrashed"
+
+	query := `DELETE FROM trash WHERE user_id = (SELECT id FROM users WHERE username = ?) AND alias = ?`
+
+	res, err := s.db.ExecContext(ctx, query, username, alias)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cnt, _ := res.RowsAffected(); cnt == int64(0) {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) EmptyTrash(ctx context.Context, before time.Time) (int64, error) {
+	const op = "sqlite.EmptyTrash"
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM trash WHERE expires_at <= ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnt, _ := res.RowsAffected()
+	return cnt, nil
+}
@@ -3,26 +3,318 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 // Storage interface for storage
 type Storage interface {
-	// SaveURL saves {url} by {alias}
-	SaveURL(ctx context.Context, url, alias, username string) error
-	// GetURL returns {url} by {alias}
-	GetURL(ctx context.Context, username, alias string) (string, error)
+	// SaveLink saves {link} by its alias
+	SaveLink(ctx context.Context, link Link) error
+	// GetLink returns link by {alias}
+	GetLink(ctx context.Context, username, alias string) (Link, error)
 	// DeleteURL deletes {url} by {alias}
 	DeleteURL(ctx context.Context, username, alias string) error
-	//UpdateAlias replaces {alias} for {url}
+	// TrashURL moves the link saved by {alias} to the trash of {username} until {expiresAt}, freeing the alias.
+	// A link trashed earlier under the same alias is replaced
+	TrashURL(ctx context.Context, username, alias string, deletedAt, expiresAt time.Time) error
+	// ListTrash returns links in the trash of {username}, recently deleted first
+	ListTrash(ctx context.Context, username string) ([]TrashedLink, error)
+	// RestoreURL moves the link trashed under {alias} back and returns it.
+	// It fails with ErrAliasAlreadyExist leaving the link in the trash if the alias was taken meanwhile
+	RestoreURL(ctx context.Context, username, alias string) (Link, error)
+	// PurgeTrashed deletes the link trashed under {alias} permanently
+	PurgeTrashed(ctx context.Context, username, alias string) error
+	// EmptyTrash deletes links of all users trashed until {before} permanently and returns how many
+	EmptyTrash(ctx context.Context, before time.Time) (int64, error)
+	//UpdateAlias replaces {alias} for {url}, recording the old alias in the link history and setting UpdatedAt
 	UpdateAlias(ctx context.Context, username, oldAlias, newAlias string) error
+	// UpdateLink applies {patch} to the link saved by {alias} and returns the updated link.
+	// A changed alias or url is recorded in the link history as one version, UpdatedAt is set unless {patch} is empty.
+	// It fails with ErrNewAliasAlreadyExists without changes if the new alias is taken
+	UpdateLink(ctx context.Context, username, alias string, patch LinkPatch) (Link, error)
+	// LinkHistory returns what the link saved by {alias} was before each change of its alias or url, oldest first
+	LinkHistory(ctx context.Context, username, alias string) ([]LinkVersion, error)
+	// ListURLs returns links of {username} matching {filter}
+	ListURLs(ctx context.Context, username string, filter LinkFilter) ([]Link, error)
+	// UseClick atomically consumes one of the remaining clicks of a click-limited link, counts it and returns the link.
+	// It fails with ErrClicksExhausted if no clicks are left
+	UseClick(ctx context.Context, username, alias string) (Link, error)
+	// CountClick atomically counts a click of the link
+	CountClick(ctx context.Context, username, alias string) error
+	// CountVariantClick atomically counts a click of the variant of the link with {url},
+	// so the click is not lost or miscounted if variants are edited meanwhile.
+	// It fails with ErrVariantNotFound if the link has no such variant
+	CountVariantClick(ctx context.Context, username, alias, url string) error
 
 	Close(ctx context.Context) error
 }
 
+// UserStorage interface for users able to authenticate
+type UserStorage interface {
+	// SaveUser saves new user with {passwordHash}
+	SaveUser(ctx context.Context, username, passwordHash string) error
+	// GetUser returns user by {username}
+	GetUser(ctx context.Context, username string) (User, error)
+	// SetUserDisabled disables or enables {username}, creating the user without password if it does not exist
+	SetUserDisabled(ctx context.Context, username string, disabled bool) error
+	// SetUserUTM replaces default UTM parameters of {username}, creating the user without password if it does not exist
+	SetUserUTM(ctx context.Context, username string, utm UTM) error
+	// SetUserForcePreview turns the preview page before every redirect of links of {username} on or off,
+	// creating the user without password if it does not exist
+	SetUserForcePreview(ctx context.Context, username string, force bool) error
+}
+
+// AdminStorage interface for offline maintenance
+type AdminStorage interface {
+	// ListAllURLs returns links of all users
+	ListAllURLs(ctx context.Context) ([]Link, error)
+	// ReassignURLs moves all links of {from} to {to} and returns how many were moved.
+	// It fails with ErrUserNotFound without writing anything if {from} is unknown.
+	// It fails with ErrAliasAlreadyExist before moving any link if {to} already uses any of the aliases.
+	// Stores without transactions may still move some links if {to} saves a conflicting alias meanwhile,
+	// the links moved by then are counted along with the error
+	ReassignURLs(ctx context.Context, from, to string) (int64, error)
+	// PurgeURLs deletes all links of {username}
+	PurgeURLs(ctx context.Context, username string) (int64, error)
+	// Stats returns storage statistics
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// AuditStorage interface for the append-only audit log, events cannot be changed or deleted through it
+type AuditStorage interface {
+	// SaveAuditEvent appends {event}, its ID is assigned by storage
+	SaveAuditEvent(ctx context.Context, event AuditEvent) error
+	// ListAuditEvents returns events matching {filter}, newest first.
+	// It fails with ErrInvalidCursor if the cursor of {filter} is not an event ID
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
+
+type actorKey struct{}
+
+// WithActor puts who makes changes into {ctx}, storages record them as the author of link history entries
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor put by WithActor, {owner} of the changed link if there is none
+func ActorFromContext(ctx context.Context, owner string) string {
+	if actor, _ := ctx.Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	return owner
+}
+
+// Link is a short link as it is kept in storage
+type Link struct {
+	Username string `json:"username"`
+	Alias    string `json:"alias"`
+	Url      string `json:"url"`
+	// PasswordHash protects the link with a password, empty means the link is public
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks limits how many times the link can be opened, zero means no limit
+	MaxClicks       int64 `json:"max_clicks,omitempty"`
+	RemainingClicks int64 `json:"remaining_clicks,omitempty"`
+	// NotBefore and NotAfter bound the time the link redirects, nil means no bound
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// RedirectCode is the status code of the redirect, zero means the default one
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// CacheControl is the Cache-Control header of the redirect, empty means the default one
+	CacheControl string `json:"cache_control,omitempty"`
+	// QueryPassthrough is how the incoming query is merged into the url, empty means it is dropped
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	// PathPassthrough appends the path following the alias to the url
+	PathPassthrough bool `json:"path_passthrough,omitempty"`
+	// UTM overrides default UTM parameters of the user for this link
+	UTM UTM `json:"utm"`
+	// Routes maps a client platform to the url it is sent to, Url is the fallback for other platforms
+	Routes map[string]string `json:"routes,omitempty"`
+	// Countries maps an ISO 3166-1 alpha-2 country code of the client to the url it is sent to
+	Countries map[string]string `json:"countries,omitempty"`
+	// Variants split the traffic of the link by weight, Url is used only if there are no variants
+	Variants []Variant `json:"variants,omitempty"`
+	// CreatedAt is when the link was saved, links saved before it was recorded got an approximate one from migration,
+	// their first recorded change or the migration time.
+	// UpdatedAt is when the link was last changed by its owner or an admin, clicks do not change it
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Title and Description describe the link to visitors, Notes are seen by its owner only
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+	// Clicks is how many times the link was opened
+	Clicks int64 `json:"clicks"`
+	// Disabled links do not redirect but keep their alias reserved, links whose url turned out to be unsafe are disabled.
+	// DisabledBy is DisabledByOwner, DisabledByAdmin or DisabledBySafety, owners can only enable links they disabled
+	Disabled       bool   `json:"disabled,omitempty"`
+	DisabledBy     string `json:"disabled_by,omitempty"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// Tags group links across folders, they are kept sorted. Folder is empty for links outside folders
+	Tags   []string `json:"tags,omitempty"`
+	Folder string   `json:"folder,omitempty"`
+}
+
+// LinkFilter selects links of a user, zero value selects all of them
+type LinkFilter struct {
+	// Tags selects links having all of them
+	Tags   []string
+	Folder string
+}
+
+// LinkVersion is the alias and url a link had before a change, Version numbers the changes of the link from 1
+type LinkVersion struct {
+	Version int    `json:"version"`
+	Alias   string `json:"alias"`
+	Url     string `json:"url"`
+	// ChangedBy is the actor of the change, the owner of the link if it was not known
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// TrashedLink is a deleted link kept until ExpiresAt, so it can be restored
+type TrashedLink struct {
+	Link
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AuditEvent is a change of a link made by Actor, Before is nil for created links and After for deleted ones
+type AuditEvent struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	// Username and Alias identify the changed link, Alias is the one it had before the change
+	Username  string `json:"username"`
+	Alias     string `json:"alias"`
+	Before    *Link  `json:"before,omitempty"`
+	After     *Link  `json:"after,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// AuditFilter selects audit events, empty fields match any event
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	Username string
+	Alias    string
+	// Since and Until bound the time of events, zero means no bound
+	Since time.Time
+	Until time.Time
+	// Cursor is the ID of the last event of the previous page, only older events are returned
+	Cursor string
+	Limit  int
+}
+
+// Who disabled a link
+const (
+	DisabledByOwner = "owner"
+	DisabledByAdmin = "admin"
+	// DisabledBySafety is set on links whose url was blocklisted after they were saved
+	DisabledBySafety = "safety"
+)
+
+// Variant is one of the destinations of an A/B split link
+type Variant struct {
+	Url    string `json:"url"`
+	Weight int    `json:"weight"`
+	// Clicks is how many times the variant was visited, it is counted in storage only
+	Clicks int64 `json:"clicks"`
+}
+
+// UTM is a set of utm_* parameters added to the url on redirect, empty fields are not added
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// Override returns {u} with fields replaced by the non-empty fields of {o}
+func (u UTM) Override(o UTM) UTM {
+	if o.Source != "" {
+		u.Source = o.Source
+	}
+	if o.Medium != "" {
+		u.Medium = o.Medium
+	}
+	if o.Campaign != "" {
+		u.Campaign = o.Campaign
+	}
+	if o.Term != "" {
+		u.Term = o.Term
+	}
+	if o.Content != "" {
+		u.Content = o.Content
+	}
+	return u
+}
+
+// LinkPatch lists link fields to update, nil fields are left as they are
+type LinkPatch struct {
+	// Alias renames the link along with the other changes
+	Alias *string
+	Url   *string
+	// Disabled, DisabledBy and DisabledReason are set together
+	Disabled         *bool
+	DisabledBy       *string
+	DisabledReason   *string
+	RedirectCode     *int
+	CacheControl     *string
+	QueryPassthrough *string
+	PathPassthrough  *bool
+	// UTM replaces all UTM parameters of the link
+	UTM *UTM
+	// Routes replaces all routes of the link if not nil, an empty map removes them
+	Routes map[string]string
+	// Countries replaces all country rules of the link if not nil, an empty map removes them
+	Countries map[string]string
+	// Variants replaces all variants of the link if not nil, resetting their clicks, an empty slice removes them
+	Variants []Variant
+	// Tags replaces all tags of the link if not nil, an empty slice removes them
+	Tags []string
+	// Folder moves the link to another folder, an empty one takes it out of its folder
+	Folder *string
+	// Title, Description and Notes are replaced if not nil, an empty string removes them
+	Title       *string
+	Description *string
+	Notes       *string
+}
+
+// User is a user as it is kept in storage.
+// Empty PasswordHash means the password is not managed by storage
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Disabled     bool   `json:"disabled"`
+	// UTM is the default UTM parameters of links of the user
+	UTM UTM `json:"utm"`
+	// ForcePreview shows the preview page before every redirect of links of the user
+	ForcePreview bool `json:"force_preview"`
+}
+
+type Stats struct {
+	Links         int64            `json:"links"`
+	LinksPerUser  map[string]int64 `json:"links_per_user"`
+	Users         int64            `json:"users"`
+	DisabledUsers int64            `json:"disabled_users"`
+}
+
 var (
 	ErrAliasNotFound         = errors.New("alias not found")
 	ErrAliasAlreadyExist     = errors.New("alias already exist")
 	ErrNewAliasAlreadyExists = errors.New("new_alias cannot use, url with this alias already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserAlreadyExists     = errors.New("user already exists")
+	ErrClicksExhausted       = errors.New("link has no clicks left")
+	ErrVariantNotFound       = errors.New("link has no such variant")
+	ErrInvalidCursor         = errors.New("cursor is not an audit event id")
 )
 
 var (